@@ -0,0 +1,98 @@
+package buildgo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/outofforest/logger"
+	"go.uber.org/zap"
+)
+
+// sharedFiles are the files affecting all the modules when changed
+var sharedFiles = []string{DefaultGolangCIConfig, "go.work", "go.work.sum"}
+
+// affectedModules returns paths of modules affected by changes made since baseRef, including modules depending
+// on changed ones. If baseRef is empty, value of BUILDGO_BASE_REF environment variable is used.
+// Nil is returned if all the modules should be processed.
+func affectedModules(ctx context.Context, baseRef string) (map[string]bool, error) {
+	if baseRef == "" {
+		baseRef = os.Getenv("BUILDGO_BASE_REF")
+	}
+	if baseRef == "" {
+		return nil, nil
+	}
+	log := logger.Get(ctx)
+
+	mergeBase, err := gitOutput(ctx, "merge-base", baseRef, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	changed, err := gitOutput(ctx, "diff", "-z", "--name-only", "--relative", mergeBase)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitOutput(ctx, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	graph, err := moduleGraph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(graph))
+	for path := range graph {
+		paths = append(paths, filepath.ToSlash(path))
+	}
+	// The deepest module containing the file owns it
+	sort.Slice(paths, func(i, j int) bool {
+		return len(paths[i]) > len(paths[j])
+	})
+
+	affected := map[string]bool{}
+	for _, file := range strings.Split(changed+"\x00"+untracked, "\x00") {
+		if file == "" {
+			continue
+		}
+		if contains(sharedFiles, file) {
+			log.Info("Shared file changed, all modules are affected", zap.String("file", file))
+			return nil, nil
+		}
+
+		var owner string
+		for _, path := range paths {
+			if path == "." || strings.HasPrefix(file, path+"/") {
+				owner = path
+				break
+			}
+		}
+		if owner == "" {
+			log.Info("File outside of modules changed, all modules are affected", zap.String("file", file))
+			return nil, nil
+		}
+		affected[filepath.FromSlash(owner)] = true
+	}
+
+	// Modules depending on affected ones, including those replacing them with local directories, are affected too
+	for changed := true; changed; {
+		changed = false
+		for path, deps := range graph {
+			if affected[path] {
+				continue
+			}
+			for _, dep := range deps {
+				if affected[dep] {
+					affected[path] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	log.Info("Modules affected by changes", zap.String("base", baseRef), zap.Strings("modules", sortedKeys(affected)))
+	return affected, nil
+}
@@ -0,0 +1,95 @@
+package buildgo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// goLocationRegexp matches messages reported by go tools for a location in the file, e.g. file.go:12:5: message
+var goLocationRegexp = regexp.MustCompile(`^\s*([^\s:]+\.go):(\d+)(?::(\d+))?: (.+)$`)
+
+var (
+	annotationMessageEscaper  = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	annotationPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// githubActions returns true if buildgo runs in GitHub Actions
+func githubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// githubAnnotation prints the workflow command creating error annotation. Annotation is attached to the line
+// of the file if file is not empty.
+func githubAnnotation(title, file string, line, col int, message string) {
+	var properties []string
+	if file != "" {
+		properties = append(properties, "file="+annotationPropertyEscaper.Replace(filepath.ToSlash(file)))
+		if line > 0 {
+			properties = append(properties, fmt.Sprintf("line=%d", line))
+		}
+		if col > 0 {
+			properties = append(properties, fmt.Sprintf("col=%d", col))
+		}
+	}
+	properties = append(properties, "title="+annotationPropertyEscaper.Replace(title))
+	fmt.Printf("::error %s::%s\n", strings.Join(properties, ","), annotationMessageEscaper.Replace(message))
+}
+
+// annotateGoLocations creates annotations for all the messages in the output reporting location in the file.
+// Paths in the output are relative to dir. Number of created annotations is returned.
+func annotateGoLocations(title, dir, output string) int {
+	var count int
+	for _, line := range strings.Split(output, "\n") {
+		match := goLocationRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		lineNumber, _ := strconv.Atoi(match[2])
+		col, _ := strconv.Atoi(match[3])
+		githubAnnotation(title, filepath.Join(dir, match[1]), lineNumber, col, match[4])
+		count++
+	}
+	return count
+}
+
+// annotateTestFailures creates annotations for failed tests of the module. Messages logged by failed tests
+// are attached to the lines reporting them, build errors are attached to the lines causing them.
+func annotateTestFailures(ctx context.Context, moduleDir string, results []*testResult) error {
+	modulePath, err := goModulePath(ctx, moduleDir)
+	if err != nil {
+		return err
+	}
+
+	failedBuilds := map[string]bool{}
+	for _, result := range results {
+		if result.Action != "fail" {
+			continue
+		}
+		if result.Test == "" {
+			// The same build failure might break many packages, it is annotated once
+			if result.FailedBuild != "" {
+				if failedBuilds[result.FailedBuild] {
+					continue
+				}
+				failedBuilds[result.FailedBuild] = true
+			}
+			// Build errors are reported relative to the module directory
+			annotateGoLocations("Package "+result.Package+" failed", moduleDir, result.Output.String())
+			continue
+		}
+
+		// Tests report file names relative to the directory of the package
+		pkgDir := filepath.Join(moduleDir, filepath.FromSlash(strings.TrimPrefix(
+			strings.TrimPrefix(result.Package, modulePath), "/")))
+		title := "Test " + result.Test + " failed"
+		if annotateGoLocations(title, pkgDir, result.Output.String()) == 0 {
+			githubAnnotation(title, "", 0, 0, result.Package+"."+result.Test)
+		}
+	}
+	return nil
+}
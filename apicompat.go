@@ -0,0 +1,103 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// APICompatConfig is the configuration of API compatibility check
+type APICompatConfig struct {
+	// Version is the version going to be released. If it is set, gorelease verifies that it is valid
+	// for the changes made since the latest release, otherwise any incompatible change fails the check.
+	Version string
+}
+
+// GoAPICompat compares exported API of library modules against the latest released tag and fails
+// on incompatible changes unless the version bump is a major one
+func GoAPICompat(ctx context.Context, deps build.DepsFunc, config APICompatConfig) error {
+	deps(EnsureGo, EnsureGorelease)
+	log := logger.Get(ctx)
+
+	return onModule(ctx, func(path string) error {
+		isLibrary, err := isLibraryModule(ctx, path)
+		if err != nil {
+			return err
+		}
+		if !isLibrary {
+			return nil
+		}
+
+		baseVersion, err := latestReleasedVersion(ctx, path)
+		if err != nil {
+			return err
+		}
+		if baseVersion == "" {
+			log.Info("Module has not been released yet, skipping API compatibility check", zap.String("path", path))
+			return nil
+		}
+
+		log.Info("Checking API compatibility", zap.String("path", path), zap.String("base", baseVersion))
+
+		args := []string{"-base", baseVersion}
+		if config.Version != "" {
+			args = append(args, "-version", config.Version)
+		}
+		buf := &bytes.Buffer{}
+		cmd := exec.Command("gorelease", args...)
+		cmd.Dir = path
+		cmd.Stdout = io.MultiWriter(os.Stdout, buf)
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "gorelease failed in module '%s'", path)
+		}
+		if config.Version == "" && strings.Contains(buf.String(), "## incompatible changes") {
+			return errors.Errorf("API of module '%s' contains incompatible changes since '%s'", path, baseVersion)
+		}
+		return nil
+	})
+}
+
+func isLibraryModule(ctx context.Context, path string) (bool, error) {
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", "list", "-f", "{{.Name}}", "./...")
+	cmd.Dir = path
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return false, errors.Wrapf(err, "listing packages in module '%s' failed", path)
+	}
+	for _, name := range strings.Fields(buf.String()) {
+		if name != "main" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// latestReleasedVersion returns the highest version tagged for the module, tags of nested modules
+// are prefixed with their relative path
+func latestReleasedVersion(ctx context.Context, path string) (string, error) {
+	var prefix string
+	if path = filepath.ToSlash(filepath.Clean(path)); path != "." {
+		prefix = path + "/"
+	}
+	tags, err := gitOutput(ctx, "tag", "--list", prefix+"v*", "--sort=-v:refname")
+	if err != nil {
+		return "", err
+	}
+	for _, tag := range strings.Fields(tags) {
+		version := strings.TrimPrefix(tag, prefix)
+		if _, _, ok := parseMajorMinor(version); ok && !strings.Contains(version, "-") {
+			return version, nil
+		}
+	}
+	return "", nil
+}
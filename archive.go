@@ -0,0 +1,253 @@
+package buildgo
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DefaultArchiveNameTemplate is the name template producing names of release archives unique for each platform
+const DefaultArchiveNameTemplate = "{{.Name}}-{{.Version}}-{{.GOOS}}-{{.GOARCH}}"
+
+// defaultArchiveFiles are the files added to the archive if they exist
+var defaultArchiveFiles = []string{"LICENSE", "README.md"}
+
+// ArchiveConfig is the configuration of release archives
+type ArchiveConfig struct {
+	// Build is the configuration used to build binaries by GoBuildMatrix, it is used to find them
+	Build BuildConfig
+
+	// Files is the list of additional files stored in the archive, LICENSE and README.md are added if they exist
+	Files []string
+
+	// Dir is the directory where archives are stored, directory of the binaries is used if empty
+	Dir string
+
+	// NameTemplate is the text/template used to compute the name of the archive without extension,
+	// DefaultArchiveNameTemplate is used if empty. Available fields are: Name (base name of Binary without
+	// extension), Version (see Version), GOOS and GOARCH.
+	NameTemplate string
+
+	// ChecksumFile is the path to the file where SHA256 checksums of produced archives are stored
+	ChecksumFile string
+}
+
+// GoReleaseArchives packages binaries built by GoBuildMatrix for the platforms into archives, together
+// with additional files. Windows binaries are stored in zip archives, other ones in tar.gz. Timestamps
+// of files are set to SOURCE_DATE_EPOCH or to the time of the last commit, so archives are reproducible.
+func GoReleaseArchives(ctx context.Context, config ArchiveConfig, platforms ...Platform) error {
+	if len(platforms) == 0 {
+		var err error
+		platforms, err = repoPlatforms()
+		if err != nil {
+			return err
+		}
+		if len(platforms) == 0 {
+			return errors.New("no platforms to package")
+		}
+	}
+
+	version, err := Version(ctx)
+	if err != nil {
+		return err
+	}
+	sourceDateEpoch, err := gitSourceDateEpoch(ctx)
+	if err != nil {
+		return err
+	}
+	modTime := time.Unix(sourceDateEpoch, 0).UTC()
+
+	files := append([]string{}, config.Files...)
+	for _, file := range defaultArchiveFiles {
+		if fileExists(file) && !contains(files, file) {
+			files = append(files, file)
+		}
+	}
+
+	archives := make([]string, 0, len(platforms))
+	for _, platform := range platforms {
+		archive, binary, err := releaseArchive(config, version.String(), platform)
+		if err != nil {
+			return err
+		}
+		if skipInDryRun(ctx, "Creating release archive", zap.String("path", archive)) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(archive), 0o755); err != nil {
+			return errors.WithStack(err)
+		}
+
+		// Files are stored in the directory named like the archive
+		archiveName := strings.TrimSuffix(filepath.Base(archive), archiveExt(platform))
+		entries := map[string]string{archiveName + "/" + exeName(archiveBinaryName(config), platform): binary}
+		for _, file := range files {
+			entries[archiveName+"/"+filepath.ToSlash(file)] = file
+		}
+
+		if platform.OS == "windows" {
+			err = writeZipArchive(archive, entries, modTime)
+		} else {
+			err = writeTarGzArchive(archive, entries, modTime)
+		}
+		if err != nil {
+			return err
+		}
+		logger.Get(ctx).Info("Release archive created", zap.String("path", archive))
+		archives = append(archives, archive)
+	}
+
+	if config.ChecksumFile == "" || skipInDryRun(ctx, "Writing checksums", zap.String("path", config.ChecksumFile)) {
+		return nil
+	}
+	return WriteChecksums(config.ChecksumFile, archives...)
+}
+
+// releaseArchive returns the path of the archive for the platform and the path of the binary stored in it
+func releaseArchive(config ArchiveConfig, version string, platform Platform) (string, string, error) {
+	if config.NameTemplate == "" {
+		config.NameTemplate = DefaultArchiveNameTemplate
+	}
+	if config.Build.NameTemplate == "" {
+		config.Build.NameTemplate = DefaultNameTemplate
+	}
+	tmpl, err := template.New("name").Parse(config.NameTemplate)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "invalid archive name template '%s'", config.NameTemplate)
+	}
+
+	buildConfig := config.Build
+	buildConfig.Platform = platform
+	binary, err := outputBinary(buildConfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, struct {
+		Name    string
+		Version string
+		GOOS    string
+		GOARCH  string
+	}{
+		Name:    archiveBinaryName(config),
+		Version: version,
+		GOOS:    platform.OS,
+		GOARCH:  platform.Arch,
+	}); err != nil {
+		return "", "", errors.Wrapf(err, "executing archive name template '%s' failed", config.NameTemplate)
+	}
+
+	dir := config.Dir
+	if dir == "" {
+		dir = filepath.Dir(binary)
+	}
+	return filepath.Join(dir, buf.String()+archiveExt(platform)), binary, nil
+}
+
+// archiveBinaryName returns the name of the binary stored in the archive, without extension
+func archiveBinaryName(config ArchiveConfig) string {
+	return strings.TrimSuffix(filepath.Base(config.Build.Binary), filepath.Ext(config.Build.Binary))
+}
+
+// writeTarGzArchive stores files in the tar.gz archive, entries map paths inside the archive to source files
+func writeTarGzArchive(archive string, entries map[string]string, modTime time.Time) error {
+	f, err := os.OpenFile(archive, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, path := range sortedKeys(entries) {
+		info, err := os.Stat(entries[path])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path,
+			Mode:     int64(archiveFileMode(info)),
+			Size:     info.Size(),
+			ModTime:  modTime,
+			Format:   tar.FormatPAX,
+		}); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := copyFileTo(tw, entries[path]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := gw.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(f.Close())
+}
+
+// writeZipArchive stores files in the zip archive, entries map paths inside the archive to source files
+func writeZipArchive(archive string, entries map[string]string, modTime time.Time) error {
+	f, err := os.OpenFile(archive, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, path := range sortedKeys(entries) {
+		info, err := os.Stat(entries[path])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		header := &zip.FileHeader{
+			Name:     path,
+			Method:   zip.Deflate,
+			Modified: modTime,
+		}
+		header.SetMode(archiveFileMode(info))
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := copyFileTo(w, entries[path]); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(f.Close())
+}
+
+// archiveFileMode returns normalized mode of the file, so it does not depend on umask
+func archiveFileMode(info os.FileInfo) os.FileMode {
+	if info.Mode()&0o111 != 0 {
+		return 0o755
+	}
+	return 0o644
+}
+
+func copyFileTo(w io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return errors.WithStack(err)
+}
@@ -0,0 +1,167 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// benchSubDir is the directory, relative to the repository root, where benchmark results are stored
+const benchSubDir = "bin/.bench"
+
+// BenchConfig is the configuration of benchmarks
+type BenchConfig struct {
+	// Tags is the list of build tags
+	Tags []string
+
+	// Bench is the regular expression selecting benchmarks to run, all benchmarks are run if empty
+	Bench string
+
+	// Count is the number of times each benchmark is run, 10 is used if 0
+	Count int
+
+	// Baseline is the git revision results are compared to. Results for the baseline must have been stored
+	// by running benchmarks on that revision before.
+	Baseline string
+
+	// MaxRegression is the maximum accepted percentage of statistically significant regression
+	MaxRegression float64
+}
+
+// GoBench runs benchmarks in all modules, stores results for the current commit
+// and compares them against the baseline
+func GoBench(ctx context.Context, deps build.DepsFunc, config BenchConfig) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+
+	commit, err := gitOutput(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	resultFile := filepath.Join(benchSubDir, commit)
+	results := &bytes.Buffer{}
+
+	bench := config.Bench
+	if bench == "" {
+		bench = "."
+	}
+	count := config.Count
+	if count == 0 {
+		count = 10
+	}
+
+	err = onModule(ctx, func(path string) error {
+		args := []string{
+			"test",
+			"-run=^$",
+			"-bench=" + bench,
+			"-benchmem",
+			"-count=" + strconv.Itoa(count),
+		}
+		if len(config.Tags) > 0 {
+			args = append(args, "-tags", strings.Join(config.Tags, ","))
+		}
+
+		log.Info("Running benchmarks", zap.String("path", path))
+		cmd := exec.Command("go", append(args, "./...")...)
+		cmd.Dir = path
+		cmd.Stdout = io.MultiWriter(os.Stdout, results)
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "benchmarks failed in module '%s'", path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if skipInDryRun(ctx, "Storing benchmark results", zap.String("path", resultFile)) {
+		return nil
+	}
+	if err := os.MkdirAll(benchSubDir, 0o700); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.WriteFile(resultFile, results.Bytes(), 0o600); err != nil {
+		return errors.WithStack(err)
+	}
+	log.Info("Benchmark results stored", zap.String("path", resultFile))
+
+	if config.Baseline == "" {
+		return nil
+	}
+
+	baselineCommit, err := gitOutput(ctx, "rev-parse", config.Baseline)
+	if err != nil {
+		return err
+	}
+	baselineFile := filepath.Join(benchSubDir, baselineCommit)
+	if _, err := os.Stat(baselineFile); err != nil {
+		return errors.Wrapf(err, "benchmark results for baseline '%s' do not exist", config.Baseline)
+	}
+	return compareBenchmarks(ctx, deps, baselineFile, resultFile, config.MaxRegression)
+}
+
+func compareBenchmarks(ctx context.Context, deps build.DepsFunc, baselineFile, resultFile string,
+	maxRegression float64,
+) error {
+	deps(EnsureBenchstat)
+
+	if err := execCmds(ctx, exec.Command("benchstat", baselineFile, resultFile)); err != nil {
+		return errors.Wrap(err, "comparing benchmarks failed")
+	}
+
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("benchstat", "-format", "csv", baselineFile, resultFile)
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return errors.Wrap(err, "comparing benchmarks failed")
+	}
+
+	reader := csv.NewReader(buf)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return errors.Wrap(err, "parsing benchstat output failed")
+	}
+
+	log := logger.Get(ctx)
+	var unit string
+	var regressions int
+	for _, record := range records {
+		// Header of the table: ,sec/op,CI,sec/op,CI,vs base,P
+		if len(record) >= 6 && record[0] == "" && record[5] == "vs base" {
+			unit = record[1]
+			continue
+		}
+		if len(record) < 6 || record[0] == "geomean" || !strings.HasSuffix(record[5], "%") {
+			continue
+		}
+		delta, err := strconv.ParseFloat(strings.TrimSuffix(record[5], "%"), 64)
+		if err != nil {
+			continue
+		}
+		// For throughput units higher values are better
+		if strings.HasSuffix(unit, "/s") {
+			delta = -delta
+		}
+		if delta > maxRegression {
+			regressions++
+			log.Error("Benchmark regression detected", zap.String("benchmark", record[0]),
+				zap.String("unit", unit), zap.String("delta", record[5]))
+		}
+	}
+	if regressions > 0 {
+		return errors.Errorf("%d benchmark regressions exceed threshold %.1f%%", regressions, maxRegression)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/ridge/must"
+)
+
+// buildCacheSubDir is the directory, relative to the repository root, where hashes of build inputs are stored
+const buildCacheSubDir = "bin/.cache/build"
+
+// buildInputsHash computes the hash of inputs affecting the build: build configuration, go version,
+// version information stamped into the binary, environment of the build, go.mod and go.sum files and sources
+// of the packages the built one depends on. Only packages belonging to the main module or to modules replaced
+// by local directories are taken into account, other ones are pinned by go.sum. Paths inside the repository
+// are relative, so the hash doesn't depend on its location.
+func buildInputsHash(ctx context.Context, config BuildConfig) (string, error) {
+	goVersion, err := goEnv(ctx, "GOVERSION")
+	if err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	hashedConfig := config
+	hashedConfig.Binary = repoRelativePath(config.Binary)
+	fmt.Fprintf(hasher, "%s\n%#v\n", goVersion, hashedConfig)
+
+	if config.VersionPackage != "" {
+		info, err := GitVersionInfo(ctx)
+		if err != nil {
+			return "", err
+		}
+		// Build date changes on every build, reproducible builds take it from the commit
+		info.BuildDate = ""
+		fmt.Fprintf(hasher, "%#v\n", info)
+	}
+	for _, v := range buildEnv(config) {
+		fmt.Fprintf(hasher, "%s\n", v)
+	}
+
+	files, err := buildSourceFiles(ctx, config)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if err := hashFile(hasher, repoRelativePath(file)); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// buildEnvVars are the environment variables affecting the output of go build, in addition to the CGO_* ones
+var buildEnvVars = []string{
+	"GOFLAGS", "GOOS", "GOARCH", "GOEXPERIMENT", "GOAMD64", "GOARM", "GOARM64", "GO386", "GOMIPS", "GOMIPS64",
+	"GOPPC64", "GORISCV64", "GOWASM", "CC", "CXX", "AR", "PKG_CONFIG", "SOURCE_DATE_EPOCH",
+}
+
+// buildEnv returns sorted environment variables affecting the build, including C toolchain of the platform
+func buildEnv(config BuildConfig) []string {
+	env := os.Environ()
+	if config.CGOEnabled {
+		env = append(env, cToolchainEnv(config.Platform)...)
+	}
+	vars := envMap(env)
+
+	var result []string
+	for _, name := range sortedKeys(vars) {
+		if strings.HasPrefix(name, "CGO_") || contains(buildEnvVars, name) {
+			result = append(result, name+"="+vars[name])
+		}
+	}
+	return result
+}
+
+// repoRelativePath returns the path relative to the repository root if file is inside the repository,
+// otherwise it is returned unchanged
+func repoRelativePath(file string) string {
+	if file == "" {
+		return ""
+	}
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return file
+	}
+	relPath, err := filepath.Rel(must.String(filepath.Abs(".")), absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return file
+	}
+	return relPath
+}
+
+// goListPackage is the package reported by `go list -json`
+type goListPackage struct {
+	Dir        string
+	Standard   bool
+	GoFiles    []string
+	CgoFiles   []string
+	CFiles     []string
+	CXXFiles   []string
+	HFiles     []string
+	SFiles     []string
+	SysoFiles  []string
+	EmbedFiles []string
+	Module     *struct {
+		Main    bool
+		GoMod   string
+		Replace *struct {
+			Version string
+		}
+	}
+}
+
+// buildSourceFiles returns sorted list of local files the package is built from, including go.mod and go.sum
+// files of the modules they belong to
+func buildSourceFiles(ctx context.Context, config BuildConfig) ([]string, error) {
+	args := []string{"list", "-deps", "-json"}
+	if len(config.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(config.Tags, ","))
+	}
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", append(args, ".")...)
+	cmd.Dir = config.Package
+	cmd.Stdout = buf
+	cmd.Env = os.Environ()
+	if config.CGOEnabled {
+		cmd.Env = append(cmd.Env, "CGO_ENABLED=1")
+	} else {
+		cmd.Env = append(cmd.Env, "CGO_ENABLED=0")
+	}
+	if config.Platform.OS != "" {
+		cmd.Env = append(cmd.Env, "GOOS="+config.Platform.OS)
+	}
+	if config.Platform.Arch != "" {
+		cmd.Env = append(cmd.Env, "GOARCH="+config.Platform.Arch)
+	}
+	if err := execCmds(ctx, cmd); err != nil {
+		return nil, errors.Wrapf(err, "listing dependencies of package '%s' failed", config.Package)
+	}
+
+	files := map[string]bool{}
+	decoder := json.NewDecoder(buf)
+	for {
+		var pkg goListPackage
+		if err := decoder.Decode(&pkg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, errors.WithStack(err)
+		}
+		if pkg.Standard || pkg.Module == nil {
+			continue
+		}
+		// Replacement having no version is a local directory
+		if !pkg.Module.Main && (pkg.Module.Replace == nil || pkg.Module.Replace.Version != "") {
+			continue
+		}
+
+		for _, list := range [][]string{pkg.GoFiles, pkg.CgoFiles, pkg.CFiles, pkg.CXXFiles, pkg.HFiles, pkg.SFiles,
+			pkg.SysoFiles, pkg.EmbedFiles} {
+			for _, file := range list {
+				files[filepath.Join(pkg.Dir, file)] = true
+			}
+		}
+		if pkg.Module.GoMod != "" {
+			files[pkg.Module.GoMod] = true
+			goSum := filepath.Join(filepath.Dir(pkg.Module.GoMod), "go.sum")
+			if fileExists(goSum) {
+				files[goSum] = true
+			}
+		}
+	}
+	return sortedKeys(files), nil
+}
+
+func hashFile(hasher io.Writer, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	fmt.Fprintf(hasher, "%s\n", file)
+	_, err = io.Copy(hasher, f)
+	return errors.WithStack(err)
+}
+
+// isBuildUpToDate returns true if binary exists and was built from inputs having the same hash
+func isBuildUpToDate(binary, inputsHash string) (bool, error) {
+	if _, err := os.Stat(binary); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+	storedHash, err := os.ReadFile(buildHashFile(binary))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+	return string(storedHash) == inputsHash, nil
+}
+
+func storeBuildHash(binary, inputsHash string) error {
+	hashFile := buildHashFile(binary)
+	if err := os.MkdirAll(filepath.Dir(hashFile), 0o700); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(hashFile, []byte(inputsHash), 0o600))
+}
+
+func buildHashFile(binary string) string {
+	return filepath.Join(buildCacheSubDir, fmt.Sprintf("%x", sha256.Sum256([]byte(must.String(filepath.Abs(binary))))))
+}
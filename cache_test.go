@@ -0,0 +1,89 @@
+package buildgo
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/outofforest/logger"
+	"go.uber.org/zap"
+)
+
+func TestBuildInputsHashChangesWithCommit(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	for _, v := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(v, "test")
+	}
+	for _, v := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(v, "test@example.com")
+	}
+
+	writeFile(t, "go.mod", "module example.com/app\n\ngo 1.19\n")
+	writeFile(t, "main.go", "package main\n\nfunc main() {}\n")
+	writeFile(t, "README.md", "app\n")
+	git(t, "init", "-q")
+	git(t, "add", "-A")
+	git(t, "commit", "-q", "-m", "initial")
+
+	ctx := logger.WithLogger(context.Background(), zap.NewNop())
+	config := BuildConfig{
+		Package:        ".",
+		Binary:         filepath.Join(dir, "bin", "app"),
+		VersionPackage: "main",
+	}
+	hash1, err := buildInputsHash(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sources of the binary are not modified, only the commit stamped into it changes
+	writeFile(t, "README.md", "app, second version\n")
+	git(t, "commit", "-q", "-am", "second")
+
+	hash2, err := buildInputsHash(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash1 == hash2 {
+		t.Fatal("hash of build inputs does not change when commit changes")
+	}
+
+	config.VersionPackage = ""
+	hash3, err := buildInputsHash(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	git(t, "commit", "-q", "--allow-empty", "-m", "third")
+	hash4, err := buildInputsHash(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash3 != hash4 {
+		t.Fatal("hash of build inputs changes when version is not stamped into the binary")
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+}
+
+func git(t *testing.T, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %s: %s", args, err, output)
+	}
+}
@@ -0,0 +1,362 @@
+package buildgo
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"github.com/ridge/must"
+	"go.uber.org/zap"
+)
+
+const (
+	// cacheProgCommand is the command go runs to access the compiler cache, see GoCacheProg
+	cacheProgCommand = "dev/cacheprog"
+
+	// compilerCacheSubDir is the directory, relative to the repository root, where compiler cache is stored locally
+	compilerCacheSubDir = "bin/.cache/gocache"
+
+	// cacheProgUploads is the maximum number of objects uploaded to the remote cache concurrently
+	cacheProgUploads = 8
+)
+
+// cacheProgRegistered is set by AddCommands, GOCACHEPROG is set only if go is able to run the command
+var cacheProgRegistered bool
+
+// Commands of the GOCACHEPROG protocol, see https://pkg.go.dev/cmd/go/internal/cacheprog
+const (
+	cacheProgGet   = "get"
+	cacheProgPut   = "put"
+	cacheProgClose = "close"
+)
+
+// cacheProgRequest is the request sent by go to the cache program
+type cacheProgRequest struct {
+	ID       int64
+	Command  string
+	ActionID []byte `json:",omitempty"`
+	OutputID []byte `json:",omitempty"`
+	ObjectID []byte `json:",omitempty"`
+	BodySize int64  `json:",omitempty"`
+}
+
+// cacheProgResponse is the response sent by the cache program to go
+type cacheProgResponse struct {
+	ID            int64
+	Err           string     `json:",omitempty"`
+	KnownCommands []string   `json:",omitempty"`
+	Miss          bool       `json:",omitempty"`
+	OutputID      []byte     `json:",omitempty"`
+	Size          int64      `json:",omitempty"`
+	Time          *time.Time `json:",omitempty"`
+	DiskPath      string     `json:",omitempty"`
+}
+
+// cacheProgAction is the entry mapping action to its output
+type cacheProgAction struct {
+	OutputID string
+	Size     int64
+	Time     time.Time
+}
+
+// useCacheProg makes go commands use GoCacheProg as the compiler cache if BUILDGO_COMPILER_CACHE environment
+// variable is set. It contains the location of the shared cache in the format accepted by BUILDGO_REMOTE_CACHE.
+// GOCACHEPROG is supported by go 1.24 and newer.
+func useCacheProg(ctx context.Context, goVersion string) error {
+	if os.Getenv("BUILDGO_COMPILER_CACHE") == "" {
+		return nil
+	}
+	log := logger.Get(ctx)
+	if !cacheProgRegistered {
+		log.Warn("Compiler cache is disabled because buildgo commands are not added to the builder")
+		return nil
+	}
+	if !goVersionAtLeast(goVersion, 1, 24) {
+		log.Warn("Compiler cache is disabled because it requires go 1.24 or newer", zap.String("go", goVersion))
+		return nil
+	}
+	if _, err := remoteCacheAt("BUILDGO_COMPILER_CACHE"); err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if strings.Contains(executable, " ") {
+		executable = "'" + executable + "'"
+	}
+	return errors.WithStack(os.Setenv("GOCACHEPROG", executable+" "+cacheProgCommand))
+}
+
+// goVersionAtLeast returns true if go version, e.g. 1.24.2 or 1.25rc1, is not older than major.minor
+func goVersionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(strings.TrimPrefix(version, "go"), ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	versionMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	versionMinor, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool {
+		return r < '0' || r > '9'
+	}))
+	if err != nil {
+		return false
+	}
+	return versionMajor > major || (versionMajor == major && versionMinor >= minor)
+}
+
+// GoCacheProg serves the compiler cache to go using GOCACHEPROG protocol on stdin and stdout.
+// Outputs are stored locally and in the shared cache set in BUILDGO_COMPILER_CACHE environment variable,
+// so they are reused by other machines. Go runs it automatically once EnsureGo enables the compiler cache.
+func GoCacheProg(ctx context.Context) error {
+	rc, err := remoteCacheAt("BUILDGO_COMPILER_CACHE")
+	if err != nil {
+		return err
+	}
+	cp := &cacheProg{
+		rc:      rc,
+		dir:     must.String(filepath.Abs(compilerCacheSubDir)),
+		out:     bufio.NewWriter(os.Stdout),
+		uploads: make(chan struct{}, cacheProgUploads),
+	}
+	if err := os.MkdirAll(cp.dir, 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	defer cp.wg.Wait()
+
+	if err := cp.respond(cacheProgResponse{
+		KnownCommands: []string{cacheProgGet, cacheProgPut, cacheProgClose},
+	}); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(os.Stdin))
+	for {
+		var req cacheProgRequest
+		if err := decoder.Decode(&req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return errors.WithStack(err)
+		}
+		if len(req.OutputID) == 0 {
+			req.OutputID = req.ObjectID
+		}
+
+		switch req.Command {
+		case cacheProgGet:
+			cp.wg.Add(1)
+			go func() {
+				defer cp.wg.Done()
+				cp.respondOrFail(ctx, cp.get(ctx, req))
+			}()
+		case cacheProgPut:
+			// Body is sent as base64-encoded JSON string following the request
+			var body []byte
+			if req.BodySize > 0 {
+				if err := decoder.Decode(&body); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			cp.respondOrFail(ctx, cp.put(ctx, req, body))
+		case cacheProgClose:
+			cp.wg.Wait()
+			return cp.respond(cacheProgResponse{ID: req.ID})
+		default:
+			cp.respondOrFail(ctx, cacheProgResponse{ID: req.ID, Err: "unknown command " + req.Command})
+		}
+	}
+}
+
+// cacheProg is the state of the compiler cache served by GoCacheProg
+type cacheProg struct {
+	rc      *remoteCache
+	dir     string
+	uploads chan struct{}
+	wg      sync.WaitGroup
+
+	mu  sync.Mutex
+	out *bufio.Writer
+}
+
+func (cp *cacheProg) respond(resp cacheProgResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if _, err := cp.out.Write(append(data, '\n')); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(cp.out.Flush())
+}
+
+func (cp *cacheProg) respondOrFail(ctx context.Context, resp cacheProgResponse) {
+	if err := cp.respond(resp); err != nil {
+		// Go stops the build if cache program breaks the protocol
+		logger.Get(ctx).Error("Responding to go failed", zap.Error(err))
+	}
+}
+
+// get returns the output of the action, it is downloaded from the remote cache if it does not exist locally
+func (cp *cacheProg) get(ctx context.Context, req cacheProgRequest) cacheProgResponse {
+	actionName := "a-" + hex.EncodeToString(req.ActionID)
+	action, exists, err := cp.readAction(ctx, actionName)
+	if err != nil {
+		return cacheProgResponse{ID: req.ID, Err: err.Error()}
+	}
+	if !exists {
+		return cacheProgResponse{ID: req.ID, Miss: true}
+	}
+
+	outputName := "o-" + action.OutputID
+	if !cp.fetch(ctx, outputName) {
+		return cacheProgResponse{ID: req.ID, Miss: true}
+	}
+	outputID, err := hex.DecodeString(action.OutputID)
+	if err != nil {
+		return cacheProgResponse{ID: req.ID, Miss: true}
+	}
+	return cacheProgResponse{
+		ID:       req.ID,
+		OutputID: outputID,
+		Size:     action.Size,
+		Time:     &action.Time,
+		DiskPath: filepath.Join(cp.dir, outputName),
+	}
+}
+
+// put stores the output of the action locally and uploads it to the remote cache in the background
+func (cp *cacheProg) put(ctx context.Context, req cacheProgRequest, body []byte) cacheProgResponse {
+	if int64(len(body)) != req.BodySize {
+		return cacheProgResponse{ID: req.ID, Err: fmt.Sprintf("expected body of %d bytes, got %d", req.BodySize,
+			len(body))}
+	}
+
+	actionName := "a-" + hex.EncodeToString(req.ActionID)
+	outputName := "o-" + hex.EncodeToString(req.OutputID)
+	action, err := json.Marshal(cacheProgAction{
+		OutputID: hex.EncodeToString(req.OutputID),
+		Size:     req.BodySize,
+		Time:     time.Now(),
+	})
+	if err != nil {
+		return cacheProgResponse{ID: req.ID, Err: err.Error()}
+	}
+
+	outputPath := filepath.Join(cp.dir, outputName)
+	if !fileExists(outputPath) {
+		if err := writeFileAtomic(outputPath, body); err != nil {
+			return cacheProgResponse{ID: req.ID, Err: err.Error()}
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(cp.dir, actionName), action); err != nil {
+		return cacheProgResponse{ID: req.ID, Err: err.Error()}
+	}
+
+	if cp.rc != nil && !cp.rc.readOnly {
+		cp.wg.Add(1)
+		go func() {
+			defer cp.wg.Done()
+
+			cp.uploads <- struct{}{}
+			defer func() {
+				<-cp.uploads
+			}()
+
+			// Output is uploaded first, so action found in the remote cache always points to the existing one
+			for _, name := range []string{outputName, actionName} {
+				if err := cp.rc.upload(ctx, name, filepath.Join(cp.dir, name)); err != nil {
+					logger.Get(ctx).Warn("Uploading compiler cache object failed", zap.String("object", name),
+						zap.Error(err))
+					return
+				}
+			}
+		}()
+	}
+	return cacheProgResponse{ID: req.ID, DiskPath: outputPath}
+}
+
+// readAction reads the entry of the action, false is returned if it does not exist
+func (cp *cacheProg) readAction(ctx context.Context, name string) (cacheProgAction, bool, error) {
+	if !cp.fetch(ctx, name) {
+		return cacheProgAction{}, false, nil
+	}
+	data, err := os.ReadFile(filepath.Join(cp.dir, name))
+	if err != nil {
+		return cacheProgAction{}, false, errors.WithStack(err)
+	}
+	var action cacheProgAction
+	if err := json.Unmarshal(data, &action); err != nil {
+		// Broken entry is treated as missing, go stores it again
+		return cacheProgAction{}, false, nil
+	}
+	return action, true, nil
+}
+
+// fetch ensures that the object exists locally, downloading it from the remote cache if needed.
+// Errors of the remote cache are logged and the object is reported as missing.
+func (cp *cacheProg) fetch(ctx context.Context, name string) bool {
+	path := filepath.Join(cp.dir, name)
+	if fileExists(path) {
+		return true
+	}
+	if cp.rc == nil {
+		return false
+	}
+
+	tmpFile := filepath.Join(cp.dir, ".download-"+name+"-"+randomHex(8))
+	defer os.Remove(tmpFile)
+
+	exists, err := cp.rc.download(ctx, name, tmpFile)
+	if err != nil {
+		logger.Get(ctx).Warn("Downloading compiler cache object failed", zap.String("object", name), zap.Error(err))
+		return false
+	}
+	if !exists {
+		return false
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		logger.Get(ctx).Warn("Storing compiler cache object failed", zap.String("object", name), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// writeFileAtomic writes the file, so concurrent go processes never see partially written one
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(f.Name(), path))
+}
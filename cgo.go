@@ -0,0 +1,71 @@
+package buildgo
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// CToolchain defines C toolchain used by CGO
+type CToolchain struct {
+	// CC is the C compiler
+	CC string
+
+	// CXX is the C++ compiler
+	CXX string
+
+	// CFlags is the list of flags passed to C compiler
+	CFlags []string
+
+	// CXXFlags is the list of flags passed to C++ compiler
+	CXXFlags []string
+
+	// LDFlags is the list of flags passed to linker
+	LDFlags []string
+}
+
+var (
+	toolchainsMu sync.RWMutex
+	toolchains   = map[Platform]CToolchain{}
+)
+
+// RegisterCToolchain registers C toolchain used by CGO when building for the platform
+func RegisterCToolchain(platform Platform, toolchain CToolchain) {
+	toolchainsMu.Lock()
+	defer toolchainsMu.Unlock()
+
+	toolchains[platform] = toolchain
+}
+
+// cToolchainEnv returns environment variables configuring C toolchain registered for the platform
+func cToolchainEnv(platform Platform) []string {
+	if platform == (Platform{}) {
+		platform = Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	}
+
+	toolchainsMu.RLock()
+	defer toolchainsMu.RUnlock()
+
+	toolchain, exists := toolchains[platform]
+	if !exists {
+		return nil
+	}
+
+	var env []string
+	if toolchain.CC != "" {
+		env = append(env, "CC="+toolchain.CC)
+	}
+	if toolchain.CXX != "" {
+		env = append(env, "CXX="+toolchain.CXX)
+	}
+	if len(toolchain.CFlags) > 0 {
+		env = append(env, "CGO_CFLAGS="+strings.Join(toolchain.CFlags, " "))
+	}
+	if len(toolchain.CXXFlags) > 0 {
+		env = append(env, "CGO_CXXFLAGS="+strings.Join(toolchain.CXXFlags, " "))
+	}
+	if len(toolchain.LDFlags) > 0 {
+		env = append(env, "CGO_LDFLAGS="+strings.Join(toolchain.LDFlags, " "))
+	}
+	return env
+}
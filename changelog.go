@@ -0,0 +1,178 @@
+package buildgo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ChangelogFile is the default path of the changelog
+const ChangelogFile = "CHANGELOG.md"
+
+// Sections of the changelog
+const (
+	ChangelogAdded   = "Added"
+	ChangelogFixed   = "Fixed"
+	ChangelogChanged = "Changed"
+)
+
+// changelogTypes maps types of conventional commits to sections of the changelog,
+// commits of other known types are not included in the changelog
+var changelogTypes = map[string]string{
+	"feat":     ChangelogAdded,
+	"fix":      ChangelogFixed,
+	"perf":     ChangelogChanged,
+	"refactor": ChangelogChanged,
+	"revert":   ChangelogChanged,
+	"build":    "",
+	"chore":    "",
+	"ci":       "",
+	"docs":     "",
+	"style":    "",
+	"test":     "",
+}
+
+var conventionalCommitRegexp = regexp.MustCompile(`^([a-z]+)(?:\(([^()]+)\))?(!)?: (\S.*)$`)
+
+// ChangelogConfig is the configuration of changelog generation
+type ChangelogConfig struct {
+	// File is the path of the changelog, ChangelogFile is used if empty
+	File string
+
+	// Version is the title of the generated section, "Unreleased" is used if empty.
+	// If section with the same title exists, it is replaced.
+	Version string
+
+	// Strict fails if any commit message does not follow conventional commits format
+	Strict bool
+}
+
+// GitChangelog generates changelog section from conventional commits made since the latest version tag
+// and stores it at the top of the changelog
+func GitChangelog(ctx context.Context, config ChangelogConfig) error {
+	log := logger.Get(ctx)
+	if config.File == "" {
+		config.File = ChangelogFile
+	}
+	title := config.Version
+	if title == "" {
+		title = "Unreleased"
+	} else {
+		title += " - " + time.Now().UTC().Format("2006-01-02")
+	}
+
+	version, err := Version(ctx)
+	if err != nil {
+		return err
+	}
+	revisions := "HEAD"
+	if version.Tag != "" {
+		revisions = version.Tag + "..HEAD"
+	}
+	commits, err := gitOutput(ctx, "log", "--no-merges", "--format=%h %s", revisions)
+	if err != nil {
+		return err
+	}
+
+	entries := map[string][]string{}
+	var malformed []string
+	for _, commit := range strings.Split(commits, "\n") {
+		hash, subject, ok := strings.Cut(commit, " ")
+		if !ok {
+			continue
+		}
+		match := conventionalCommitRegexp.FindStringSubmatch(subject)
+		var section string
+		var known bool
+		if match != nil {
+			section, known = changelogTypes[match[1]]
+		}
+		if !known {
+			malformed = append(malformed, "  "+hash+" "+subject)
+			continue
+		}
+		if section == "" {
+			continue
+		}
+
+		entry := match[4]
+		if match[2] != "" {
+			entry = "**" + match[2] + "**: " + entry
+		}
+		if match[3] != "" {
+			entry = "**BREAKING** " + entry
+		}
+		entries[section] = append(entries[section], fmt.Sprintf("- %s (%s)", entry, hash))
+	}
+	if len(malformed) > 0 {
+		if config.Strict {
+			return errors.Errorf("commit messages don't follow conventional commits format:\n%s",
+				strings.Join(malformed, "\n"))
+		}
+		log.Warn("Commits not following conventional commits format are skipped", zap.Int("count", len(malformed)))
+	}
+
+	section := &strings.Builder{}
+	fmt.Fprintf(section, "## %s\n", title)
+	for _, name := range []string{ChangelogAdded, ChangelogChanged, ChangelogFixed} {
+		if len(entries[name]) == 0 {
+			continue
+		}
+		fmt.Fprintf(section, "\n### %s\n\n%s\n", name, strings.Join(entries[name], "\n"))
+	}
+
+	content, err := os.ReadFile(config.File)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	log.Info("Updating changelog", zap.String("path", config.File), zap.String("section", title),
+		zap.String("since", version.Tag))
+	if dryRun() {
+		return nil
+	}
+	return errors.WithStack(os.WriteFile(config.File, []byte(insertChangelogSection(string(content), title,
+		section.String())), 0o644))
+}
+
+// insertChangelogSection puts section at the top of the changelog replacing the existing one having
+// the same title
+func insertChangelogSection(changelog, title, section string) string {
+	if changelog == "" {
+		changelog = "# Changelog\n"
+	}
+
+	// Title of the released section contains the date, so only version is compared
+	name, _, _ := strings.Cut(title, " - ")
+	lines := strings.Split(changelog, "\n")
+	start, end := -1, len(lines)
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "## ") {
+			continue
+		}
+		if start >= 0 {
+			end = i
+			break
+		}
+		if existing, _, _ := strings.Cut(strings.TrimPrefix(line, "## "), " - "); existing == name {
+			start = i
+		} else {
+			start, end = i, i
+			break
+		}
+	}
+
+	if start < 0 {
+		return strings.TrimRight(changelog, "\n") + "\n\n" + section
+	}
+	result := append([]string{}, lines[:start]...)
+	result = append(result, strings.Split(section, "\n")...)
+	return strings.Join(append(result, lines[end:]...), "\n")
+}
@@ -0,0 +1,58 @@
+package buildgo
+
+import "testing"
+
+func TestInsertChangelogSection(t *testing.T) {
+	tests := []struct {
+		name      string
+		changelog string
+		title     string
+		section   string
+		expected  string
+	}{
+		{
+			name:     "new changelog",
+			title:    "Unreleased",
+			section:  "## Unreleased\n\n### Added\n\n- a\n",
+			expected: "# Changelog\n\n## Unreleased\n\n### Added\n\n- a\n",
+		},
+		{
+			name:      "changelog without sections",
+			changelog: "# Changelog\n\nAll notable changes.\n\n\n",
+			title:     "Unreleased",
+			section:   "## Unreleased\n\n- a\n",
+			expected:  "# Changelog\n\nAll notable changes.\n\n## Unreleased\n\n- a\n",
+		},
+		{
+			name:      "section added above released one",
+			changelog: "# Changelog\n\n## v1.0.0 - 2024-01-01\n\n- a\n",
+			title:     "v1.1.0 - 2024-02-01",
+			section:   "## v1.1.0 - 2024-02-01\n\n- b\n",
+			expected:  "# Changelog\n\n## v1.1.0 - 2024-02-01\n\n- b\n\n## v1.0.0 - 2024-01-01\n\n- a\n",
+		},
+		{
+			name:      "unreleased section replaced",
+			changelog: "# Changelog\n\n## Unreleased\n\n- old\n\n## v1.0.0 - 2024-01-01\n\n- a\n",
+			title:     "Unreleased",
+			section:   "## Unreleased\n\n- new\n",
+			expected:  "# Changelog\n\n## Unreleased\n\n- new\n\n## v1.0.0 - 2024-01-01\n\n- a\n",
+		},
+		{
+			name:      "section of the same version released on another date replaced",
+			changelog: "# Changelog\n\n## v1.1.0 - 2024-02-01\n\n- old\n",
+			title:     "v1.1.0 - 2024-02-02",
+			section:   "## v1.1.0 - 2024-02-02\n\n- new\n",
+			expected:  "# Changelog\n\n## v1.1.0 - 2024-02-02\n\n- new\n",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			result := insertChangelogSection(test.changelog, test.title, test.section)
+			if result != test.expected {
+				t.Fatalf("unexpected changelog:\n%s", result)
+			}
+		})
+	}
+}
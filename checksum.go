@@ -0,0 +1,48 @@
+package buildgo
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChecksumsFile is the default name of the file containing checksums of artifacts
+const ChecksumsFile = "SHA256SUMS"
+
+// WriteChecksums writes SHA256 checksums of files to the checksum file in the format produced by sha256sum.
+// Files are referenced by their paths relative to the directory of the checksum file.
+func WriteChecksums(checksumFile string, files ...string) error {
+	dir := filepath.Dir(checksumFile)
+	content := &strings.Builder{}
+	for _, file := range files {
+		checksum, err := fileChecksum(file)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(content, "%s  %s\n", checksum, filepath.ToSlash(relPath))
+	}
+	return errors.WithStack(os.WriteFile(checksumFile, []byte(content.String()), 0o644))
+}
+
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
@@ -8,11 +8,114 @@ import (
 
 // AddCommands adds go and git commands
 func AddCommands(commands map[string]build.Command) {
+	existing := map[string]bool{}
+	for name := range commands {
+		existing[name] = true
+	}
+
 	commands["build/me"] = build.Command{Fn: rebuildMe, Description: "Rebuilds the building tool"}
+	commands["tools/versions"] = build.Command{Fn: ToolsVersions, Description: "Prints versions of the tools"}
+	commands["tools/clean"] = build.Command{Fn: func(ctx context.Context) error {
+		return ToolsClean(ctx, ToolsCleanConfig{})
+	}, Description: "Removes tools which haven't been used recently"}
 	commands["git/fetch"] = build.Command{Fn: GitFetch, Description: "Fetches changes from repository"}
+	commands["git/changelog"] = build.Command{Fn: func(ctx context.Context) error {
+		return GitChangelog(ctx, ChangelogConfig{})
+	}, Description: "Adds unreleased changes to the changelog"}
+	commands["git/hooks"] = build.Command{Fn: func(ctx context.Context) error {
+		return GitHooks(ctx, DefaultGitHooksConfig)
+	}, Description: "Installs git hooks running lint and tests"}
+	commands["release/tag"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GitReleaseTag(ctx, deps, ReleaseTagConfig{})
+	}, Description: "Tags and pushes the next version"}
 	commands["dev/lint"] = build.Command{Fn: GoLint, Description: "Lints go code"}
+	commands["dev/lint/init"] = build.Command{Fn: GoLintInitConfig, Description: "Stores default linter configuration"}
+	commands["dev/lint/fix"] = build.Command{Fn: GoLintFix, Description: "Lints go code and applies fixes"}
+	commands["dev/vulncheck"] = build.Command{Fn: GoVulncheck, Description: "Scans go modules for vulnerabilities"}
+	commands["dev/format"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoFormat(ctx, deps, FormatConfig{})
+	}, Description: "Checks that go code is formatted"}
+	commands["dev/format/fix"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoFormatFix(ctx, deps, FormatConfig{})
+	}, Description: "Formats go code"}
+	commands["dev/license"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoLicenseHeader(ctx, deps, LicenseHeaderConfig{})
+	}, Description: "Verifies license headers in go files"}
+	commands["dev/license/fix"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoLicenseHeaderFix(ctx, deps, LicenseHeaderConfig{})
+	}, Description: "Inserts missing license headers into go files"}
+	commands["dev/licenses"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoLicenses(ctx, deps, LicenseConfig{Report: ThirdPartyLicensesReport})
+	}, Description: "Verifies licenses of dependencies"}
+	commands["dev/proto"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoProtoGenerate(ctx, deps, ProtoConfig{})
+	}, Description: "Generates go code from proto files"}
+	commands["dev/proto/check"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoProtoGenerate(ctx, deps, ProtoConfig{Check: true})
+	}, Description: "Verifies that code generated from proto files is up to date"}
+	commands["dev/generate"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoGenerate(ctx, deps, GenerateConfig{})
+	}, Description: "Runs go generate in all the modules"}
+	commands["dev/generate/check"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoGenerate(ctx, deps, GenerateConfig{Check: true})
+	}, Description: "Verifies that generated files are up to date"}
+	commands["dev/mocks"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoMocks(ctx, deps, MocksConfig{})
+	}, Description: "Generates mocks declared in the repository configuration"}
+	commands["dev/mocks/check"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoMocks(ctx, deps, MocksConfig{Check: true})
+	}, Description: "Verifies that mocks are up to date"}
 	commands["dev/tidy"] = build.Command{Fn: GoModTidy, Description: "Runs go mod tidy"}
+	commands["dev/vendor"] = build.Command{Fn: GoModVendor, Description: "Vendors dependencies of all the modules"}
+	commands["dev/vendor/check"] = build.Command{Fn: GoModVendorCheck,
+		Description: "Checks that vendor directories are consistent with go.mod"}
+	commands["dev/tidy/check"] = build.Command{Fn: GoModTidyCheck, Description: "Checks that go.mod and go.sum are tidy"}
+	commands["dev/work"] = build.Command{Fn: GoWorkUpdate, Description: "Updates go.work to use all the modules"}
+	commands["dev/deadcode"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoDeadcode(ctx, deps, DeadcodeConfig{})
+	}, Description: "Detects unreachable functions"}
+	commands["dev/deadcode/baseline"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoDeadcode(ctx, deps, DeadcodeConfig{UpdateBaseline: true})
+	}, Description: "Stores currently unreachable functions in the baseline"}
+	commands["dev/metrics"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoMetrics(ctx, deps, MetricsConfig{})
+	}, Description: "Computes complexity and length of functions"}
+	commands["dev/metrics/baseline"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoMetrics(ctx, deps, MetricsConfig{UpdateBaseline: true})
+	}, Description: "Stores functions currently exceeding metric limits in the baseline"}
+	commands["dev/apicompat"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoAPICompat(ctx, deps, APICompatConfig{})
+	}, Description: "Verifies API compatibility with the latest release"}
+	commands["dev/outdated"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoDepsOutdated(ctx, deps, OutdatedConfig{})
+	}, Description: "Reports outdated dependencies"}
+	commands["dev/secrets"] = build.Command{Fn: SecretsScan, Description: "Scans files for secrets and large files"}
+	commands["dev/replace"] = build.Command{Fn: GoModReplace, Description: "Fails on replace directives in go.mod"}
+	commands["dev/verify"] = build.Command{Fn: GoModVerify, Description: "Verifies go modules and their checksums"}
+	commands["dev/download"] = build.Command{Fn: GoModDownload, Description: "Downloads dependencies of all the modules"}
+	commands[cacheProgCommand] = build.Command{Fn: GoCacheProg, Description: "Serves compiler cache to go"}
+	cacheProgRegistered = true
 	commands["dev/test"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
 		return GoTest(ctx, deps)
 	}, Description: "Runs go unit tests"}
+	commands["dev/test/unit"] = build.Command{Fn: GoTestUnit, Description: "Runs unit tests"}
+	commands["dev/test/integration"] = build.Command{Fn: GoTestIntegration, Description: "Runs integration tests"}
+	commands["dev/test/e2e"] = build.Command{Fn: GoTestE2E, Description: "Runs end-to-end tests"}
+	commands["dev/bench"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoBench(ctx, deps, BenchConfig{})
+	}, Description: "Runs go benchmarks"}
+	commands["dev/fuzz"] = build.Command{Fn: func(ctx context.Context, deps build.DepsFunc) error {
+		return GoFuzz(ctx, deps, FuzzConfig{})
+	}, Description: "Runs go fuzz tests"}
+	commands["dev/coverage"] = build.Command{Fn: GoCoverageReport, Description: "Prints coverage report"}
+	commands["dev/coverage/html"] = build.Command{Fn: GoCoverageReportHTML, Description: "Generates HTML coverage report"}
+
+	// Commands added by buildgo are timed, see timedCommand. Compiler cache is excluded, because it runs
+	// as a separate process talking to go over stdout.
+	for name, command := range commands {
+		if !existing[name] && name != cacheProgCommand {
+			command.Fn = timedCommand(name, command.Fn)
+			commands[name] = command
+		}
+	}
 }
@@ -0,0 +1,315 @@
+package buildgo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// coverageSubDir is the directory, relative to the repository root, where coverage profiles are stored
+const coverageSubDir = "bin/.coverage"
+
+// GoCoverageCollect converts coverage data written to goCoverDir by binaries built with Cover option
+// into the profile stored next to the ones produced by GoTest
+func GoCoverageCollect(ctx context.Context, deps build.DepsFunc, goCoverDir, name string) error {
+	deps(EnsureGo)
+
+	profile := filepath.Join(coverageSubDir, name)
+	logger.Get(ctx).Info("Collecting coverage data", zap.String("dir", goCoverDir), zap.String("profile", profile))
+	if !dryRun() {
+		if err := os.MkdirAll(coverageSubDir, 0o700); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	cmd := exec.Command("go", "tool", "covdata", "textfmt", "-i", goCoverDir, "-o", profile)
+	if err := execCmds(ctx, cmd); err != nil {
+		return errors.Wrapf(err, "converting coverage data from '%s' failed", goCoverDir)
+	}
+	return nil
+}
+
+// Paths of merged coverage reports
+const (
+	CoverageProfile = "bin/coverage.out"
+	CoverageHTML    = "bin/coverage.html"
+)
+
+// GoCoverageReport merges all the coverage profiles into CoverageProfile and prints coverage of each package
+func GoCoverageReport() error {
+	if err := GoCoverageMerge(CoverageProfile); err != nil {
+		return err
+	}
+	// Profiles are read directly, because merged one is not stored in dry-run mode
+	profiles, err := coverageProfiles()
+	if err != nil {
+		return err
+	}
+	total, pkgs, err := coverageProfileStats(nil, profiles...)
+	if err != nil {
+		return err
+	}
+
+	var maxLen int
+	for pkg := range pkgs {
+		if len(pkg) > maxLen {
+			maxLen = len(pkg)
+		}
+	}
+	format := fmt.Sprintf("   %%-%ds  %%6.1f%%%%\n", maxLen)
+	fmt.Println("\n Coverage:")
+	fmt.Println()
+	for _, pkg := range sortedKeys(pkgs) {
+		fmt.Printf(format, pkg, pkgs[pkg].Percent())
+	}
+	fmt.Println()
+	fmt.Printf(format, "total", total.Percent())
+	fmt.Println()
+	return nil
+}
+
+// GoCoverageReportHTML produces HTML coverage report stored in CoverageHTML
+func GoCoverageReportHTML(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo, GoCoverageReport)
+
+	logger.Get(ctx).Info("Generating HTML coverage report", zap.String("path", CoverageHTML))
+	cmd := exec.Command("go", "tool", "cover", "-html", CoverageProfile, "-o", CoverageHTML)
+	if err := execCmds(ctx, cmd); err != nil {
+		return errors.Wrap(err, "generating HTML coverage report failed")
+	}
+	return nil
+}
+
+// GoCoverageMerge merges all the coverage profiles produced by GoTest and GoCoverageCollect into a single file.
+// Nothing is written in dry-run mode.
+func GoCoverageMerge(out string) error {
+	profiles, err := coverageProfiles()
+	if err != nil || dryRun() {
+		return err
+	}
+	return mergeCoverageProfiles(out, profiles...)
+}
+
+// coverageProfiles returns paths of all the coverage profiles produced by GoTest and GoCoverageCollect
+func coverageProfiles() ([]string, error) {
+	entries, err := os.ReadDir(coverageSubDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	profiles := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			profiles = append(profiles, filepath.Join(coverageSubDir, entry.Name()))
+		}
+	}
+	return profiles, nil
+}
+
+func mergeCoverageProfiles(out string, profiles ...string) error {
+	mode, counts, err := readCoverageProfiles(profiles...)
+	if err != nil {
+		return err
+	}
+
+	content := &strings.Builder{}
+	fmt.Fprintf(content, "mode: %s\n", mode)
+	for _, block := range sortedKeys(counts) {
+		fmt.Fprintf(content, "%s %d\n", block, counts[block])
+	}
+	return errors.WithStack(os.WriteFile(out, []byte(content.String()), 0o600))
+}
+
+type coverageStats struct {
+	Statements int64
+	Covered    int64
+}
+
+func (cs coverageStats) Percent() float64 {
+	if cs.Statements == 0 {
+		return 100
+	}
+	return 100 * float64(cs.Covered) / float64(cs.Statements)
+}
+
+// moduleCoverage computes total and per-package coverage of the module stored in the profiles.
+// Files matching exclude patterns and generated files, unless included by the repository configuration,
+// are not taken into account.
+func moduleCoverage(ctx context.Context, module string, exclude []string,
+	profiles ...string,
+) (coverageStats, map[string]coverageStats, error) {
+	skipGenerated, err := excludeGenerated()
+	if err != nil {
+		return coverageStats{}, nil, err
+	}
+	if skipGenerated {
+		modulePath, err := goModulePath(ctx, module)
+		if err != nil {
+			return coverageStats{}, nil, err
+		}
+		_, generated, err := moduleGoFiles(module)
+		if err != nil {
+			return coverageStats{}, nil, err
+		}
+		// Files are reported in profiles using their import paths
+		exclude = append([]string{}, exclude...)
+		for _, file := range generated {
+			exclude = append(exclude, pathPatternEscaper.Replace(modulePath+"/"+file))
+		}
+	}
+	return coverageProfileStats(exclude, profiles...)
+}
+
+// checkCoverage verifies that total coverage of the module is not lower than minCoverage
+func checkCoverage(ctx context.Context, module string, minCoverage float64, total coverageStats,
+	pkgs map[string]coverageStats,
+) error {
+	if total.Percent() >= minCoverage {
+		return nil
+	}
+
+	log := logger.Get(ctx)
+	for _, pkg := range sortedKeys(pkgs) {
+		if stats := pkgs[pkg]; stats.Percent() < minCoverage {
+			log.Error("Package coverage is below threshold", zap.String("package", pkg),
+				zap.String("coverage", fmt.Sprintf("%.1f%%", stats.Percent())))
+		}
+	}
+	return errors.Errorf("coverage %.1f%% of module '%s' is below threshold %.1f%%", total.Percent(), module,
+		minCoverage)
+}
+
+// coverageProfileStats computes total and per-package coverage stats, files matching exclude patterns are skipped
+func coverageProfileStats(exclude []string, profiles ...string) (coverageStats, map[string]coverageStats, error) {
+	_, counts, err := readCoverageProfiles(profiles...)
+	if err != nil {
+		return coverageStats{}, nil, err
+	}
+
+	var total coverageStats
+	pkgs := map[string]coverageStats{}
+	for block, count := range counts {
+		pos := strings.LastIndex(block, " ")
+		statements, err := strconv.ParseInt(block[pos+1:], 10, 64)
+		if err != nil {
+			return coverageStats{}, nil, errors.Wrapf(err, "invalid coverage block '%s'", block)
+		}
+		file := block[:strings.LastIndex(block[:pos], ":")]
+		if matchesAny(exclude, file) {
+			continue
+		}
+		pkg := path.Dir(file)
+
+		stats := pkgs[pkg]
+		stats.Statements += statements
+		total.Statements += statements
+		if count > 0 {
+			stats.Covered += statements
+			total.Covered += statements
+		}
+		pkgs[pkg] = stats
+	}
+	return total, pkgs, nil
+}
+
+// readCoverageProfiles reads coverage profiles and merges counts of the same blocks. Profiles of count and atomic
+// modes are merged in atomic mode. If any of them uses set mode, counts are merged as hit or not hit in set mode.
+func readCoverageProfiles(profiles ...string) (string, map[string]int64, error) {
+	modes := map[string]bool{}
+	counts := map[string]int64{}
+	for _, profile := range profiles {
+		err := func() error {
+			f, err := os.Open(profile)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			defer f.Close()
+
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if line == "" {
+					continue
+				}
+				if mode := strings.TrimPrefix(line, "mode: "); mode != line {
+					switch mode {
+					case "set", "count", "atomic":
+					default:
+						return errors.Errorf("unsupported coverage mode '%s' in profile '%s'", mode, profile)
+					}
+					modes[mode] = true
+					continue
+				}
+				pos := strings.LastIndex(line, " ")
+				if pos < 0 {
+					return errors.Errorf("invalid line '%s' in coverage profile '%s'", line, profile)
+				}
+				count, err := strconv.ParseInt(line[pos+1:], 10, 64)
+				if err != nil {
+					return errors.Wrapf(err, "invalid line '%s' in coverage profile '%s'", line, profile)
+				}
+				counts[line[:pos]] += count
+			}
+			return errors.WithStack(scanner.Err())
+		}()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	mode := "atomic"
+	switch {
+	case len(modes) == 1:
+		mode = sortedKeys(modes)[0]
+	case modes["set"]:
+		mode = "set"
+	}
+	if mode == "set" {
+		for block, count := range counts {
+			if count > 0 {
+				counts[block] = 1
+			}
+		}
+	}
+	return mode, counts, nil
+}
+
+// matchesAny returns true if any of the patterns matches the slash-separated path or any of its trailing subpaths.
+// Patterns use path.Match syntax, e.g. "*.pb.go" matches all protobuf files and "mocks" matches all the mocks
+// packages.
+func matchesAny(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		subPath := p
+		for {
+			if matched, _ := path.Match(pattern, subPath); matched {
+				return true
+			}
+			pos := strings.Index(subPath, "/")
+			if pos < 0 {
+				break
+			}
+			subPath = subPath[pos+1:]
+		}
+	}
+	return false
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,86 @@
+package buildgo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/outofforest/logger"
+	"go.uber.org/zap"
+)
+
+func TestMergeCoverageProfilesOfDifferentModes(t *testing.T) {
+	dir := t.TempDir()
+	atomicProfile := filepath.Join(dir, "test")
+	setProfile := filepath.Join(dir, "binary")
+	out := filepath.Join(dir, "coverage.out")
+
+	writeFile(t, atomicProfile, "mode: atomic\n"+
+		"ex.com/m/a.go:1.1,2.1 1 5\n"+
+		"ex.com/m/a.go:3.1,4.1 2 0\n"+
+		"ex.com/m/a.go:5.1,6.1 3 0\n")
+	writeFile(t, setProfile, "mode: set\n"+
+		"ex.com/m/a.go:1.1,2.1 1 1\n"+
+		"ex.com/m/a.go:3.1,4.1 2 1\n"+
+		"ex.com/m/a.go:5.1,6.1 3 0\n")
+
+	if err := mergeCoverageProfiles(out, atomicProfile, setProfile); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "mode: set\n" +
+		"ex.com/m/a.go:1.1,2.1 1 1\n" +
+		"ex.com/m/a.go:3.1,4.1 2 1\n" +
+		"ex.com/m/a.go:5.1,6.1 3 0\n"
+	if string(content) != expected {
+		t.Fatalf("unexpected merged profile:\n%s", content)
+	}
+
+	total, _, err := coverageProfileStats(nil, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Statements != 6 || total.Covered != 3 {
+		t.Fatalf("unexpected coverage: %d of %d statements covered", total.Covered, total.Statements)
+	}
+}
+
+func TestCoverageOfModuleExcludedFromIt(t *testing.T) {
+	pkgs := []string{"ex.com/m/mocks", "ex.com/m/gen/api"}
+	tests := []struct {
+		name     string
+		exclude  []string
+		expected []string
+	}{
+		{name: "nothing excluded", exclude: nil, expected: pkgs},
+		{name: "some excluded", exclude: []string{"mocks"}, expected: []string{"ex.com/m/gen/api"}},
+		{name: "all excluded", exclude: []string{"mocks", "gen/*"}, expected: nil},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			if covered := coveredPackages(pkgs, test.exclude); !reflect.DeepEqual(covered, test.expected) {
+				t.Fatalf("unexpected covered packages: %v", covered)
+			}
+		})
+	}
+
+	// Module having all the packages excluded produces no coverage profiles, so threshold is not checked
+	ctx := logger.WithLogger(context.Background(), zap.NewNop())
+	if err := checkModuleCoverage(ctx, ".", TestConfig{MinCoverage: 80}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFile(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,104 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DeadcodeBaseline is the file containing unreachable functions accepted as existing debt, one per line
+const DeadcodeBaseline = "build/.deadcode-baseline"
+
+// DeadcodeConfig is the configuration of dead code detection
+type DeadcodeConfig struct {
+	// Tags is the list of build tags
+	Tags []string
+
+	// UpdateBaseline stores all the currently unreachable functions in DeadcodeBaseline instead of failing
+	UpdateBaseline bool
+}
+
+// GoDeadcode reports functions unreachable from main packages and tests of all modules.
+// Functions listed in DeadcodeBaseline are ignored.
+func GoDeadcode(ctx context.Context, deps build.DepsFunc, config DeadcodeConfig) error {
+	deps(EnsureGo, EnsureDeadcode)
+	log := logger.Get(ctx)
+
+	var baselineFile string
+	if fileExists(DeadcodeBaseline) && !config.UpdateBaseline {
+		baselineFile = DeadcodeBaseline
+	}
+	baseline, err := readListFile(baselineFile)
+	if err != nil {
+		return err
+	}
+
+	var unreachable, found []string
+	err = onModule(ctx, func(path string) error {
+		names, err := goListOutput(ctx, path, "{{.Name}}", "./...")
+		if err != nil {
+			return err
+		}
+		if !contains(strings.Fields(names), "main") {
+			log.Info("Module contains no main packages, skipping dead code detection", zap.String("path", path))
+			return nil
+		}
+
+		log.Info("Detecting dead code", zap.String("path", path))
+
+		args := []string{"-test", "-f",
+			`{{range .Funcs}}{{$.Path}}.{{.Name}}{{"\t"}}{{.Position.File}}:{{.Position.Line}}{{"\n"}}{{end}}`}
+		if len(config.Tags) > 0 {
+			args = append(args, "-tags", strings.Join(config.Tags, ","))
+		}
+		buf := &bytes.Buffer{}
+		cmd := exec.Command("deadcode", append(args, "./...")...)
+		cmd.Dir = path
+		cmd.Stdout = buf
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "deadcode failed in module '%s'", path)
+		}
+
+		for _, line := range strings.Split(buf.String(), "\n") {
+			fields := strings.SplitN(line, "\t", 2)
+			if len(fields) != 2 {
+				continue
+			}
+			found = append(found, fields[0])
+			if !baseline[fields[0]] {
+				unreachable = append(unreachable, "  "+fields[1]+": "+fields[0])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if config.UpdateBaseline {
+		log.Info("Storing dead code baseline", zap.String("path", DeadcodeBaseline), zap.Int("functions", len(found)))
+		if dryRun() {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(DeadcodeBaseline), 0o755); err != nil {
+			return errors.WithStack(err)
+		}
+		content := strings.Join(found, "\n")
+		if content != "" {
+			content += "\n"
+		}
+		return errors.WithStack(os.WriteFile(DeadcodeBaseline, []byte(content), 0o644))
+	}
+	if len(unreachable) > 0 {
+		return errors.Errorf("unreachable functions found:\n%s", strings.Join(unreachable, "\n"))
+	}
+	return nil
+}
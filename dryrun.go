@@ -0,0 +1,120 @@
+package buildgo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/outofforest/logger"
+	"go.uber.org/zap"
+)
+
+// dryRun returns true if BUILDGO_DRY_RUN environment variable is set to true. In dry-run mode commands changing
+// anything are printed instead of being executed, together with their working directories and differences
+// between their environment and the one of the builder, so every step may be reproduced manually.
+// Commands only inspecting the state, like `go list` or `git rev-parse`, are still executed, because next steps
+// depend on their output. Files are not written, tools are not downloaded, targets are not recorded
+// in the build report and the remote cache is disabled, skipped steps are logged instead, see skipInDryRun.
+// Steps using files produced by skipped commands may fail.
+func dryRun() bool {
+	return os.Getenv("BUILDGO_DRY_RUN") == "true"
+}
+
+// skipInDryRun returns true in dry-run mode, then the step is logged instead of being done
+func skipInDryRun(ctx context.Context, step string, fields ...zap.Field) bool {
+	if !dryRun() {
+		return false
+	}
+	logger.Get(ctx).Info(step, append(fields, zap.Bool("dryRun", true))...)
+	return true
+}
+
+// isQueryCmd returns true if command only reads the state of the repository or go environment
+func isQueryCmd(cmd *exec.Cmd) bool {
+	if len(cmd.Args) < 2 {
+		return false
+	}
+	args := cmd.Args[1:]
+	switch cmd.Args[0] {
+	case "go":
+		switch args[0] {
+		case "list", "env", "version":
+			return true
+		case "mod", "work":
+			return len(args) > 1 && args[1] == "edit" && contains(args, "-json")
+		}
+	case "git":
+		switch args[0] {
+		case "rev-parse", "rev-list", "describe", "log", "diff", "ls-files", "status", "show", "merge-base":
+			return true
+		case "tag":
+			return contains(args, "--list")
+		case "remote":
+			return len(args) > 1 && args[1] == "get-url"
+		}
+	}
+	return false
+}
+
+// printDryRun prints commands as shell command lines reproducing their execution
+func printDryRun(cmds []*exec.Cmd) {
+	for _, cmd := range cmds {
+		line := make([]string, 0, len(cmd.Args))
+		for _, arg := range cmd.Args {
+			line = append(line, shellQuote(arg))
+		}
+		if env := envDiff(os.Environ(), cmd.Env); len(env) > 0 {
+			line = append(append([]string{"env"}, env...), line...)
+		}
+		if cmd.Dir != "" && cmd.Dir != "." {
+			line = append([]string{"cd", shellQuote(cmd.Dir), "&&"}, line...)
+		}
+		fmt.Println(strings.Join(line, " "))
+	}
+}
+
+// envDiff returns arguments of env command turning base environment into the target one.
+// Nil target means that command inherits base environment.
+func envDiff(base, target []string) []string {
+	if target == nil {
+		return nil
+	}
+	baseVars := envMap(base)
+	targetVars := envMap(target)
+
+	var diff []string
+	for _, name := range sortedKeys(baseVars) {
+		if _, exists := targetVars[name]; !exists {
+			diff = append(diff, "-u", shellQuote(name))
+		}
+	}
+	var set []string
+	for name, value := range targetVars {
+		if baseValue, exists := baseVars[name]; !exists || baseValue != value {
+			set = append(set, shellQuote(name+"="+value))
+		}
+	}
+	sort.Strings(set)
+	return append(diff, set...)
+}
+
+// envMap converts environment to map, later variables override earlier ones like in exec.Cmd
+func envMap(env []string) map[string]string {
+	vars := make(map[string]string, len(env))
+	for _, v := range env {
+		name, value, _ := strings.Cut(v, "=")
+		vars[name] = value
+	}
+	return vars
+}
+
+// shellQuote quotes the argument, so it is passed unchanged by the shell
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+./:,@%") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
@@ -0,0 +1,82 @@
+package buildgo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// targetFailure is the failure of the target run for the module, recorded in continue-on-error mode
+type targetFailure struct {
+	Target string
+	Module string
+	Err    error
+}
+
+var (
+	failuresMu sync.Mutex
+	failures   []targetFailure
+)
+
+// continueOnErrorEnabled returns true if BUILDGO_CONTINUE_ON_ERROR environment variable is set to true.
+// In this mode failing modules don't stop lint and test, remaining modules and commands are processed
+// and the run ends with the report of all the failures. It applies to commands added by AddCommands only,
+// because the report is printed once the outermost one completes.
+func continueOnErrorEnabled() bool {
+	if os.Getenv("BUILDGO_CONTINUE_ON_ERROR") != "true" {
+		return false
+	}
+
+	timingMu.Lock()
+	defer timingMu.Unlock()
+
+	return commandDepth > 0
+}
+
+// continueOnError wraps fn processing the module, in continue-on-error mode its failure is recorded and nil
+// is returned, so remaining modules are processed
+func continueOnError(target string,
+	fn func(ctx context.Context, path string) error,
+) func(ctx context.Context, path string) error {
+	return func(ctx context.Context, path string) error {
+		err := fn(ctx, path)
+		if err == nil || !continueOnErrorEnabled() {
+			return err
+		}
+
+		failuresMu.Lock()
+		defer failuresMu.Unlock()
+
+		failures = append(failures, targetFailure{Target: target, Module: path, Err: err})
+		return nil
+	}
+}
+
+// reportFailures prints failures recorded in continue-on-error mode, error is returned if there are any
+func reportFailures() error {
+	failuresMu.Lock()
+	recorded := failures
+	failures = nil
+	failuresMu.Unlock()
+
+	if len(recorded) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(recorded))
+	fmt.Printf("\n Failures (%d):\n", len(recorded))
+	for _, failure := range recorded {
+		name := failure.Target + " " + failure.Module
+		names = append(names, name)
+		fmt.Printf("\n   %s\n", name)
+		for _, line := range strings.Split(strings.TrimSpace(failure.Err.Error()), "\n") {
+			fmt.Printf("     %s\n", line)
+		}
+	}
+	fmt.Println()
+	return errors.Errorf("%d targets failed: %s", len(recorded), strings.Join(names, ", "))
+}
@@ -0,0 +1,92 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// FormatConfig is the configuration of code formatting
+type FormatConfig struct {
+	// LocalPrefix is the import path prefix of packages grouped separately by goimports,
+	// module path is used if empty
+	LocalPrefix string
+}
+
+// GoFormat verifies that code in all modules is formatted by gofumpt and goimports
+func GoFormat(ctx context.Context, deps build.DepsFunc, config FormatConfig) error {
+	deps(EnsureGo)
+	if err := ensureGoTools(ctx, "gofumpt", "goimports"); err != nil {
+		return err
+	}
+	return goFormat(ctx, config, false)
+}
+
+// GoFormatFix formats code in all modules using gofumpt and goimports
+func GoFormatFix(ctx context.Context, deps build.DepsFunc, config FormatConfig) error {
+	deps(EnsureGo)
+	if err := ensureGoTools(ctx, "gofumpt", "goimports"); err != nil {
+		return err
+	}
+	return goFormat(ctx, config, true)
+}
+
+func goFormat(ctx context.Context, config FormatConfig, fix bool) error {
+	log := logger.Get(ctx)
+	mode := "-l"
+	if fix {
+		mode = "-w"
+	}
+
+	skipGenerated, err := excludeGenerated()
+	if err != nil {
+		return err
+	}
+
+	return onModule(ctx, func(path string) error {
+		files, generated, err := moduleGoFiles(path)
+		if err != nil {
+			return err
+		}
+		if !skipGenerated {
+			files = append(files, generated...)
+		}
+		if len(files) == 0 {
+			return nil
+		}
+
+		localPrefix := config.LocalPrefix
+		if localPrefix == "" {
+			localPrefix, err = goModulePath(ctx, path)
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Info("Formatting code", zap.String("path", path), zap.Bool("fix", fix))
+		var unformatted []string
+		for _, args := range [][]string{
+			append([]string{"gofumpt", mode}, files...),
+			append([]string{"goimports", mode, "-local", localPrefix}, files...),
+		} {
+			buf := &bytes.Buffer{}
+			cmd := exec.Command(args[0], args[1:]...)
+			cmd.Dir = path
+			cmd.Stdout = buf
+			if err := execCmds(ctx, cmd); err != nil {
+				return errors.Wrapf(err, "%s failed in module '%s'", args[0], path)
+			}
+			unformatted = append(unformatted, strings.Fields(buf.String())...)
+		}
+		if !fix && len(unformatted) > 0 {
+			return errors.Errorf("files not formatted in module '%s': %s", path, strings.Join(unformatted, ", "))
+		}
+		return nil
+	})
+}
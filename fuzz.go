@@ -0,0 +1,223 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Default directories used by fuzzing
+const (
+	DefaultFuzzCorpusDir   = "bin/.fuzz/corpus"
+	DefaultFuzzCrashersDir = "bin/fuzz-crashers"
+)
+
+// FuzzConfig is the configuration of fuzz tests
+type FuzzConfig struct {
+	// Tags is the list of build tags
+	Tags []string
+
+	// Duration is the time each fuzz target is run for, 30s is used if 0
+	Duration time.Duration
+
+	// CorpusDir is the directory where generated corpus is persisted between runs,
+	// DefaultFuzzCorpusDir is used if empty
+	CorpusDir string
+
+	// CrashersDir is the directory where inputs reproducing found crashes are moved from testdata of the package,
+	// DefaultFuzzCrashersDir is used if empty
+	CrashersDir string
+}
+
+// GoFuzz discovers fuzz targets in all modules and runs each of them for the configured duration.
+// Failure of the target doesn't stop the remaining ones, errors of all of them are returned.
+func GoFuzz(ctx context.Context, deps build.DepsFunc, config FuzzConfig) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+
+	if config.Duration == 0 {
+		config.Duration = 30 * time.Second
+	}
+	if config.CorpusDir == "" {
+		config.CorpusDir = DefaultFuzzCorpusDir
+	}
+	if config.CrashersDir == "" {
+		config.CrashersDir = DefaultFuzzCrashersDir
+	}
+
+	goCache, err := goEnv(ctx, "GOCACHE")
+	if err != nil {
+		return err
+	}
+
+	return onModule(ctx, func(path string) error {
+		pkgs, err := goListPackages(ctx, path, config.Tags)
+		if err != nil {
+			return err
+		}
+		// All the targets are run, even if some of them fail
+		var fuzzErr error
+		for _, pkg := range pkgs {
+			targets, err := fuzzTargets(ctx, path, pkg, config.Tags)
+			if err != nil {
+				return multierr.Append(fuzzErr, err)
+			}
+			for _, target := range targets {
+				log.Info("Running fuzz target", zap.String("package", pkg), zap.String("target", target),
+					zap.Duration("duration", config.Duration))
+				fuzzErr = multierr.Append(fuzzErr, runFuzzTarget(ctx, path, pkg, target, goCache, config))
+			}
+		}
+		return fuzzErr
+	})
+}
+
+// fuzzTargets returns names of fuzz targets defined in the package
+func fuzzTargets(ctx context.Context, path, pkg string, tags []string) ([]string, error) {
+	args := []string{"test", "-list", "^Fuzz"}
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", append(args, pkg)...)
+	cmd.Dir = path
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return nil, errors.Wrapf(err, "listing fuzz targets in package '%s' failed", pkg)
+	}
+
+	var targets []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "Fuzz") {
+			targets = append(targets, strings.TrimSpace(line))
+		}
+	}
+	return targets, nil
+}
+
+func runFuzzTarget(ctx context.Context, path, pkg, target, goCache string, config FuzzConfig) error {
+	// Go keeps generated corpus in the build cache, it is synchronized with the persistent corpus directory
+	cacheCorpusDir := filepath.Join(goCache, "fuzz", pkg, target)
+	corpusDir := filepath.Join(config.CorpusDir, pkg, target)
+	if !skipInDryRun(ctx, "Restoring fuzz corpus", zap.String("dir", corpusDir)) {
+		if err := copyDirFiles(corpusDir, cacheCorpusDir); err != nil {
+			return err
+		}
+	}
+
+	pkgDir, err := goPackageDir(ctx, path, pkg)
+	if err != nil {
+		return err
+	}
+	testdataDir := filepath.Join(pkgDir, "testdata", "fuzz", target)
+	existingInputs, err := dirFiles(testdataDir)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"test", "-run=^$", "-fuzz=^" + target + "$", "-fuzztime=" + config.Duration.String()}
+	if len(config.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(config.Tags, ","))
+	}
+	cmd := exec.Command("go", append(args, pkg)...)
+	cmd.Dir = path
+	fuzzErr := execCmds(ctx, cmd)
+	if dryRun() {
+		return fuzzErr
+	}
+
+	if err := copyDirFiles(cacheCorpusDir, corpusDir); err != nil {
+		return err
+	}
+	if fuzzErr == nil {
+		return nil
+	}
+
+	inputs, err := dirFiles(testdataDir)
+	if err != nil {
+		return err
+	}
+	crashersDir := filepath.Join(config.CrashersDir, pkg, target)
+	for input := range inputs {
+		if existingInputs[input] {
+			continue
+		}
+		if err := os.MkdirAll(crashersDir, 0o700); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := copyFile(filepath.Join(testdataDir, input), filepath.Join(crashersDir, input)); err != nil {
+			return err
+		}
+		logger.Get(ctx).Error("Crasher found", zap.String("package", pkg), zap.String("target", target),
+			zap.String("reproducer", filepath.Join(crashersDir, input)))
+		if err := os.Remove(filepath.Join(testdataDir, input)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if len(existingInputs) == 0 {
+		// Directories created by go test are removed if they are empty, so the package is left untouched
+		for dir := testdataDir; dir != pkgDir; dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return errors.Wrapf(fuzzErr, "fuzz target '%s' failed in package '%s'", target, pkg)
+}
+
+func goPackageDir(ctx context.Context, path, pkg string) (string, error) {
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", "list", "-f", "{{.Dir}}", pkg)
+	cmd.Dir = path
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return "", errors.Wrapf(err, "resolving directory of package '%s' failed", pkg)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// dirFiles returns names of files in the directory, missing directory is treated as empty one
+func dirFiles(dir string) (map[string]bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]bool{}, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	files := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files[entry.Name()] = true
+		}
+	}
+	return files, nil
+}
+
+// copyDirFiles copies files from src directory to dst directory, missing src directory is treated as empty one
+func copyDirFiles(src, dst string) error {
+	files, err := dirFiles(src)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0o700); err != nil {
+		return errors.WithStack(err)
+	}
+	for file := range files {
+		if err := copyFile(filepath.Join(src, file), filepath.Join(dst, file)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
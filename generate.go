@@ -0,0 +1,54 @@
+package buildgo
+
+import (
+	"context"
+	"os/exec"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// GenerateConfig is the configuration of go code generation
+type GenerateConfig struct {
+	// Tools is the list of go tools installed before generators are run, e.g. protoc-gen-go
+	Tools []string
+
+	// Check verifies that generated files are up to date. Git tree must be clean before generators are run
+	// and it must stay clean afterwards.
+	Check bool
+}
+
+// GoGenerate runs `go generate` for all the packages in all the modules
+func GoGenerate(ctx context.Context, deps build.DepsFunc, config GenerateConfig) error {
+	deps(EnsureGo)
+	if err := ensureGoTools(ctx, config.Tools...); err != nil {
+		return err
+	}
+	if config.Check {
+		if err := GitStatusClean(ctx); err != nil {
+			return errors.Wrap(err, "git tree must be clean to verify generated files")
+		}
+	}
+
+	log := logger.Get(ctx)
+	err := onModule(ctx, func(path string) error {
+		log.Info("Running go generate", zap.String("path", path))
+
+		cmd := exec.Command("go", "generate", "./...")
+		cmd.Dir = path
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "go generate failed in module '%s'", path)
+		}
+		return nil
+	})
+	if err != nil || !config.Check {
+		return err
+	}
+
+	if err := GitStatusClean(ctx); err != nil {
+		return errors.Wrap(err, "generated files are not up to date")
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package buildgo
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// generatedFileRegexp matches the comment marking generated go files, see https://go.dev/s/generatedcode
+var generatedFileRegexp = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+
+func isGeneratedFile(content []byte) bool {
+	return generatedFileRegexp.Match(content)
+}
+
+// excludeGenerated returns true if generated files are excluded from format checks, metrics and coverage
+func excludeGenerated() (bool, error) {
+	config, err := LoadRepoConfig()
+	if err != nil {
+		return false, err
+	}
+	return !config.IncludeGenerated, nil
+}
+
+// moduleGoFiles returns go files of the module in dir, paths are slash-separated and relative to dir.
+// Nested modules and excluded directories are skipped. Generated files are returned separately.
+func moduleGoFiles(dir string) ([]string, []string, error) {
+	var sources, generated []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if d.IsDir() {
+			if relPath != "." && (isModuleDirExcluded(relPath, ModuleExcludes) ||
+				fileExists(filepath.Join(path, "go.mod"))) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || filepath.Ext(path) != ".go" {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if isGeneratedFile(content) {
+			generated = append(generated, filepath.ToSlash(relPath))
+		} else {
+			sources = append(sources, filepath.ToSlash(relPath))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return sources, generated, nil
+}
+
+// pathPatternEscaper escapes special characters of path.Match patterns
+var pathPatternEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
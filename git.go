@@ -4,28 +4,173 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/outofforest/libexec"
 	"github.com/pkg/errors"
 )
 
 // GitFetch fetches changes from repo
 func GitFetch(ctx context.Context) error {
-	return libexec.Exec(ctx, exec.Command("git", "fetch", "-p"))
+	return execCmds(ctx, exec.Command("git", "fetch", "-p"))
 }
 
-func gitStatusClean(ctx context.Context) error {
+// VersionInfo contains version information injected into binaries.
+// Values are stored in Version, Commit, Branch and BuildDate string variables of the version package.
+type VersionInfo struct {
+	// Version is the semantic version computed by Version
+	Version string
+
+	// Commit is the hash of the current commit
+	Commit string
+
+	// Branch is the name of the current branch
+	Branch string
+
+	// BuildDate is the time of the build in RFC3339 format
+	BuildDate string
+}
+
+// LDFlags returns linker flags setting version variables in the package
+func (vi VersionInfo) LDFlags(pkg string) []string {
+	return []string{
+		fmt.Sprintf("-X %s.Version=%s", pkg, vi.Version),
+		fmt.Sprintf("-X %s.Commit=%s", pkg, vi.Commit),
+		fmt.Sprintf("-X %s.Branch=%s", pkg, vi.Branch),
+		fmt.Sprintf("-X %s.BuildDate=%s", pkg, vi.BuildDate),
+	}
+}
+
+// GitVersionInfo computes version information from git repository
+func GitVersionInfo(ctx context.Context) (VersionInfo, error) {
+	version, err := Version(ctx)
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	commit, err := gitOutput(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	branch, err := gitOutput(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	return VersionInfo{
+		Version:   version.String(),
+		Commit:    commit,
+		Branch:    branch,
+		BuildDate: time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// gitSourceDateEpoch returns SOURCE_DATE_EPOCH if set, otherwise the time of the last commit
+func gitSourceDateEpoch(ctx context.Context) (int64, error) {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		v, err := strconv.ParseInt(epoch, 10, 64)
+		return v, errors.Wrapf(err, "invalid SOURCE_DATE_EPOCH '%s'", epoch)
+	}
+	commitTime, err := gitOutput(ctx, "log", "-1", "--format=%ct")
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(commitTime, 10, 64)
+	return v, errors.Wrapf(err, "invalid commit time '%s'", commitTime)
+}
+
+func gitOutput(ctx context.Context, args ...string) (string, error) {
 	buf := &bytes.Buffer{}
-	cmd := exec.Command("git", "status", "-s")
+	cmd := exec.Command("git", args...)
 	cmd.Stdout = buf
-	if err := libexec.Exec(ctx, cmd); err != nil {
-		return err
+	if err := execCmds(ctx, cmd); err != nil {
+		return "", errors.Wrapf(err, "git %s failed", args[0])
 	}
-	if buf.Len() > 0 {
-		fmt.Println("git status:")
-		fmt.Println(buf)
-		return errors.New("git status is not empty")
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// GitStatusConfig is the configuration of git status check
+type GitStatusConfig struct {
+	// Ignore is the list of patterns of paths allowed to be modified or untracked. Pattern ending with "/" matches
+	// all the files in the directory, other ones use path.Match syntax and are matched against the slash-separated
+	// path relative to repository root and against the file name.
+	Ignore []string
+
+	// DiffLines is the maximum number of lines of the diff reported in the error, 50 is used if 0
+	DiffLines int
+}
+
+// GitStatusClean fails if there are modified or untracked files in the repository
+func GitStatusClean(ctx context.Context) error {
+	return GitStatusCleanWithConfig(ctx, GitStatusConfig{})
+}
+
+// GitStatusCleanWithConfig fails if there are modified or untracked files in the repository, not matching
+// the ignore patterns. Error contains status and diff of those files.
+func GitStatusCleanWithConfig(ctx context.Context, config GitStatusConfig) error {
+	if config.DiffLines == 0 {
+		config.DiffLines = 50
+	}
+
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("git", "status", "--porcelain=v1", "-z", "--untracked-files=all")
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return errors.Wrap(err, "git status failed")
+	}
+
+	var status, files []string
+	records := strings.Split(buf.String(), "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if len(record) < 4 {
+			continue
+		}
+		file := record[3:]
+		// Renamed and copied entries are followed by the original path
+		if record[0] == 'R' || record[0] == 'C' {
+			i++
+		}
+		if isGitPathIgnored(file, config.Ignore) {
+			continue
+		}
+		status = append(status, record)
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	buf.Reset()
+	cmd = exec.Command("git", append([]string{"diff", "HEAD", "--"}, files...)...)
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return errors.Wrap(err, "git diff failed")
+	}
+	diff := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(diff) > config.DiffLines {
+		diff = append(diff[:config.DiffLines], fmt.Sprintf("... (%d more lines)", len(diff)-config.DiffLines))
+	}
+
+	return errors.Errorf("git status is not empty:\n%s\n\n%s", strings.Join(status, "\n"), strings.Join(diff, "\n"))
+}
+
+func isGitPathIgnored(file string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if strings.HasPrefix(file, pattern) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, file); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, path.Base(file)); matched {
+			return true
+		}
 	}
-	return nil
+	return false
 }
@@ -0,0 +1,271 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// GitHubReleaseConfig is the configuration of GitHub release
+type GitHubReleaseConfig struct {
+	// Repository is the GitHub repository in the owner/name format. If empty, value of GITHUB_REPOSITORY
+	// environment variable is used, if it is not set either, repository is taken from the origin remote.
+	Repository string
+
+	// Tag is the tag of the release, version tag of the HEAD commit is used if empty
+	Tag string
+
+	// Files is the list of files uploaded to the release, like binaries, archives, checksums and SBOMs.
+	// Existing assets having the same names are replaced.
+	Files []string
+
+	// Changelog is the path of the changelog, ChangelogFile is used if empty. Section of the released version
+	// is used as the description of the release.
+	Changelog string
+
+	// Draft creates the release as draft, it is not visible publicly until it is published
+	Draft bool
+}
+
+// githubRelease is the release returned by GitHub API
+type githubRelease struct {
+	ID        int64  `json:"id"`
+	HTMLURL   string `json:"html_url"`
+	UploadURL string `json:"upload_url"`
+	Assets    []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"assets"`
+}
+
+// GitHubRelease creates or updates GitHub release of the version and uploads files to it.
+// Token is taken from GITHUB_TOKEN environment variable. Release is marked as prerelease
+// if the version contains prerelease part.
+func GitHubRelease(ctx context.Context, config GitHubReleaseConfig) error {
+	log := logger.Get(ctx)
+
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return errors.New("GITHUB_TOKEN environment variable is not set")
+	}
+	if config.Repository == "" {
+		var err error
+		config.Repository, err = githubRepository(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if config.Tag == "" {
+		version, err := Version(ctx)
+		if err != nil {
+			return err
+		}
+		if !version.Released() {
+			return errors.Errorf("HEAD is not tagged with version, current version is %s", version)
+		}
+		config.Tag = version.Tag
+	}
+	if config.Changelog == "" {
+		config.Changelog = ChangelogFile
+	}
+	semVer, err := ParseSemVer(config.Tag)
+	if err != nil {
+		return err
+	}
+	body, err := changelogSection(config.Changelog, config.Tag)
+	if err != nil {
+		return err
+	}
+	if body == "" {
+		log.Warn("Changelog does not contain section of the version", zap.String("path", config.Changelog),
+			zap.String("version", config.Tag))
+	}
+
+	apiURL := strings.TrimSuffix(os.Getenv("GITHUB_API_URL"), "/")
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+	releasesURL := apiURL + "/repos/" + config.Repository + "/releases"
+	if skipInDryRun(ctx, "Publishing GitHub release", zap.String("repository", config.Repository),
+		zap.String("tag", config.Tag), zap.Strings("files", config.Files)) {
+		return nil
+	}
+
+	request := map[string]interface{}{
+		"tag_name":   config.Tag,
+		"name":       config.Tag,
+		"body":       body,
+		"draft":      config.Draft,
+		"prerelease": semVer.Prerelease != "",
+	}
+	var release githubRelease
+	status, err := githubRequest(ctx, http.MethodGet, releasesURL+"/tags/"+url.PathEscape(config.Tag), token, nil,
+		&release)
+	switch {
+	case err != nil:
+		return err
+	case status == http.StatusNotFound:
+		log.Info("Creating GitHub release", zap.String("repository", config.Repository),
+			zap.String("tag", config.Tag))
+		_, err = githubRequest(ctx, http.MethodPost, releasesURL, token, request, &release)
+	default:
+		log.Info("Updating GitHub release", zap.String("repository", config.Repository),
+			zap.String("tag", config.Tag))
+		_, err = githubRequest(ctx, http.MethodPatch, fmt.Sprintf("%s/%d", releasesURL, release.ID), token, request,
+			&release)
+	}
+	if err != nil {
+		return err
+	}
+
+	existingAssets := map[string]int64{}
+	for _, asset := range release.Assets {
+		existingAssets[asset.Name] = asset.ID
+	}
+	uploadURL, _, _ := strings.Cut(release.UploadURL, "{")
+	for _, file := range config.Files {
+		name := filepath.Base(file)
+		if id, exists := existingAssets[name]; exists {
+			if _, err := githubRequest(ctx, http.MethodDelete, fmt.Sprintf("%s/assets/%d", releasesURL, id), token,
+				nil, nil); err != nil {
+				return err
+			}
+		}
+
+		log.Info("Uploading release asset", zap.String("path", file))
+		if err := githubUploadAsset(ctx, uploadURL+"?name="+url.QueryEscape(name), token, file); err != nil {
+			return err
+		}
+	}
+
+	log.Info("GitHub release published", zap.String("url", release.HTMLURL))
+	return nil
+}
+
+// githubRepository returns the GitHub repository in owner/name format
+func githubRepository(ctx context.Context) (string, error) {
+	if repository := os.Getenv("GITHUB_REPOSITORY"); repository != "" {
+		return repository, nil
+	}
+	remote, err := gitOutput(ctx, "remote", "get-url", "origin")
+	if err != nil {
+		return "", err
+	}
+
+	// Both git@github.com:owner/name.git and https://github.com/owner/name.git formats are used
+	repository := strings.TrimSuffix(remote, ".git")
+	for _, prefix := range []string{"git@github.com:", "ssh://git@github.com/", "https://github.com/"} {
+		if strings.HasPrefix(repository, prefix) {
+			return strings.TrimPrefix(repository, prefix), nil
+		}
+	}
+	return "", errors.Errorf("origin remote '%s' is not a GitHub repository", remote)
+}
+
+// changelogSection returns the content of the changelog section of the version, empty string is returned
+// if there is no such section
+func changelogSection(changelog, version string) (string, error) {
+	content, err := os.ReadFile(changelog)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.WithStack(err)
+	}
+
+	var section []string
+	var found bool
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "## ") {
+			if found {
+				break
+			}
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "## "), " - ")
+			found = name == version || "v"+name == version
+			continue
+		}
+		if found {
+			section = append(section, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(section, "\n")), nil
+}
+
+// githubRequest sends the request to GitHub API, request is encoded to JSON and response is decoded into result.
+// Status 404 of GET request is returned without error, so missing resources may be detected.
+func githubRequest(ctx context.Context, method, endpoint, token string, request, result interface{}) (int, error) {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return githubDo(req, result)
+}
+
+// githubUploadAsset uploads the file as the asset of the release
+func githubUploadAsset(ctx context.Context, uploadURL, token, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, f)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	_, err = githubDo(req, nil)
+	return err
+}
+
+func githubDo(req *http.Request, result interface{}) (int, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && req.Method == http.MethodGet {
+		return resp.StatusCode, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp.StatusCode, errors.Errorf("GitHub request %s %s failed, status: %s, response: %s", req.Method,
+			req.URL, resp.Status, message)
+	}
+	if result == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, errors.WithStack(json.NewDecoder(resp.Body).Decode(result))
+}
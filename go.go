@@ -1,133 +1,2103 @@
 package buildgo
 
 import (
+	"bytes"
 	"context"
+	"debug/elf"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
 	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
 
 	"github.com/outofforest/build"
-	"github.com/outofforest/libexec"
 	"github.com/outofforest/logger"
+	"github.com/outofforest/parallel"
 	"github.com/pkg/errors"
 	"github.com/ridge/must"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
+// Platform defines the target platform of the build
+type Platform struct {
+	// OS is the target operating system (GOOS)
+	OS string
+
+	// Arch is the target architecture (GOARCH)
+	Arch string
+}
+
+// String returns the platform in the os/arch form
+func (p Platform) String() string {
+	if p == (Platform{}) {
+		return "host"
+	}
+	return p.OS + "/" + p.Arch
+}
+
+// Commonly used platforms
+var (
+	PlatformLinuxAMD64   = Platform{OS: "linux", Arch: "amd64"}
+	PlatformLinuxARM64   = Platform{OS: "linux", Arch: "arm64"}
+	PlatformDarwinAMD64  = Platform{OS: "darwin", Arch: "amd64"}
+	PlatformDarwinARM64  = Platform{OS: "darwin", Arch: "arm64"}
+	PlatformWindowsAMD64 = Platform{OS: "windows", Arch: "amd64"}
+	PlatformJSWASM       = Platform{OS: "js", Arch: "wasm"}
+)
+
+// ParsePlatform parses platform defined in the os/arch form
+func ParsePlatform(platform string) (Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, errors.Errorf("invalid platform '%s', expected os/arch", platform)
+	}
+	return Platform{OS: parts[0], Arch: parts[1]}, nil
+}
+
+// DefaultNameTemplate is the name template producing names unique for each platform
+const DefaultNameTemplate = "{{.Name}}-{{.GOOS}}-{{.GOARCH}}{{.Ext}}"
+
+// BuildMode defines the build mode passed to go compiler
+type BuildMode string
+
+// Supported build modes
+const (
+	BuildModeDefault  BuildMode = ""
+	BuildModeCShared  BuildMode = "c-shared"
+	BuildModeCArchive BuildMode = "c-archive"
+)
+
+// BuildConfig is the configuration of go package build
+type BuildConfig struct {
+	// Package is the path to the package to build
+	Package string
+
+	// Binary is the path to the produced binary
+	Binary string
+
+	// CGOEnabled enables CGO
+	CGOEnabled bool
+
+	// Tags is the list of build tags
+	Tags []string
+
+	// Platform is the target platform, host platform is used if empty
+	Platform Platform
+
+	// VersionPackage is the import path of the package containing version variables.
+	// If set, version information taken from git is injected into the binary.
+	// See VersionInfo for the names of the variables.
+	VersionPackage string
+
+	// LDFlags is the list of linker flags appended to the default ones
+	LDFlags []string
+
+	// NoDefaultLDFlags disables default linker flags stripping symbols and debug information
+	NoDefaultLDFlags bool
+
+	// GCFlags is the list of compiler flags
+	GCFlags []string
+
+	// BuildMode is the build mode, c-shared and c-archive modes require CGO to be enabled.
+	// In those modes C header file is generated next to the library.
+	BuildMode BuildMode
+
+	// Static produces fully static binary. If CGO is enabled, binary is linked externally using musl-gcc
+	// or compiler set in CC. Absence of dynamic interpreter is verified for ELF binaries only.
+	Static bool
+
+	// CC is the C compiler used by CGO, it overrides the one set by registered C toolchain
+	CC string
+
+	// ChecksumFile is the path to the file where SHA256 checksums of produced binaries are stored
+	ChecksumFile string
+
+	// Reproducible disables VCS stamping and build ID, scrubs environment-dependent variables
+	// and pins SOURCE_DATE_EPOCH to the time of the last commit
+	Reproducible bool
+
+	// VerifyReproducible builds the binary twice and fails if outputs differ, it implies Reproducible
+	VerifyReproducible bool
+
+	// Race produces binary instrumented with race detector, it implies CGO.
+	// "-race" suffix is added to the name of the binary.
+	Race bool
+
+	// Cover produces binary instrumented for coverage analysis,
+	// use GoCoverageCollect to collect data written to GOCOVERDIR. Atomic mode is used, like in GoTest.
+	Cover bool
+
+	// CoverPackages is the list of package patterns to instrument, main module is instrumented if empty
+	CoverPackages []string
+
+	// SplitDebugInfo builds binary with symbols, extracts debug information to the file with .debug
+	// extension stored next to the binary and strips the binary. It requires objcopy.
+	SplitDebugInfo bool
+
+	// NameTemplate is the text/template used to compute the name of the binary.
+	// Available fields are: Name (base name of Binary without extension), GOOS, GOARCH and Ext
+	// (".exe" on windows, extension of Binary otherwise).
+	NameTemplate string
+
+	// SkipUnchanged skips the build if binary exists and sources of the local packages it is built from,
+	// go.mod and go.sum files, build configuration and go version haven't changed since the binary was built
+	SkipUnchanged bool
+}
+
 // GoBuildPkg builds go package
 func GoBuildPkg(ctx context.Context, pkg, out string, cgo bool, tags ...string) error {
-	logger.Get(ctx).Info("Building go package", zap.String("package", pkg), zap.String("binary", out))
+	return GoBuild(ctx, BuildConfig{
+		Package:    pkg,
+		Binary:     out,
+		CGOEnabled: cgo,
+		Tags:       tags,
+	})
+}
+
+// GoBuild builds go package using provided configuration
+func GoBuild(ctx context.Context, config BuildConfig) error {
+	isCMode := config.BuildMode == BuildModeCShared || config.BuildMode == BuildModeCArchive
+	if isCMode && !config.CGOEnabled {
+		return errors.Errorf("build mode '%s' requires CGO to be enabled", config.BuildMode)
+	}
+	if config.VerifyReproducible {
+		config.Reproducible = true
+	}
+	if config.Race {
+		config.CGOEnabled = true
+	}
+	var err error
+	config.Tags, err = withRepoTags(config.Tags)
+	if err != nil {
+		return err
+	}
+	config.Binary, err = outputBinary(config)
+	if err != nil {
+		return err
+	}
+
+	log := logger.Get(ctx)
+
+	rc, err := newRemoteCache()
+	if err != nil {
+		return err
+	}
+
+	var inputsHash string
+	if config.SkipUnchanged || rc != nil {
+		inputsHash, err = buildInputsHash(ctx, config)
+		if err != nil {
+			return err
+		}
+	}
+	if config.SkipUnchanged {
+		upToDate, err := isBuildUpToDate(config.Binary, inputsHash)
+		if err != nil {
+			return err
+		}
+		if upToDate {
+			log.Info("Binary is up to date", zap.String("package", config.Package),
+				zap.String("binary", config.Binary))
+			return writeBuildChecksum(ctx, config)
+		}
+	}
+
+	var cacheKey string
+	if rc != nil {
+		cacheKey, err = remoteCacheKey(ctx, "build", inputsHash)
+		if err != nil {
+			return err
+		}
+		if rc.Restore(ctx, cacheKey) {
+			log.Info("Binary restored from remote cache", zap.String("package", config.Package),
+				zap.String("binary", config.Binary))
+			return finishBuild(ctx, config, inputsHash)
+		}
+	}
+
+	log.Info("Building go package", zap.String("package", config.Package),
+		zap.String("binary", config.Binary), zap.Stringer("platform", config.Platform))
+
+	start := time.Now()
+	buildErr := goBuild(ctx, config, config.Binary)
+	err = recordTarget(ctx, targetRun{Target: "build", Start: start, Err: buildErr, Artifacts: []string{config.Binary}})
+	if err := multierr.Combine(buildErr, err); err != nil {
+		return err
+	}
+	if dryRun() {
+		return nil
+	}
+	if isCMode {
+		header := strings.TrimSuffix(config.Binary, filepath.Ext(config.Binary)) + ".h"
+		if _, err := os.Stat(header); err != nil {
+			return errors.Wrapf(err, "header file '%s' has not been generated", header)
+		}
+	}
+	if config.Static {
+		if err := verifyStatic(config.Binary, config.Platform); err != nil {
+			return err
+		}
+	}
+	if config.VerifyReproducible {
+		if err := verifyReproducible(ctx, config); err != nil {
+			return err
+		}
+	}
+	if config.SplitDebugInfo {
+		if err := splitDebugInfo(ctx, config.Binary); err != nil {
+			return err
+		}
+	}
+	if rc != nil {
+		outputs := []string{config.Binary}
+		if isCMode {
+			outputs = append(outputs, strings.TrimSuffix(config.Binary, filepath.Ext(config.Binary))+".h")
+		}
+		if config.SplitDebugInfo {
+			outputs = append(outputs, config.Binary+".debug")
+		}
+		rc.Store(ctx, cacheKey, outputs...)
+	}
+	return finishBuild(ctx, config, inputsHash)
+}
+
+// finishBuild stores the hash of build inputs, adds binary to the job summary and writes its checksum
+func finishBuild(ctx context.Context, config BuildConfig, inputsHash string) error {
+	if config.SkipUnchanged {
+		if err := storeBuildHash(config.Binary, inputsHash); err != nil {
+			return err
+		}
+	}
+	if err := summarizeBinary(config.Binary, config.Platform); err != nil {
+		return err
+	}
+	return writeBuildChecksum(ctx, config)
+}
+
+func writeBuildChecksum(ctx context.Context, config BuildConfig) error {
+	if config.ChecksumFile == "" || skipInDryRun(ctx, "Writing checksum", zap.String("path", config.ChecksumFile)) {
+		return nil
+	}
+	return WriteChecksums(config.ChecksumFile, config.Binary)
+}
+
+// GoBuildMatrix builds go package for all the provided platforms in parallel.
+// Binaries are named using DefaultNameTemplate unless NameTemplate is set. If no platform is provided,
+// platforms defined in the repository configuration are used.
+func GoBuildMatrix(ctx context.Context, config BuildConfig, platforms ...Platform) error {
+	if len(platforms) == 0 {
+		var err error
+		platforms, err = repoPlatforms()
+		if err != nil {
+			return err
+		}
+		if len(platforms) == 0 {
+			return errors.New("no platforms to build for")
+		}
+	}
+
+	configs := make([]BuildConfig, 0, len(platforms))
+	binaries := make([]string, 0, len(platforms))
+	for _, platform := range platforms {
+		cfg := config
+		cfg.Platform = platform
+		cfg.ChecksumFile = ""
+		if cfg.NameTemplate == "" {
+			cfg.NameTemplate = DefaultNameTemplate
+		}
+		binary, err := outputBinary(cfg)
+		if err != nil {
+			return err
+		}
+		configs = append(configs, cfg)
+		binaries = append(binaries, binary)
+	}
+	if err := GoBuildParallel(ctx, 0, configs...); err != nil {
+		return err
+	}
+	if config.ChecksumFile != "" {
+		return WriteChecksums(config.ChecksumFile, binaries...)
+	}
+	return nil
+}
+
+// GoBuildParallel builds packages concurrently. At most limit builds are run at the same time,
+// if limit is 0, GOMAXPROCS is used. All the builds are executed even if some of them fail,
+// returned error aggregates all the failures.
+func GoBuildParallel(ctx context.Context, limit int, configs ...BuildConfig) error {
+	if limit <= 0 {
+		limit = runtime.GOMAXPROCS(0)
+	}
+
+	var mu sync.Mutex
+	var errs error
+	semaphore := make(chan struct{}, limit)
+	err := parallel.Run(ctx, func(ctx context.Context, spawn parallel.SpawnFn) error {
+		for _, config := range configs {
+			config := config
+			spawn(config.Binary, parallel.Continue, func(ctx context.Context) error {
+				select {
+				case <-ctx.Done():
+					return errors.WithStack(ctx.Err())
+				case semaphore <- struct{}{}:
+				}
+				defer func() {
+					<-semaphore
+				}()
+
+				if err := GoBuild(ctx, config); err != nil {
+					mu.Lock()
+					defer mu.Unlock()
+					errs = multierr.Append(errs, err)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errs
+}
+
+// GoBuildWasm builds go package for js/wasm platform and copies wasm_exec.js next to the binary
+func GoBuildWasm(ctx context.Context, config BuildConfig) error {
+	config.Platform = PlatformJSWASM
+	if err := GoBuild(ctx, config); err != nil {
+		return err
+	}
+
+	goRoot, err := goEnv(ctx, "GOROOT")
+	if err != nil {
+		return err
+	}
+	// wasm_exec.js was moved from misc/wasm to lib/wasm in go 1.24
+	for _, dir := range []string{"lib/wasm", "misc/wasm"} {
+		src := filepath.Join(goRoot, dir, "wasm_exec.js")
+		if _, err := os.Stat(src); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		dst := filepath.Join(filepath.Dir(config.Binary), "wasm_exec.js")
+		if skipInDryRun(ctx, "Copying wasm_exec.js", zap.String("path", dst)) {
+			return nil
+		}
+		return copyFile(src, dst)
+	}
+	return errors.Errorf("wasm_exec.js not found in GOROOT '%s'", goRoot)
+}
+
+// GoBuildAllCmds builds all main packages matching patterns in every module.
+// Patterns are relative to module directory, "cmd/*" is used if none is provided.
+// Binaries are stored in outDir and named after package directories.
+func GoBuildAllCmds(ctx context.Context, config BuildConfig, outDir string, patterns ...string) error {
+	if len(patterns) == 0 {
+		patterns = []string{"cmd/*"}
+	}
+
+	binaries := map[string]string{}
+	err := onModule(ctx, func(path string) error {
+		for _, pattern := range patterns {
+			pkgs, err := filepath.Glob(filepath.Join(path, pattern))
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			for _, pkg := range pkgs {
+				isMain, err := isMainPackage(pkg)
+				if err != nil {
+					return err
+				}
+				if !isMain {
+					continue
+				}
+				name := filepath.Base(pkg)
+				if prevPkg, exists := binaries[name]; exists {
+					return errors.Errorf("packages '%s' and '%s' produce the same binary '%s'", prevPkg, pkg, name)
+				}
+				binaries[name] = pkg
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	configs := make([]BuildConfig, 0, len(binaries))
+	for name, pkg := range binaries {
+		cfg := config
+		cfg.Package = pkg
+		cfg.Binary = filepath.Join(outDir, name)
+		configs = append(configs, cfg)
+	}
+	return GoBuildParallel(ctx, 0, configs...)
+}
+
+// GoRun builds go package into temporary location and runs it with provided arguments
+func GoRun(ctx context.Context, pkg string, args ...string) error {
+	tmpDir, err := os.MkdirTemp("", "buildgo-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	binary := filepath.Join(tmpDir, filepath.Base(must.String(filepath.Abs(pkg))))
+	if err := GoBuild(ctx, BuildConfig{Package: pkg, Binary: binary}); err != nil {
+		return err
+	}
+
+	logger.Get(ctx).Info("Running go package", zap.String("package", pkg), zap.Strings("args", args))
+	if err := execCmds(ctx, exec.Command(binary, args...)); err != nil {
+		return errors.Wrapf(err, "running go package '%s' failed", pkg)
+	}
+	return nil
+}
+
+// GoInstallPkg builds go package and installs the binary in binDir. If binDir is empty,
+// GOBIN is used, falling back to GOPATH/bin. Binary is named after the package directory.
+func GoInstallPkg(ctx context.Context, pkg, binDir string, tags ...string) error {
+	if binDir == "" {
+		var err error
+		binDir, err = goBinDir(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return GoBuild(ctx, BuildConfig{
+		Package: pkg,
+		Binary:  filepath.Join(binDir, filepath.Base(must.String(filepath.Abs(pkg)))),
+		Tags:    tags,
+	})
+}
+
+// ReplaceAllowlist is the file containing paths of modules which may be replaced in go.mod, one per line
+const ReplaceAllowlist = "build/.replace-allowlist"
+
+// DefaultGolangCIConfig is the default path to the configuration of golangci linter
+const DefaultGolangCIConfig = "build/.golangci.yaml"
+
+// embeddedGolangCIConfig is the configuration of golangci linter used if repository does not provide one
+//
+//go:embed golangci.yaml
+var embeddedGolangCIConfig []byte
+
+// golangCIModuleConfigs are the names of files overriding linter configuration in the module
+var golangCIModuleConfigs = []string{".golangci.yaml", ".golangci.yml"}
+
+// LintConfig is the configuration of linter
+type LintConfig struct {
+	// ConfigFile is the path to golangci configuration, DefaultGolangCIConfig is used if empty.
+	// If file does not exist, configuration embedded in buildgo is used.
+	// Modules containing their own .golangci.yaml or .golangci.yml use that file instead.
+	ConfigFile string
+
+	// Fix applies fixes of the findings, go mod tidy and git status checks are skipped then
+	Fix bool
+
+	// BaseRef is the git reference, if set only modules affected by changes made since then are linted.
+	// If empty, value of BUILDGO_BASE_REF environment variable is used.
+	BaseRef string
+
+	// GitStatusIgnore is the list of patterns of paths ignored by git status check, see GitStatusConfig
+	GitStatusIgnore []string
+}
+
+// GoLint runs golangci linter, checks that go.mod files are tidy and vendor directories are consistent
+// if vendoring is enabled, scans files for secrets
+// and checks that git tree is clean
+func GoLint(ctx context.Context, deps build.DepsFunc) error {
+	return GoLintWithConfig(ctx, deps, LintConfig{})
+}
+
+// GoLintFix runs golangci linter applying fixes of the findings
+func GoLintFix(ctx context.Context, deps build.DepsFunc) error {
+	return GoLintWithConfig(ctx, deps, LintConfig{Fix: true})
+}
+
+// GoLintWithConfig runs golangci linter using provided configuration
+func GoLintWithConfig(ctx context.Context, deps build.DepsFunc, config LintConfig) error {
+	if err := EnsureTools(ctx, "go", "golangci"); err != nil {
+		return err
+	}
+	if err := golangCILint(ctx, config); err != nil {
+		return err
+	}
+	if config.Fix {
+		return nil
+	}
+	deps(GoModReplace, GoModTidyCheck)
+	repoConfig, err := LoadRepoConfig()
+	if err != nil {
+		return err
+	}
+	if repoConfig.Vendor {
+		deps(GoModVendorCheck)
+	}
+	if err := SecretsScanWithConfig(ctx, SecretsScanConfig{BaseRef: config.BaseRef}); err != nil {
+		return err
+	}
+	return GitStatusCleanWithConfig(ctx, GitStatusConfig{Ignore: config.GitStatusIgnore})
+}
+
+// GoLintInitConfig stores golangci configuration embedded in buildgo in DefaultGolangCIConfig,
+// so it may be used as a starting point. Existing file is not overwritten.
+func GoLintInitConfig(ctx context.Context) error {
+	if fileExists(DefaultGolangCIConfig) {
+		return errors.Errorf("file '%s' already exists", DefaultGolangCIConfig)
+	}
+	logger.Get(ctx).Info("Storing default linter configuration", zap.String("path", DefaultGolangCIConfig))
+	if dryRun() {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(DefaultGolangCIConfig), 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(DefaultGolangCIConfig, embeddedGolangCIConfig, 0o644))
+}
+
+func golangCILint(ctx context.Context, config LintConfig) error {
+	log := logger.Get(ctx)
+	if config.ConfigFile == "" {
+		config.ConfigFile = DefaultGolangCIConfig
+	}
+	if !fileExists(config.ConfigFile) {
+		log.Info("Linter configuration does not exist, using the embedded one", zap.String("path",
+			config.ConfigFile))
+		config.ConfigFile = filepath.Join("bin", ".golangci.yaml")
+		if !skipInDryRun(ctx, "Storing embedded linter configuration", zap.String("path", config.ConfigFile)) {
+			if err := os.MkdirAll(filepath.Dir(config.ConfigFile), 0o755); err != nil {
+				return errors.WithStack(err)
+			}
+			if err := os.WriteFile(config.ConfigFile, embeddedGolangCIConfig, 0o600); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	defaultConfigFile := must.String(filepath.Abs(config.ConfigFile))
+
+	affected, err := affectedModules(ctx, config.BaseRef)
+	if err != nil {
+		return err
+	}
+	rc, err := newRemoteCache()
+	if err != nil {
+		return err
+	}
+
+	return onModuleParallel(ctx, 1, continueOnError("lint", func(ctx context.Context, path string) error {
+		if affected != nil && !affected[path] {
+			return nil
+		}
+
+		configFile := defaultConfigFile
+		for _, name := range golangCIModuleConfigs {
+			if moduleConfigFile := filepath.Join(path, name); fileExists(moduleConfigFile) {
+				configFile = must.String(filepath.Abs(moduleConfigFile))
+				break
+			}
+		}
+
+		// Fixes modify files, so they are never restored from the cache
+		var cacheKey string
+		if rc != nil && !config.Fix {
+			cacheKey, err = lintCacheKey(ctx, path, configFile)
+			if err != nil {
+				return err
+			}
+			if rc.Restore(ctx, cacheKey) {
+				log.Info("Linter results restored from remote cache", zap.String("path", path))
+				return nil
+			}
+		}
+
+		log.Info("Running linter", zap.String("path", path), zap.String("config", configFile),
+			zap.Bool("fix", config.Fix))
+		args := []string{"run", "--config", configFile}
+		if config.Fix {
+			args = append(args, "--fix")
+		}
+		buf := &bytes.Buffer{}
+		cmd := exec.Command("golangci-lint", args...)
+		cmd.Dir = path
+		if githubActions() {
+			cmd.Stdout = io.MultiWriter(os.Stdout, buf)
+		}
+		start := time.Now()
+		lintErr := execCmds(ctx, cmd)
+		if err := recordTarget(ctx, targetRun{Target: "lint", Module: path, Start: start, Err: lintErr}); err != nil {
+			return multierr.Combine(lintErr, err)
+		}
+		if lintErr != nil {
+			if githubActions() {
+				annotateGoLocations("Linter", path, buf.String())
+			}
+			return errors.Wrapf(lintErr, "linter errors found in module '%s'", path)
+		}
+		if cacheKey != "" {
+			rc.Store(ctx, cacheKey)
+		}
+		return nil
+	}))
+}
+
+// lintCacheKey returns the key of remote cache entry storing linter results of the module
+func lintCacheKey(ctx context.Context, path, configFile string) (string, error) {
+	moduleHash, err := moduleContentHash(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	config, err := os.ReadFile(configFile)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	toolRegistryMu.Lock()
+	tool := toolRegistry["golangci"]
+	toolRegistryMu.Unlock()
+
+	tool, err = withRepoToolVersion(tool)
+	if err != nil {
+		return "", err
+	}
+	return remoteCacheKey(ctx, "lint", moduleHash, tool.Version, string(config))
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Build tags selecting test suites
+const (
+	IntegrationTestTag = "integration"
+	E2ETestTag         = "e2e"
+)
+
+// TestConfig is the configuration of go tests
+type TestConfig struct {
+	// Name is the name of the test suite, used to distinguish coverage profiles and test reports
+	Name string
+
+	// Tags is the list of build tags
+	Tags []string
+
+	// DisableRace disables race detector. It is also disabled if BUILDGO_RACE environment variable is set to false
+	// or if race detector is not supported on the platform.
+	DisableRace bool
+
+	// MinCoverage is the minimum coverage percentage required in each module, 0 disables the check
+	MinCoverage float64
+
+	// ModuleMinCoverage overrides MinCoverage for modules, keys are module paths relative to repository root
+	ModuleMinCoverage map[string]float64
+
+	// JUnitDir is the directory where test results of each module are stored in JUnit XML format
+	JUnitDir string
+
+	// Timeout is the timeout of tests in each package, go default is used if 0
+	Timeout time.Duration
+
+	// Run is the regular expression selecting tests to run
+	Run string
+
+	// Count is the number of times each test is run, 1 is used if 0
+	Count int
+
+	// Flags is the list of additional flags passed to go test
+	Flags []string
+
+	// PackageFlags is the list of additional flags for packages, keys are package import paths.
+	// Those packages are tested separately from the rest of the module.
+	PackageFlags map[string][]string
+
+	// Retries is the number of times failed tests are rerun, tests passing on retry are reported as flaky
+	Retries int
+
+	// QuarantineFile is the file containing names of known flaky tests in the <package>.<test> form.
+	// Failures of those tests are reported but don't fail the build.
+	QuarantineFile string
+
+	// Parallelism is the maximum number of modules tested concurrently, modules are tested one by one if 0
+	Parallelism int
+
+	// Services is the list of services started before and stopped after the tests
+	Services []TestService
+
+	// ShuffleSeed is the seed used to shuffle tests. If 0, value of BUILDGO_SHUFFLE_SEED environment variable
+	// is used or the random one is generated. Seed is printed so failing order might be replayed.
+	ShuffleSeed int64
+
+	// ProfileDir is the directory where CPU and memory profiles of each package are stored.
+	// If set, each package is tested separately.
+	ProfileDir string
+
+	// ProfileTop is the number of top entries of each profile rendered to text summary, 0 disables summaries
+	ProfileTop int
+
+	// CoverageExclude is the list of patterns excluding packages and files from coverage analysis.
+	// Patterns use path.Match syntax and are matched against import paths and all their trailing subpaths,
+	// e.g. "*.pb.go" excludes all protobuf files and "mocks" excludes all the mocks packages.
+	CoverageExclude []string
+
+	// BaseRef is the git reference, if set only modules affected by changes made since then are tested.
+	// If empty, value of BUILDGO_BASE_REF environment variable is used.
+	BaseRef string
+}
+
+// GoTest runs go test
+func GoTest(ctx context.Context, deps build.DepsFunc, tags ...string) error {
+	return GoTestWithConfig(ctx, deps, TestConfig{Tags: tags})
+}
+
+// GoTestUnit runs unit tests
+func GoTestUnit(ctx context.Context, deps build.DepsFunc) error {
+	return GoTestWithConfig(ctx, deps, TestConfig{
+		Name: "unit",
+	})
+}
+
+// GoTestIntegration runs tests defined in files tagged with IntegrationTestTag
+func GoTestIntegration(ctx context.Context, deps build.DepsFunc) error {
+	return GoTestWithConfig(ctx, deps, TestConfig{
+		Name:    "integration",
+		Tags:    []string{IntegrationTestTag},
+		Timeout: 30 * time.Minute,
+	})
+}
+
+// GoTestE2E runs tests defined in files tagged with E2ETestTag. Race detector is disabled to keep
+// timing of the system close to the production one.
+func GoTestE2E(ctx context.Context, deps build.DepsFunc) error {
+	return GoTestWithConfig(ctx, deps, TestConfig{
+		Name:        "e2e",
+		Tags:        []string{E2ETestTag},
+		DisableRace: true,
+		Timeout:     time.Hour,
+	})
+}
+
+// GoTestWithConfig runs go test using provided configuration
+func GoTestWithConfig(ctx context.Context, deps build.DepsFunc, config TestConfig) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+
+	repoConfig, err := LoadRepoConfig()
+	if err != nil {
+		return err
+	}
+	config.Tags, err = withRepoTags(config.Tags)
+	if err != nil {
+		return err
+	}
+	if config.MinCoverage == 0 {
+		config.MinCoverage = repoConfig.MinCoverage
+	}
+	if len(repoConfig.ModuleMinCoverage) > 0 {
+		moduleMinCoverage := map[string]float64{}
+		for path, minCoverage := range repoConfig.ModuleMinCoverage {
+			moduleMinCoverage[path] = minCoverage
+		}
+		for path, minCoverage := range config.ModuleMinCoverage {
+			moduleMinCoverage[path] = minCoverage
+		}
+		config.ModuleMinCoverage = moduleMinCoverage
+	}
+
+	rootDir := must.String(filepath.EvalSymlinks(must.String(filepath.Abs(".."))))
+	repoDir := must.String(filepath.EvalSymlinks(must.String(filepath.Abs("."))))
+	coverageDir := filepath.Join(repoDir, coverageSubDir)
+	if !dryRun() {
+		if err := os.MkdirAll(coverageDir, 0o700); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	quarantine, err := readListFile(config.QuarantineFile)
+	if err != nil {
+		return err
+	}
+
+	if !config.DisableRace {
+		supported, err := raceSupported(ctx)
+		if err != nil {
+			return err
+		}
+		config.DisableRace = !supported
+	}
+
+	if config.ShuffleSeed == 0 {
+		if v := os.Getenv("BUILDGO_SHUFFLE_SEED"); v != "" {
+			config.ShuffleSeed, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return errors.Wrapf(err, "invalid value '%s' of BUILDGO_SHUFFLE_SEED", v)
+			}
+		} else {
+			config.ShuffleSeed = time.Now().UnixNano()
+		}
+	}
+	log.Info("Tests are shuffled", zap.Int64("seed", config.ShuffleSeed))
+
+	env := os.Environ()
+	if len(config.Services) > 0 {
+		serviceEnv, stopServices, err := startTestServices(ctx, config.Services)
+		if err != nil {
+			return err
+		}
+		defer stopServices()
+		env = append(env, serviceEnv...)
+	}
+
+	affected, err := affectedModules(ctx, config.BaseRef)
+	if err != nil {
+		return err
+	}
+
+	rc, err := newRemoteCache()
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var results []*testResult
+	defer func() {
+		if !dryRun() && verbosity() != verbosityQuiet {
+			printTestSummary(results)
+		}
+	}()
+
+	return onModuleParallel(ctx, config.Parallelism, continueOnError("test", func(ctx context.Context, path string) error {
+		if affected != nil && !affected[path] {
+			return nil
+		}
+
+		// When modules are tested in parallel, output is buffered and printed once module is tested
+		var out io.Writer = os.Stdout
+		if config.Parallelism > 1 {
+			buf := &lockedBuffer{}
+			defer func() {
+				mu.Lock()
+				defer mu.Unlock()
+				_, _ = buf.WriteTo(os.Stdout)
+			}()
+			out = buf
+		}
+
+		relPath, err := filepath.Rel(rootDir, must.String(filepath.EvalSymlinks(must.String(filepath.Abs(path)))))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		reportName := strings.ReplaceAll(relPath, "/", "-")
+		if config.Name != "" {
+			reportName += "-" + config.Name
+		}
+		runs, err := testRuns(ctx, path, filepath.Join(coverageDir, reportName), config)
+		if err != nil {
+			return err
+		}
+
+		coverPkgs := []string{"./..."}
+		if len(config.CoverageExclude) > 0 {
+			pkgs, err := goListPackages(ctx, path, config.Tags)
+			if err != nil {
+				return err
+			}
+			coverPkgs = coveredPackages(pkgs, config.CoverageExclude)
+			if len(coverPkgs) == 0 {
+				log.Info("All packages are excluded from coverage", zap.String("path", path))
+			}
+		}
+
+		// Coverage is not collected if all the packages are excluded
+		var coverageProfiles []string
+		if len(coverPkgs) > 0 {
+			for _, run := range runs {
+				coverageProfiles = append(coverageProfiles, run.CoverageProfile)
+			}
+		}
+		var junitFile string
+		if config.JUnitDir != "" {
+			junitFile = filepath.Join(config.JUnitDir, reportName+".xml")
+		}
+
+		var cacheKey string
+		if rc != nil {
+			cacheKey, err = testCacheKey(ctx, path, config, quarantine)
+			if err != nil {
+				return err
+			}
+			if rc.Restore(ctx, cacheKey) {
+				log.Info("Test results restored from remote cache", zap.String("path", path))
+				return checkModuleCoverage(ctx, path, config, coverageProfiles)
+			}
+		}
+
+		parser := newTestEventParser(out)
+		start := time.Now()
+		var testErr error
+		for _, run := range runs {
+			args := []string{"test"}
+			if len(coverPkgs) > 0 {
+				args = append(args,
+					"-cover",
+					"-coverpkg", strings.Join(coverPkgs, ","),
+					"-coverprofile", run.CoverageProfile,
+				)
+			}
+			args = append(args, testArgs(config, config.Run, run.Flags)...)
+
+			log.Info("Running go tests", zap.String("path", path), zap.Strings("packages", run.Packages))
+			cmd := exec.Command("go", append(args, run.Packages...)...)
+			cmd.Dir = path
+			cmd.Env = env
+			cmd.Stdout = parser
+			cmd.Stderr = out
+			if err := execCmds(ctx, cmd); err != nil && testErr == nil {
+				testErr = err
+			}
+		}
+		if dryRun() {
+			return nil
+		}
+		if testErr != nil && (config.Retries > 0 || len(quarantine) > 0) {
+			testErr = retryFailedTests(ctx, path, env, config, quarantine, parser, testErr)
+		}
+		mu.Lock()
+		results = append(results, parser.Results()...)
+		mu.Unlock()
+		err = recordTarget(ctx, targetRun{Target: "test", Module: path, Start: start, Err: testErr,
+			Artifacts: coverageProfiles})
+		if err != nil {
+			return err
+		}
+		if testErr != nil && githubActions() {
+			if err := annotateTestFailures(ctx, path, parser.Results()); err != nil {
+				return err
+			}
+			if err := summarizeTestFailures(parser.Results()); err != nil {
+				return err
+			}
+		}
+		if config.ProfileDir != "" && config.ProfileTop > 0 {
+			if err := renderProfiles(ctx, runs, config.ProfileTop); err != nil {
+				return err
+			}
+		}
+		if junitFile != "" {
+			if err := writeJUnitReport(junitFile, parser.Results()); err != nil {
+				return err
+			}
+		}
+		if testErr != nil {
+			return errors.Wrapf(testErr, "unit tests failed in module '%s'", path)
+		}
+		if cacheKey != "" {
+			outputs := coverageProfiles
+			if junitFile != "" {
+				outputs = append(append([]string{}, outputs...), junitFile)
+			}
+			rc.Store(ctx, cacheKey, outputs...)
+		}
+		return checkModuleCoverage(ctx, path, config, coverageProfiles)
+	}))
+}
+
+// checkModuleCoverage adds coverage of the module to the job summary and verifies it is not below the threshold.
+// Coverage is not checked if there are no profiles, because all the packages are excluded from it.
+func checkModuleCoverage(ctx context.Context, path string, config TestConfig, coverageProfiles []string) error {
+	if len(coverageProfiles) == 0 {
+		return nil
+	}
+	minCoverage, exists := config.ModuleMinCoverage[path]
+	if !exists {
+		minCoverage = config.MinCoverage
+	}
+	if minCoverage <= 0 && githubStepSummary() == "" {
+		return nil
+	}
+	total, pkgs, err := moduleCoverage(ctx, path, config.CoverageExclude, coverageProfiles...)
+	if err != nil {
+		return err
+	}
+	if err := summarizeCoverage(path, total); err != nil {
+		return err
+	}
+	if minCoverage > 0 {
+		return checkCoverage(ctx, path, minCoverage, total, pkgs)
+	}
+	return nil
+}
+
+// coveredPackages returns packages not matching any of the exclude patterns
+func coveredPackages(pkgs, exclude []string) []string {
+	var covered []string
+	for _, pkg := range pkgs {
+		if !matchesAny(exclude, pkg) {
+			covered = append(covered, pkg)
+		}
+	}
+	return covered
+}
+
+// testCacheKey returns the key of remote cache entry storing test results of the module
+func testCacheKey(ctx context.Context, path string, config TestConfig, quarantine map[string]bool) (string, error) {
+	moduleHash, err := moduleContentHash(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	// Settings not affecting results of the tests
+	config.ShuffleSeed = 0
+	config.Parallelism = 0
+	config.BaseRef = ""
+	config.ProfileDir = ""
+	config.ProfileTop = 0
+	config.MinCoverage = 0
+	config.ModuleMinCoverage = nil
+	// Paths are relative, so keys are the same on all machines
+	config.JUnitDir = repoRelativePath(config.JUnitDir)
+	config.QuarantineFile = repoRelativePath(config.QuarantineFile)
+	return remoteCacheKey(ctx, "test", moduleHash, fmt.Sprintf("%#v", config),
+		strings.Join(sortedKeys(quarantine), ","))
+}
+
+// testArgs returns arguments passed to go test, common to all invocations
+func testArgs(config TestConfig, run string, flags []string) []string {
+	args := []string{
+		"-shuffle=" + strconv.FormatInt(config.ShuffleSeed, 10),
+		"-json",
+	}
+	if !config.DisableRace {
+		args = append(args, "-race")
+	}
+	if config.Count > 0 {
+		args = append(args, "-count="+strconv.Itoa(config.Count))
+	} else {
+		args = append(args, "-count=1")
+	}
+	if config.Timeout > 0 {
+		args = append(args, "-timeout="+config.Timeout.String())
+	}
+	if run != "" {
+		args = append(args, "-run="+run)
+	}
+	if len(config.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(config.Tags, ","))
+	}
+	args = append(args, config.Flags...)
+	return append(args, flags...)
+}
+
+// retryFailedTests reruns failed tests up to config.Retries times. Tests passing on retry are reported as flaky.
+// Failures of quarantined tests are reported but tolerated.
+func retryFailedTests(ctx context.Context, path string, env []string, config TestConfig,
+	quarantine map[string]bool, parser *testEventParser, testErr error,
+) error {
+	log := logger.Get(ctx)
+
+	failed, ok := failedTests(parser.Results())
+	if !ok {
+		// Some packages failed for other reason than failing test, e.g. build error
+		return testErr
+	}
+	for i := 0; i < config.Retries && len(failed) > 0; i++ {
+		for _, pkg := range sortedKeys(failed) {
+			tests := failed[pkg]
+			log.Info("Retrying failed tests", zap.String("package", pkg), zap.Strings("tests", tests),
+				zap.Int("attempt", i+1))
+
+			args := append([]string{"test"}, testArgs(config, "^("+strings.Join(tests, "|")+")$",
+				config.PackageFlags[pkg])...)
+			cmd := exec.Command("go", append(args, pkg)...)
+			cmd.Dir = path
+			cmd.Env = env
+			cmd.Stdout = parser
+			cmd.Stderr = parser.out
+			// Error is ignored because results are taken from the parser
+			_ = execCmds(ctx, cmd)
+		}
+
+		stillFailed, ok := failedTests(parser.Results())
+		if !ok {
+			return testErr
+		}
+		for pkg, tests := range failed {
+			for _, test := range tests {
+				if !contains(stillFailed[pkg], test) {
+					log.Warn("Flaky test passed on retry", zap.String("test", pkg+"."+test))
+				}
+			}
+		}
+		failed = stillFailed
+	}
+
+	var notQuarantined []string
+	for _, pkg := range sortedKeys(failed) {
+		for _, test := range failed[pkg] {
+			name := pkg + "." + test
+			if quarantine[name] {
+				log.Warn("Quarantined test failed", zap.String("test", name))
+				continue
+			}
+			notQuarantined = append(notQuarantined, name)
+		}
+	}
+	if len(notQuarantined) > 0 {
+		return errors.Wrapf(testErr, "tests failed: %s", strings.Join(notQuarantined, ", "))
+	}
+	return nil
+}
+
+// failedTests returns failed top-level tests grouped by package. False is returned if any package
+// failed without failing test.
+func failedTests(results []*testResult) (map[string][]string, bool) {
+	failed := map[string][]string{}
+	failedPkgs := map[string]bool{}
+	for _, result := range results {
+		if result.Action != "fail" {
+			continue
+		}
+		if result.Test == "" {
+			failedPkgs[result.Package] = true
+			continue
+		}
+		if !strings.Contains(result.Test, "/") {
+			failed[result.Package] = append(failed[result.Package], result.Test)
+		}
+	}
+	for pkg := range failedPkgs {
+		if len(failed[pkg]) == 0 {
+			return nil, false
+		}
+	}
+	return failed, true
+}
+
+// readListFile reads the file containing one item per line. Empty lines and lines starting with # are ignored.
+// Empty list is returned if file name is empty.
+func readListFile(file string) (map[string]bool, error) {
+	list := map[string]bool{}
+	if file == "" {
+		return list, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading file '%s' failed", file)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			list[line] = true
+		}
+	}
+	return list, nil
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+// raceSupported checks if race detector should be used
+func raceSupported(ctx context.Context) (bool, error) {
+	log := logger.Get(ctx)
+
+	if v := os.Getenv("BUILDGO_RACE"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid value '%s' of BUILDGO_RACE", v)
+		}
+		if !enabled {
+			log.Warn("Race detector disabled by BUILDGO_RACE")
+		}
+		return enabled, nil
+	}
+
+	cgoEnabled, err := goEnv(ctx, "CGO_ENABLED")
+	if err != nil {
+		return false, err
+	}
+	if cgoEnabled != "1" {
+		log.Warn("Race detector disabled because CGO is disabled")
+		return false, nil
+	}
+
+	goOS, err := goEnv(ctx, "GOOS")
+	if err != nil {
+		return false, err
+	}
+	goArch, err := goEnv(ctx, "GOARCH")
+	if err != nil {
+		return false, err
+	}
+	switch goOS + "/" + goArch {
+	case "linux/amd64", "linux/arm64", "linux/ppc64le", "linux/s390x", "darwin/amd64", "darwin/arm64",
+		"freebsd/amd64", "netbsd/amd64", "windows/amd64":
+		return true, nil
+	default:
+		log.Warn("Race detector disabled because it is not supported on the platform",
+			zap.String("platform", goOS+"/"+goArch))
+		return false, nil
+	}
+}
+
+// Names of files stored in the profile directory of the package
+const (
+	testBinaryFile = "test.bin"
+	cpuProfileFile = "cpu.pprof"
+	memProfileFile = "mem.pprof"
+)
+
+// renderProfiles stores top entries of collected profiles in text files
+func renderProfiles(ctx context.Context, runs []testRun, top int) error {
+	for _, run := range runs {
+		if run.ProfileDir == "" {
+			continue
+		}
+		binary := filepath.Join(run.ProfileDir, testBinaryFile)
+		for _, profile := range []string{cpuProfileFile, memProfileFile} {
+			profilePath := filepath.Join(run.ProfileDir, profile)
+			if _, err := os.Stat(profilePath); err != nil {
+				// Profile is not produced if package has no tests
+				continue
+			}
+
+			f, err := os.OpenFile(strings.TrimSuffix(profilePath, ".pprof")+".top.txt",
+				os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			cmd := exec.Command("go", "tool", "pprof", "-top", "-nodecount="+strconv.Itoa(top), binary, profilePath)
+			cmd.Stdout = f
+			err = execCmds(ctx, cmd)
+			_ = f.Close()
+			if err != nil {
+				return errors.Wrapf(err, "rendering profile '%s' failed", profilePath)
+			}
+		}
+	}
+	return nil
+}
+
+// testRun is a single invocation of go test
+type testRun struct {
+	Packages        []string
+	Flags           []string
+	CoverageProfile string
+	ProfileDir      string
+}
+
+// testRuns splits packages of the module into go test invocations. Packages having custom flags are tested
+// separately.
+func testRuns(ctx context.Context, path, coverageProfile string, config TestConfig) ([]testRun, error) {
+	if len(config.PackageFlags) == 0 && config.ProfileDir == "" {
+		return []testRun{{Packages: []string{"./..."}, CoverageProfile: coverageProfile}}, nil
+	}
+
+	pkgs, err := goListPackages(ctx, path, config.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []testRun
+	var defaultPkgs []string
+	for _, pkg := range pkgs {
+		flags, exists := config.PackageFlags[pkg]
+		if !exists && config.ProfileDir == "" {
+			defaultPkgs = append(defaultPkgs, pkg)
+			continue
+		}
+		var profileDir string
+		if config.ProfileDir != "" {
+			profileDir = must.String(filepath.Abs(filepath.Join(config.ProfileDir, pkg)))
+			if !dryRun() {
+				if err := os.MkdirAll(profileDir, 0o700); err != nil {
+					return nil, errors.WithStack(err)
+				}
+			}
+			flags = append([]string{
+				"-o", filepath.Join(profileDir, testBinaryFile),
+				"-cpuprofile", filepath.Join(profileDir, cpuProfileFile),
+				"-memprofile", filepath.Join(profileDir, memProfileFile),
+			}, flags...)
+		}
+		runs = append(runs, testRun{
+			Packages:        []string{pkg},
+			Flags:           flags,
+			CoverageProfile: coverageProfile + "-" + strings.ReplaceAll(pkg, "/", "-"),
+			ProfileDir:      profileDir,
+		})
+	}
+	if len(defaultPkgs) > 0 {
+		runs = append([]testRun{{Packages: defaultPkgs, CoverageProfile: coverageProfile}}, runs...)
+	}
+	return runs, nil
+}
+
+func goListPackages(ctx context.Context, path string, tags []string) ([]string, error) {
+	args := []string{"list"}
+	if len(tags) > 0 {
+		args = append(args, "-tags", strings.Join(tags, ","))
+	}
+
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", append(args, "./...")...)
+	cmd.Dir = path
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return nil, errors.Wrapf(err, "listing packages in module '%s' failed", path)
+	}
+	return strings.Fields(buf.String()), nil
+}
+
+// GoModTidyCheck verifies that go.mod and go.sum files are tidy, without modifying them.
+// `go mod tidy` is executed on their temporary copies and required changes are printed.
+func GoModTidyCheck(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+
+	var untidy []string
+	err := onModule(ctx, func(path string) error {
+		log.Info("Checking go mod tidy", zap.String("path", path))
+
+		tmpDir, err := os.MkdirTemp("", "buildgo-tidy-*")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		files := []string{"go.mod", "go.sum"}
+		for _, file := range files {
+			if !fileExists(filepath.Join(path, file)) {
+				continue
+			}
+			if err := copyFile(filepath.Join(path, file), filepath.Join(tmpDir, file)); err != nil {
+				return err
+			}
+		}
+
+		cmd := exec.Command("go", "mod", "tidy", "-modfile", filepath.Join(tmpDir, "go.mod"))
+		cmd.Dir = path
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "'go mod tidy' failed in module '%s'", path)
+		}
+
+		for _, file := range files {
+			original, err := os.ReadFile(filepath.Join(path, file))
+			if err != nil && !os.IsNotExist(err) {
+				return errors.WithStack(err)
+			}
+			tidy, err := os.ReadFile(filepath.Join(tmpDir, file))
+			if err != nil && !os.IsNotExist(err) {
+				return errors.WithStack(err)
+			}
+			if bytes.Equal(original, tidy) {
+				continue
+			}
+
+			untidy = append(untidy, filepath.Join(path, file))
+			// git diff returns non-zero exit code when files differ
+			cmd := exec.Command("git", "diff", "--no-index", "--", filepath.Join(path, file), filepath.Join(tmpDir, file))
+			_ = execCmds(ctx, cmd)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(untidy) > 0 {
+		return errors.Errorf("files are not tidy, run 'go mod tidy': %s", strings.Join(untidy, ", "))
+	}
+	return nil
+}
+
+// GoModTidy calls `go mod tidy`
+func GoModTidy(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+	return onModule(ctx, func(path string) error {
+		log.Info("Running go mod tidy", zap.String("path", path))
+		cmd := exec.Command("go", "mod", "tidy")
+		cmd.Dir = path
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "'go mod tidy' failed in module '%s'", path)
+		}
+		return nil
+	})
+}
+
+// GoModDownload downloads dependencies of all the modules concurrently, so module cache may be warmed up
+// separately from building and testing
+func GoModDownload(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+	return onModuleParallel(ctx, runtime.GOMAXPROCS(0), func(ctx context.Context, path string) error {
+		log.Info("Downloading dependencies", zap.String("path", path))
+		cmd := exec.Command("go", "mod", "download", "all")
+		cmd.Dir = path
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "downloading dependencies of module '%s' failed", path)
+		}
+		return nil
+	})
+}
+
+// GoModVerify verifies that dependencies of all modules have expected content, go.sum contains all the required
+// checksums and is committed
+func GoModVerify(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+	return onModule(ctx, func(path string) error {
+		log.Info("Running go mod verify", zap.String("path", path))
+
+		buf := &bytes.Buffer{}
+		cmd := exec.Command("go", "list", "-mod=readonly", "-m", "all")
+		cmd.Dir = path
+		cmd.Stdout = buf
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "listing dependencies of module '%s' failed", path)
+		}
+		if len(strings.Split(strings.TrimSpace(buf.String()), "\n")) > 1 {
+			goSum := filepath.Join(path, "go.sum")
+			if !fileExists(goSum) {
+				return errors.Errorf("go.sum is missing in module '%s'", path)
+			}
+			status, err := gitOutput(ctx, "status", "--porcelain", "--ignored", "--", goSum)
+			if err != nil {
+				return err
+			}
+			if status != "" {
+				return errors.Errorf("go.sum is not committed in module '%s'", path)
+			}
+		}
+
+		cmd1 := exec.Command("go", "mod", "verify")
+		cmd1.Dir = path
+		cmd2 := exec.Command("go", "list", "-mod=readonly", "-deps", "-test", "./...")
+		cmd2.Dir = path
+		cmd2.Stdout = io.Discard
+		if err := execCmds(ctx, cmd1, cmd2); err != nil {
+			return errors.Wrapf(err, "verifying dependencies of module '%s' failed", path)
+		}
+		return nil
+	})
+}
+
+// GoModReplace fails if go.mod of any module contains replace directive pointing to local path or fork,
+// unless replaced module is allowed in ReplaceAllowlist
+func GoModReplace(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+
+	var allowlistFile string
+	if fileExists(ReplaceAllowlist) {
+		allowlistFile = ReplaceAllowlist
+	}
+	allowlist, err := readListFile(allowlistFile)
+	if err != nil {
+		return err
+	}
+
+	return onModule(ctx, func(path string) error {
+		goMod, err := readGoMod(ctx, path)
+		if err != nil {
+			return err
+		}
+
+		var replaced []string
+		for _, r := range goMod.Replace {
+			if allowlist[r.Old.Path] || (r.New.Version != "" && r.New.Path == r.Old.Path) {
+				continue
+			}
+			replaced = append(replaced, fmt.Sprintf("%s => %s", r.Old.Path, strings.TrimSpace(r.New.Path+" "+r.New.Version)))
+		}
+		if len(replaced) > 0 {
+			return errors.Errorf("go.mod of module '%s' contains forbidden replace directives: %s", path,
+				strings.Join(replaced, ", "))
+		}
+		return nil
+	})
+}
+
+// goModFile is the content of go.mod reported by `go mod edit -json`
+type goModFile struct {
+	Module struct {
+		Path string
+	}
+	Require []struct {
+		Path    string
+		Version string
+	}
+	Replace []struct {
+		Old struct{ Path, Version string }
+		New struct{ Path, Version string }
+	}
+}
+
+func readGoMod(ctx context.Context, path string) (goModFile, error) {
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", "mod", "edit", "-json")
+	cmd.Dir = path
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return goModFile{}, errors.Wrapf(err, "reading go.mod of module '%s' failed", path)
+	}
+
+	var goMod goModFile
+	if err := json.Unmarshal(buf.Bytes(), &goMod); err != nil {
+		return goModFile{}, errors.Wrapf(err, "parsing go.mod of module '%s' failed", path)
+	}
+	return goMod, nil
+}
+
+// startupExecutable is the state of the executable file taken when the process started, it is used to detect
+// that the binary has been replaced since then
+var startupExecutable = executableInfo()
+
+// rebuildMe rebuilds the build tool if its sources changed and restarts the process if running binary is stale
+func rebuildMe(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	binary := must.String(filepath.EvalSymlinks(must.String(os.Executable())))
+	if err := GoBuild(ctx, BuildConfig{
+		Package:       "build/cmd",
+		Binary:        binary,
+		SkipUnchanged: true,
+	}); err != nil {
+		return err
+	}
+
+	// Path is resolved before building because os.Executable reports path of the removed file after replacing it
+	current, err := os.Stat(binary)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if startupExecutable == nil ||
+		(os.SameFile(startupExecutable, current) && startupExecutable.ModTime().Equal(current.ModTime())) {
+		return nil
+	}
+
+	// Rerun with the same arguments, new process finds the binary up to date, so it does not restart again
+	logger.Get(ctx).Info("Build tool binary is stale, restarting", zap.String("binary", binary))
+	return restartProcess(binary)
+}
+
+// restartProcess replaces the current process with the one running the binary. Windows does not support exec,
+// so there the binary is run as the child process and the current one exits with its exit code.
+func restartProcess(binary string) error {
+	if runtime.GOOS != "windows" {
+		return errors.WithStack(syscall.Exec(binary, os.Args, os.Environ()))
+	}
+
+	cmd := exec.Command(binary, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return errors.WithStack(err)
+		}
+		os.Exit(exitErr.ExitCode())
+	}
+	os.Exit(0)
+	return nil
+}
+
+func executableInfo() os.FileInfo {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	info, err := os.Stat(executable)
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+func goEnv(ctx context.Context, name string) (string, error) {
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", "env", name)
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return "", errors.Wrapf(err, "reading go env '%s' failed", name)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func goModulePath(ctx context.Context, path string) (string, error) {
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", "list", "-m")
+	cmd.Dir = path
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return "", errors.Wrapf(err, "reading path of module '%s' failed", path)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func goBinDir(ctx context.Context) (string, error) {
+	goBin, err := goEnv(ctx, "GOBIN")
+	if err != nil {
+		return "", err
+	}
+	if goBin != "" {
+		return goBin, nil
+	}
+	goPath, err := goEnv(ctx, "GOPATH")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.SplitList(goPath)[0], "bin"), nil
+}
+
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer dstFile.Close()
+
+	_, err = io.Copy(dstFile, srcFile)
+	return errors.WithStack(err)
+}
+
+func goBuild(ctx context.Context, config BuildConfig, binary string) error {
+	var ldflags []string
+	if !config.NoDefaultLDFlags && !config.SplitDebugInfo {
+		ldflags = append(ldflags, "-w", "-s")
+	}
+	if config.Reproducible {
+		ldflags = append(ldflags, "-buildid=")
+	}
+	ldflags = append(ldflags, config.LDFlags...)
+	cc := config.CC
+	if config.Static && config.CGOEnabled {
+		if cc == "" {
+			cc = "musl-gcc"
+		}
+		ldflags = append(ldflags, "-linkmode", "external", "-extldflags", "-static")
+	}
+
+	var sourceDateEpoch int64
+	if config.Reproducible {
+		var err error
+		sourceDateEpoch, err = gitSourceDateEpoch(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if config.VersionPackage != "" {
+		info, err := GitVersionInfo(ctx)
+		if err != nil {
+			return err
+		}
+		if config.Reproducible {
+			info.BuildDate = time.Unix(sourceDateEpoch, 0).UTC().Format(time.RFC3339)
+		}
+		ldflags = append(ldflags, info.LDFlags(config.VersionPackage)...)
+	}
 
 	args := []string{
 		"build",
 		"-trimpath",
-		"-ldflags=-w -s",
-		"-o", must.String(filepath.Abs(out)),
+		"-ldflags=" + strings.Join(ldflags, " "),
+		"-o", must.String(filepath.Abs(binary)),
 	}
-	if len(tags) > 0 {
-		args = append(args, "-tags", strings.Join(tags, ","))
+	if config.Reproducible {
+		args = append(args, "-buildvcs=false")
+	}
+	if config.Race {
+		args = append(args, "-race")
+	}
+	if config.Cover {
+		args = append(args, "-cover", "-covermode=atomic")
+		if len(config.CoverPackages) > 0 {
+			args = append(args, "-coverpkg", strings.Join(config.CoverPackages, ","))
+		}
+	}
+	if len(config.GCFlags) > 0 {
+		args = append(args, "-gcflags="+strings.Join(config.GCFlags, " "))
+	}
+	if config.BuildMode != BuildModeDefault {
+		args = append(args, "-buildmode="+string(config.BuildMode))
+	}
+	if len(config.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(config.Tags, ","))
 	}
 
 	cmd := exec.Command("go", append(args, ".")...)
-	cmd.Dir = pkg
-	if !cgo {
-		cmd.Env = append([]string{"CGO_ENABLED=0"}, os.Environ()...)
+	cmd.Dir = config.Package
+	cmd.Env = os.Environ()
+	if config.Reproducible {
+		cmd.Env = reproducibleEnv(cmd.Env, sourceDateEpoch)
 	}
-	if err := libexec.Exec(ctx, cmd); err != nil {
-		return errors.Wrapf(err, "building go package '%s' failed", pkg)
+	if config.CGOEnabled {
+		// CGO is disabled by default when cross-compiling
+		cmd.Env = append(cmd.Env, "CGO_ENABLED=1")
+		cmd.Env = append(cmd.Env, cToolchainEnv(config.Platform)...)
+	} else {
+		cmd.Env = append(cmd.Env, "CGO_ENABLED=0")
+	}
+	if config.Platform.OS != "" {
+		cmd.Env = append(cmd.Env, "GOOS="+config.Platform.OS)
+	}
+	if config.Platform.Arch != "" {
+		cmd.Env = append(cmd.Env, "GOARCH="+config.Platform.Arch)
+	}
+	if cc != "" {
+		cmd.Env = append(cmd.Env, "CC="+cc)
+	}
+	if err := execCmds(ctx, cmd); err != nil {
+		return errors.Wrapf(err, "building go package '%s' failed", config.Package)
 	}
 	return nil
 }
 
-// GoLint runs golangci linter, runs go mod tidy and checks that git tree is clean
-func GoLint(ctx context.Context, deps build.DepsFunc) error {
-	deps(EnsureGo, EnsureGolangCI)
-	log := logger.Get(ctx)
-	config := must.String(filepath.Abs("build/.golangci.yaml"))
-	err := onModule(func(path string) error {
-		log.Info("Running linter", zap.String("path", path))
-		cmd := exec.Command("golangci-lint", "run", "--config", config)
-		cmd.Dir = path
-		if err := libexec.Exec(ctx, cmd); err != nil {
-			return errors.Wrapf(err, "linter errors found in module '%s'", path)
+// reproducibleEnv removes variables which might affect the build in environment-dependent way
+// and pins SOURCE_DATE_EPOCH.
+func reproducibleEnv(env []string, sourceDateEpoch int64) []string {
+	result := make([]string, 0, len(env)+1)
+	for _, v := range env {
+		switch strings.SplitN(v, "=", 2)[0] {
+		case "GOFLAGS", "CGO_CFLAGS", "CGO_CPPFLAGS", "CGO_CXXFLAGS", "CGO_LDFLAGS", "SOURCE_DATE_EPOCH":
+			continue
 		}
-		return nil
-	})
-	if err != nil {
-		return err
+		result = append(result, v)
 	}
-	deps(GoModTidy, gitStatusClean)
-	return nil
+	return append(result, fmt.Sprintf("SOURCE_DATE_EPOCH=%d", sourceDateEpoch))
 }
 
-// GoTest runs go test
-func GoTest(ctx context.Context, deps build.DepsFunc, tags ...string) error {
-	deps(EnsureGo)
-	log := logger.Get(ctx)
+func verifyReproducible(ctx context.Context, config BuildConfig) error {
+	logger.Get(ctx).Info("Verifying that build is reproducible", zap.String("package", config.Package))
 
-	rootDir := must.String(filepath.EvalSymlinks(must.String(filepath.Abs(".."))))
-	repoDir := must.String(filepath.EvalSymlinks(must.String(filepath.Abs("."))))
-	coverageDir := filepath.Join(repoDir, "bin", ".coverage")
-	if err := os.MkdirAll(coverageDir, 0o700); err != nil {
+	tmpDir, err := os.MkdirTemp("", "buildgo-*")
+	if err != nil {
 		return errors.WithStack(err)
 	}
+	defer os.RemoveAll(tmpDir)
 
-	return onModule(func(path string) error {
-		relPath, err := filepath.Rel(rootDir, must.String(filepath.EvalSymlinks(must.String(filepath.Abs(path)))))
+	binary := filepath.Join(tmpDir, filepath.Base(config.Binary))
+	if err := goBuild(ctx, config, binary); err != nil {
+		return err
+	}
+
+	checksum1, err := fileChecksum(config.Binary)
+	if err != nil {
+		return err
+	}
+	checksum2, err := fileChecksum(binary)
+	if err != nil {
+		return err
+	}
+	if checksum1 != checksum2 {
+		return errors.Errorf("build of package '%s' is not reproducible", config.Package)
+	}
+	return nil
+}
+
+func isMainPackage(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, entry.Name()), nil, parser.PackageClauseOnly)
 		if err != nil {
-			return errors.WithStack(err)
+			return false, errors.WithStack(err)
 		}
+		return f.Name.Name == "main", nil
+	}
+	return false, nil
+}
 
-		args := []string{
-			"test",
-			"-count=1",
-			"-shuffle=on",
-			"-race",
-			"-cover", "./...",
-			"-coverpkg", "./...",
-			"-coverprofile", filepath.Join(coverageDir, strings.ReplaceAll(relPath, "/", "-")),
-		}
-		if len(tags) > 0 {
-			args = append(args, "-tags", strings.Join(tags, ","))
+func splitDebugInfo(ctx context.Context, binary string) error {
+	debugFile := binary + ".debug"
+	logger.Get(ctx).Info("Extracting debug information", zap.String("binary", binary),
+		zap.String("debugFile", debugFile))
+
+	extractCmd := exec.Command("objcopy", "--only-keep-debug", binary, debugFile)
+	stripCmd := exec.Command("objcopy", "--strip-debug", "--strip-unneeded",
+		"--add-gnu-debuglink="+debugFile, binary)
+	if err := execCmds(ctx, extractCmd, stripCmd); err != nil {
+		return errors.Wrapf(err, "extracting debug information from '%s' failed", binary)
+	}
+	return nil
+}
+
+// verifyStatic verifies that ELF binary does not require dynamic interpreter
+func verifyStatic(binary string, platform Platform) error {
+	goOS := platform.OS
+	if goOS == "" {
+		goOS = runtime.GOOS
+	}
+	switch goOS {
+	case "linux", "android", "freebsd", "netbsd", "openbsd", "dragonfly", "solaris", "illumos":
+	default:
+		// Binaries for other systems are not in ELF format
+		return nil
+	}
+
+	f, err := elf.Open(binary)
+	if err != nil {
+		return errors.Wrapf(err, "opening ELF binary '%s' failed", binary)
+	}
+	defer f.Close()
+
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_INTERP {
+			return errors.Errorf("binary '%s' is not static, it requires dynamic interpreter", binary)
 		}
+	}
+	return nil
+}
 
-		log.Info("Running go tests", zap.String("path", path))
-		cmd := exec.Command("go", append(args, "./...")...)
-		cmd.Dir = path
-		if err := libexec.Exec(ctx, cmd); err != nil {
-			return errors.Wrapf(err, "unit tests failed in module '%s'", path)
+// outputBinary returns the path of the binary produced by the build
+func outputBinary(config BuildConfig) (string, error) {
+	ext := filepath.Ext(config.Binary)
+	name := strings.TrimSuffix(filepath.Base(config.Binary), ext)
+	if config.Race {
+		name += "-race"
+	}
+	if config.NameTemplate == "" {
+		return filepath.Join(filepath.Dir(config.Binary), name+ext), nil
+	}
+
+	tmpl, err := template.New("name").Parse(config.NameTemplate)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid name template '%s'", config.NameTemplate)
+	}
+
+	goOS := config.Platform.OS
+	if goOS == "" {
+		goOS = runtime.GOOS
+	}
+	goArch := config.Platform.Arch
+	if goArch == "" {
+		goArch = runtime.GOARCH
+	}
+	if goOS == "windows" {
+		ext = ".exe"
+	}
+
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, struct {
+		Name   string
+		GOOS   string
+		GOARCH string
+		Ext    string
+	}{
+		Name:   name,
+		GOOS:   goOS,
+		GOARCH: goArch,
+		Ext:    ext,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "executing name template '%s' failed", config.NameTemplate)
+	}
+	return filepath.Join(filepath.Dir(config.Binary), buf.String()), nil
+}
+
+// onModuleParallel runs fn for modules concurrently, at most limit at the same time.
+// If limit is lower than 2, modules are processed one by one.
+func onModuleParallel(ctx context.Context, limit int, fn func(ctx context.Context, path string) error) error {
+	if limit < 2 {
+		return selectedModules(ctx, func(path string) error {
+			return tracedModule(ctx, path, fn)
+		})
+	}
+
+	var paths []string
+	if err := selectedModules(ctx, func(path string) error {
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	semaphore := make(chan struct{}, limit)
+	return parallel.Run(ctx, func(ctx context.Context, spawn parallel.SpawnFn) error {
+		for _, path := range paths {
+			path := path
+			spawn(path, parallel.Continue, func(ctx context.Context) error {
+				select {
+				case <-ctx.Done():
+					return errors.WithStack(ctx.Err())
+				case semaphore <- struct{}{}:
+				}
+				defer func() {
+					<-semaphore
+				}()
+
+				return tracedModule(ctx, path, fn)
+			})
 		}
 		return nil
 	})
 }
 
-// GoModTidy calls `go mod tidy`
-func GoModTidy(ctx context.Context, deps build.DepsFunc) error {
-	deps(EnsureGo)
-	log := logger.Get(ctx)
-	return onModule(func(path string) error {
-		log.Info("Running go mod tidy", zap.String("path", path))
-		cmd := exec.Command("go", "mod", "tidy")
-		cmd.Dir = path
-		if err := libexec.Exec(ctx, cmd); err != nil {
-			return errors.Wrapf(err, "'go mod tidy' failed in module '%s'", path)
+// tracedModule runs fn for the module, the module iteration is recorded as a span
+func tracedModule(ctx context.Context, path string, fn func(ctx context.Context, path string) error) error {
+	ctx, endSpan := startSpan(ctx, "module "+path, stringAttribute("module", path))
+	err := fn(ctx, path)
+	endSpan(err)
+	return err
+}
+
+// lockedBuffer is the buffer safe for concurrent use
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write writes data to the buffer
+func (b *lockedBuffer) Write(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(data)
+}
+
+// WriteTo writes content of the buffer to w
+func (b *lockedBuffer) WriteTo(w io.Writer) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.WriteTo(w)
+}
+
+// ModuleExcludes is the list of glob patterns of directories skipped while discovering modules.
+// Pattern is matched against the name of the directory and against its slash-separated path relative
+// to the repository root.
+var ModuleExcludes = []string{".git", "vendor", "testdata", "node_modules"}
+
+// onModule runs fn for each module of the repository selected by BUILDGO_MODULES environment variable,
+// see selectedModules. Every module iteration is recorded as a span.
+func onModule(ctx context.Context, fn func(path string) error) error {
+	return selectedModules(ctx, func(path string) error {
+		return tracedModule(ctx, path, func(ctx context.Context, path string) error {
+			return fn(path)
+		})
+	})
+}
+
+// selectedModules runs fn for each module of the repository selected by BUILDGO_MODULES environment variable.
+// It contains comma-separated list of module directories, directories containing modules or glob patterns
+// matching module directories. All the modules are selected if it is empty.
+func selectedModules(ctx context.Context, fn func(path string) error) error {
+	var selection []string
+	for _, pattern := range strings.Split(os.Getenv("BUILDGO_MODULES"), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			selection = append(selection, filepath.Clean(filepath.FromSlash(pattern)))
 		}
-		return nil
+	}
+	if len(selection) == 0 {
+		return repoModules(ctx, fn)
+	}
+
+	return repoModules(ctx, func(path string) error {
+		if !isModuleSelected(path, selection) {
+			return nil
+		}
+		return fn(path)
 	})
 }
 
-func rebuildMe(ctx context.Context, deps build.DepsFunc) error {
-	deps(EnsureGo)
-	return GoBuildPkg(ctx, "build/cmd", must.String(filepath.EvalSymlinks(must.String(os.Executable()))), false)
+func isModuleSelected(path string, selection []string) bool {
+	for _, pattern := range selection {
+		if pattern == "." || path == pattern || strings.HasPrefix(path, pattern+string(filepath.Separator)) {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// repoModules runs fn for each module of the repository. If go.work file exists, modules used by the workspace
+// are taken, otherwise the repository is searched for go.mod files.
+func repoModules(ctx context.Context, fn func(path string) error) error {
+	if !fileExists(goWorkFile) {
+		return walkModules(fn)
+	}
+
+	paths, err := goWorkModules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := fn(path); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func onModule(fn func(path string) error) error {
+// walkModules runs fn for each directory containing go.mod file, skipping the excluded ones
+func walkModules(fn func(path string) error) error {
+	config, err := LoadRepoConfig()
+	if err != nil {
+		return err
+	}
+	excludes := append(append([]string{}, ModuleExcludes...), config.ModuleExcludes...)
+
 	return filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
-		if d.IsDir() || d.Name() != "go.mod" {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if d.IsDir() {
+			if path != "." && isModuleDirExcluded(path, excludes) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
 			return nil
 		}
 		return fn(filepath.Dir(path))
 	})
 }
+
+func isModuleDirExcluded(path string, excludes []string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range excludes {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(filepath.FromSlash(pattern), path); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -3,18 +3,32 @@ module github.com/outofforest/buildgo
 go 1.19
 
 require (
+	github.com/google/go-containerregistry v0.20.2
 	github.com/outofforest/build v1.13.1
 	github.com/outofforest/libexec v0.3.9
 	github.com/outofforest/logger v0.4.0
+	github.com/outofforest/parallel v0.2.3
 	github.com/pkg/errors v0.9.1
 	github.com/ridge/must v0.6.0
+	go.uber.org/multierr v1.11.0
 	go.uber.org/zap v1.25.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/containerd/stargz-snapshotter/estargz v0.14.3 // indirect
+	github.com/docker/cli v27.1.1+incompatible // indirect
+	github.com/docker/distribution v2.8.2+incompatible // indirect
+	github.com/docker/docker-credential-helpers v0.7.0 // indirect
+	github.com/klauspost/compress v1.16.5 // indirect
+	github.com/mitchellh/go-homedir v1.1.0 // indirect
+	github.com/opencontainers/go-digest v1.0.0 // indirect
+	github.com/opencontainers/image-spec v1.1.0-rc3 // indirect
 	github.com/outofforest/ioc/v2 v2.5.2 // indirect
-	github.com/outofforest/parallel v0.2.3 // indirect
 	github.com/outofforest/run v0.6.0 // indirect
+	github.com/sirupsen/logrus v1.9.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	go.uber.org/multierr v1.11.0 // indirect
+	github.com/vbatts/tar-split v0.11.3 // indirect
+	golang.org/x/sync v0.2.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 )
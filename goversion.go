@@ -0,0 +1,135 @@
+package buildgo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GoVersion is the exact version of go installed by EnsureGo, e.g. "1.22.5". If empty, version is taken from
+// the repository configuration, then from toolchain directive of go.mod file in the root of the repository,
+// and if it is not present, the default one is used.
+var GoVersion string
+
+// goReleasesURL is the URL of the index containing all go releases with checksums of their files
+const goReleasesURL = "https://go.dev/dl/?mode=json&include=all"
+
+// goRelease is the go release reported by goReleasesURL
+type goRelease struct {
+	Version string `json:"version"`
+	Files   []struct {
+		Filename string `json:"filename"`
+		OS       string `json:"os"`
+		Arch     string `json:"arch"`
+		SHA256   string `json:"sha256"`
+		Kind     string `json:"kind"`
+	} `json:"files"`
+}
+
+// goToolchain returns the definition of go toolchain pinned by the repository
+func goToolchain(ctx context.Context) (Tool, error) {
+	version := GoVersion
+	if version == "" {
+		config, err := LoadRepoConfig()
+		if err != nil {
+			return Tool{}, err
+		}
+		version = config.Tools["go"]
+	}
+	if version == "" {
+		var err error
+		version, err = goModToolchain("go.mod")
+		if err != nil {
+			return Tool{}, err
+		}
+	}
+	version = strings.TrimPrefix(version, "go")
+
+	toolRegistryMu.Lock()
+	tool := toolRegistry["go"]
+	toolRegistryMu.Unlock()
+
+	if version == "" || version == tool.Version {
+		return tool, nil
+	}
+
+	return Tool{
+		Name:    tool.Name,
+		Version: version,
+		Resolve: func(ctx context.Context, platform Platform) (ToolArtifact, error) {
+			return goArtifact(ctx, version, platform)
+		},
+	}, nil
+}
+
+// goArtifact returns the artifact of go release for the platform
+func goArtifact(ctx context.Context, version string, platform Platform) (ToolArtifact, error) {
+	url, hash, err := goReleaseArchive(ctx, version, platform.OS, platform.Arch)
+	if err != nil {
+		return ToolArtifact{}, err
+	}
+	return ToolArtifact{
+		URL:  url,
+		Hash: "sha256:" + hash,
+		Binaries: map[string]string{
+			exeName("go", platform):    "go/bin/" + exeName("go", platform),
+			exeName("gofmt", platform): "go/bin/" + exeName("gofmt", platform),
+		},
+	}, nil
+}
+
+// goModToolchain returns the version of go set by toolchain directive of go.mod file
+func goModToolchain(goMod string) (string, error) {
+	return goModDirective(goMod, "toolchain")
+}
+
+// goModDirective returns the value of the single-line directive of go.mod file, empty string is returned
+// if file or directive does not exist
+func goModDirective(goMod, directive string) (string, error) {
+	f, err := os.Open(goMod)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == directive {
+			return strings.Trim(fields[1], `"`), nil
+		}
+	}
+	return "", errors.WithStack(scanner.Err())
+}
+
+// goReleaseArchive returns URL and SHA256 checksum of go release archive taken from the official index
+func goReleaseArchive(ctx context.Context, version, goOS, goArch string) (string, string, error) {
+	resp, err := toolsHTTPGet(ctx, goReleasesURL)
+	if err != nil {
+		return "", "", errors.Wrap(err, "fetching go releases failed")
+	}
+	defer resp.Body.Close()
+
+	var releases []goRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return "", "", errors.Wrap(err, "parsing go releases failed")
+	}
+	for _, release := range releases {
+		if release.Version != "go"+version {
+			continue
+		}
+		for _, file := range release.Files {
+			if file.Kind == "archive" && file.OS == goOS && file.Arch == goArch {
+				return "https://go.dev/dl/" + file.Filename, file.SHA256, nil
+			}
+		}
+	}
+	return "", "", errors.Errorf("go %s is not available for %s/%s", version, goOS, goArch)
+}
@@ -0,0 +1,48 @@
+package buildgo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"github.com/ridge/must"
+	"go.uber.org/zap"
+)
+
+// hermeticSubDir is the directory, relative to the repository root, where go state is stored in hermetic mode
+const hermeticSubDir = "bin/.cache/hermetic"
+
+// useHermetic isolates go commands from the global go state of the machine if BUILDGO_HERMETIC environment
+// variable is set to true. GOPATH, GOCACHE and GOMODCACHE are created in the bin directory of the repository
+// and go env file is ignored, so the build behaves like in the clean CI environment and removing bin directory
+// resets the state. Binaries installed by GoInstallPkg without explicit directory are stored in the isolated GOPATH.
+func useHermetic(ctx context.Context) error {
+	if os.Getenv("BUILDGO_HERMETIC") != "true" {
+		return nil
+	}
+
+	dir := must.String(filepath.Abs(hermeticSubDir))
+	env := map[string]string{
+		"GOPATH":     filepath.Join(dir, "gopath"),
+		"GOCACHE":    filepath.Join(dir, "gocache"),
+		"GOMODCACHE": filepath.Join(dir, "gomodcache"),
+		"GOENV":      "off",
+	}
+	for _, name := range sortedKeys(env) {
+		if err := os.Setenv(name, env[name]); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	// Module cache is read-only by default, making bin directory impossible to remove
+	if goFlags := os.Getenv("GOFLAGS"); !strings.Contains(goFlags, "-modcacherw") {
+		if err := os.Setenv("GOFLAGS", strings.TrimSpace(goFlags+" -modcacherw")); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	logger.Get(ctx).Debug("Hermetic go environment is used", zap.String("dir", dir))
+	return nil
+}
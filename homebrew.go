@@ -0,0 +1,208 @@
+package buildgo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// HomebrewConfig is the configuration of Homebrew formula
+type HomebrewConfig struct {
+	// Archive is the configuration used to create release archives by GoReleaseArchives, it is used to find them
+	Archive ArchiveConfig
+
+	// Name is the name of the formula, name of the binary is used if empty
+	Name string
+
+	// Description is the description of the formula
+	Description string
+
+	// Homepage is the URL of the project
+	Homepage string
+
+	// License is the SPDX identifier of the license
+	License string
+
+	// BaseURL is the URL archives are downloaded from. If empty, download URL of the GitHub release
+	// of the version tag is used.
+	BaseURL string
+
+	// File is the path where formula is stored, Formula/<name>.rb is used if empty.
+	// If Tap is set, path is relative to the tap repository.
+	File string
+
+	// Tap is the URL of git repository of the tap, if set, formula is committed and pushed to it.
+	// Credentials are taken from git configuration.
+	Tap string
+}
+
+// homebrewPlatforms are the platforms supported by Homebrew, mapped to the blocks of the formula
+var homebrewPlatforms = []struct {
+	Platform Platform
+	OS       string
+	Arch     string
+}{
+	{Platform: PlatformDarwinARM64, OS: "on_macos", Arch: "on_arm"},
+	{Platform: PlatformDarwinAMD64, OS: "on_macos", Arch: "on_intel"},
+	{Platform: PlatformLinuxARM64, OS: "on_linux", Arch: "on_arm"},
+	{Platform: PlatformLinuxAMD64, OS: "on_linux", Arch: "on_intel"},
+}
+
+// HomebrewFormula renders Homebrew formula installing the binary from release archives created
+// by GoReleaseArchives for darwin and linux platforms
+func HomebrewFormula(ctx context.Context, config HomebrewConfig, platforms ...Platform) error {
+	log := logger.Get(ctx)
+
+	if len(platforms) == 0 {
+		var err error
+		platforms, err = repoPlatforms()
+		if err != nil {
+			return err
+		}
+	}
+	binaryName := archiveBinaryName(config.Archive)
+	if config.Name == "" {
+		config.Name = binaryName
+	}
+	if config.File == "" {
+		config.File = filepath.Join("Formula", config.Name+".rb")
+	}
+
+	version, err := Version(ctx)
+	if err != nil {
+		return err
+	}
+	if config.BaseURL == "" {
+		if !version.Released() {
+			return errors.Errorf("HEAD is not tagged with version, current version is %s", version)
+		}
+		repository, err := githubRepository(ctx)
+		if err != nil {
+			return err
+		}
+		config.BaseURL = "https://github.com/" + repository + "/releases/download/" + version.Tag
+	}
+
+	formula := &strings.Builder{}
+	fmt.Fprintf(formula, "class %s < Formula\n", homebrewClassName(config.Name))
+	if config.Description != "" {
+		fmt.Fprintf(formula, "  desc %q\n", config.Description)
+	}
+	if config.Homepage != "" {
+		fmt.Fprintf(formula, "  homepage %q\n", config.Homepage)
+	}
+	fmt.Fprintf(formula, "  version %q\n", strings.TrimPrefix(version.String(), "v"))
+	if config.License != "" {
+		fmt.Fprintf(formula, "  license %q\n", config.License)
+	}
+
+	requested := map[Platform]bool{}
+	for _, platform := range platforms {
+		requested[platform] = true
+	}
+	var found bool
+	var osBlock string
+	for _, hp := range homebrewPlatforms {
+		if !requested[hp.Platform] {
+			continue
+		}
+		archive, _, err := releaseArchive(config.Archive, version.String(), hp.Platform)
+		if err != nil {
+			return err
+		}
+		checksum, err := fileChecksum(archive)
+		if err != nil {
+			return err
+		}
+
+		if hp.OS != osBlock {
+			if osBlock != "" {
+				formula.WriteString("  end\n")
+			}
+			fmt.Fprintf(formula, "\n  %s do\n", hp.OS)
+			osBlock = hp.OS
+		}
+		fmt.Fprintf(formula, "    %s do\n      url %q\n      sha256 %q\n    end\n", hp.Arch,
+			strings.TrimSuffix(config.BaseURL, "/")+"/"+filepath.Base(archive), checksum)
+		found = true
+	}
+	if !found {
+		return errors.New("no darwin or linux platforms to render formula for")
+	}
+	formula.WriteString("  end\n")
+	fmt.Fprintf(formula, "\n  def install\n    bin.install %q\n  end\nend\n", binaryName)
+
+	if config.Tap == "" {
+		log.Info("Storing Homebrew formula", zap.String("path", config.File))
+		if dryRun() {
+			return nil
+		}
+		return writeFormula(config.File, formula.String())
+	}
+	if skipInDryRun(ctx, "Pushing Homebrew formula", zap.String("tap", config.Tap), zap.String("path", config.File)) {
+		return nil
+	}
+
+	tapDir, err := os.MkdirTemp("", "buildgo-tap-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(tapDir)
+
+	if err := execCmds(ctx, exec.Command("git", "clone", "--depth", "1", config.Tap, tapDir)); err != nil {
+		return errors.Wrapf(err, "cloning tap '%s' failed", config.Tap)
+	}
+	if err := writeFormula(filepath.Join(tapDir, config.File), formula.String()); err != nil {
+		return err
+	}
+
+	status := exec.Command("git", "status", "--porcelain")
+	status.Dir = tapDir
+	changes, err := status.Output()
+	if err != nil {
+		return errors.Wrap(err, "checking tap status failed")
+	}
+	if len(changes) == 0 {
+		log.Info("Homebrew formula is up to date", zap.String("tap", config.Tap))
+		return nil
+	}
+
+	log.Info("Pushing Homebrew formula", zap.String("tap", config.Tap), zap.String("path", config.File))
+	for _, args := range [][]string{
+		{"add", config.File},
+		{"commit", "-m", fmt.Sprintf("Update %s to %s", config.Name, version)},
+		{"push"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = tapDir
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "updating tap '%s' failed", config.Tap)
+		}
+	}
+	return nil
+}
+
+// homebrewClassName converts name of the formula to the name of its ruby class, e.g. my-app to MyApp
+func homebrewClassName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.'
+	})
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	return strings.Join(parts, "")
+}
+
+func writeFormula(file, formula string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(file, []byte(formula), 0o644))
+}
@@ -0,0 +1,90 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"github.com/ridge/must"
+	"go.uber.org/zap"
+)
+
+// gitHookMarker identifies hooks installed by buildgo, so they may be safely replaced
+const gitHookMarker = "# Installed by buildgo, do not edit"
+
+// GitHooksConfig is the configuration of git hooks, hooks run commands of the building tool.
+// Hook is not installed if the list of its commands is empty.
+type GitHooksConfig struct {
+	// PreCommit is the list of commands run before commit is created
+	PreCommit []string
+
+	// PrePush is the list of commands run before changes are pushed
+	PrePush []string
+}
+
+// DefaultGitHooksConfig is the git hooks configuration used by git/hooks command.
+// Linter requires clean git tree, so it is run before push, not before commit.
+var DefaultGitHooksConfig = GitHooksConfig{
+	PreCommit: []string{"dev/format"},
+	PrePush:   []string{"dev/lint", "dev/test"},
+}
+
+// GitHooks installs git hooks running commands of the building tool. Existing hooks not installed
+// by buildgo are not overwritten.
+func GitHooks(ctx context.Context, config GitHooksConfig) error {
+	log := logger.Get(ctx)
+
+	hooksDir, err := gitOutput(ctx, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return err
+	}
+	if !dryRun() {
+		if err := os.MkdirAll(hooksDir, 0o755); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	binary := must.String(filepath.EvalSymlinks(must.String(os.Executable())))
+
+	for _, hook := range []struct {
+		Name     string
+		Commands []string
+	}{
+		{Name: "pre-commit", Commands: config.PreCommit},
+		{Name: "pre-push", Commands: config.PrePush},
+	} {
+		if len(hook.Commands) == 0 {
+			continue
+		}
+
+		path := filepath.Join(hooksDir, hook.Name)
+		existing, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if !bytes.Contains(existing, []byte(gitHookMarker)) {
+				return errors.Errorf("hook '%s' exists and was not installed by buildgo", path)
+			}
+		case !os.IsNotExist(err):
+			return errors.WithStack(err)
+		}
+
+		script := fmt.Sprintf("#!/bin/sh\n%s\nexec '%s' %s\n", gitHookMarker, strings.ReplaceAll(binary, "'", `'\''`),
+			strings.Join(hook.Commands, " "))
+		log.Info("Installing git hook", zap.String("path", path), zap.Strings("commands", hook.Commands))
+		if dryRun() {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+			return errors.WithStack(err)
+		}
+		// Mode of existing file is not changed by os.WriteFile
+		if err := os.Chmod(path, 0o755); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
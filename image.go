@@ -0,0 +1,187 @@
+package buildgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DefaultImageBase is the base image used if none is configured
+const DefaultImageBase = "gcr.io/distroless/static-debian12:nonroot"
+
+// ImageConfig is the configuration of container image
+type ImageConfig struct {
+	// Build is the configuration of the binary. Binary is always built statically for linux. Platform is ignored,
+	// use Platforms instead. Binary field is used only to set the name of the binary stored in the image,
+	// base name of the package is used if it is empty.
+	Build BuildConfig
+
+	// Platforms is the list of platforms the image is built for, linux platform of the host is used if empty.
+	// If there are many of them, image is pushed as multi-arch manifest list, so Push must be set.
+	Platforms []Platform
+
+	// Base is the base image, DefaultImageBase is used if empty. Use "scratch" to build image containing
+	// the binary only. Base image must be available for all the platforms.
+	Base string
+
+	// Tags is the list of references of the image, e.g. "example.com/app:v1.0.0"
+	Tags []string
+
+	// Labels are the labels of the image. Version and revision labels defined by OCI are set by default.
+	Labels map[string]string
+
+	// Args is the list of arguments passed to the binary
+	Args []string
+
+	// Push pushes the image to the registry instead of loading it to the local docker daemon.
+	// Credentials are taken from the docker configuration.
+	Push bool
+
+	// Layout is the directory where image is stored in OCI image layout format by GoBuildOCIImage.
+	// Existing layout is replaced.
+	Layout string
+}
+
+// GoBuildImage builds linux binaries and the container image containing them using docker buildx
+func GoBuildImage(ctx context.Context, config ImageConfig) error {
+	if len(config.Tags) == 0 {
+		return errors.New("no image tags provided")
+	}
+	if config.Base == "" {
+		config.Base = DefaultImageBase
+	}
+	if len(config.Platforms) == 0 {
+		config.Platforms = []Platform{{OS: "linux", Arch: runtime.GOARCH}}
+	}
+	if len(config.Platforms) > 1 && !config.Push {
+		return errors.New("multi-platform image must be pushed")
+	}
+
+	contextDir, err := os.MkdirTemp("", "buildgo-image-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(contextDir)
+
+	binaryName, err := buildImageBinaries(ctx, config, contextDir)
+	if err != nil {
+		return err
+	}
+	platforms := make([]string, 0, len(config.Platforms))
+	for _, platform := range config.Platforms {
+		platforms = append(platforms, platform.String())
+	}
+
+	labels, err := imageLabels(ctx, config.Labels)
+	if err != nil {
+		return err
+	}
+	dockerfile, err := imageDockerfile(config.Base, binaryName, config.Args, labels)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(contextDir, "Dockerfile"), []byte(dockerfile), 0o600); err != nil {
+		return errors.WithStack(err)
+	}
+
+	logger.Get(ctx).Info("Building image", zap.Strings("tags", config.Tags),
+		zap.Strings("platforms", platforms), zap.String("base", config.Base), zap.Bool("push", config.Push))
+
+	args := []string{"buildx", "build", "--platform", strings.Join(platforms, ",")}
+	if config.Push {
+		args = append(args, "--push")
+	} else {
+		args = append(args, "--load")
+	}
+	for _, tag := range config.Tags {
+		args = append(args, "--tag", tag)
+	}
+	cmd := exec.Command("docker", append(args, contextDir)...)
+	if err := execCmds(ctx, cmd); err != nil {
+		return errors.Wrapf(err, "building image '%s' failed", config.Tags[0])
+	}
+	return nil
+}
+
+// buildImageBinaries builds binaries for all the image platforms, binary for the platform is stored
+// in the <os>-<arch> subdirectory of dir. Name of the built binary is returned.
+func buildImageBinaries(ctx context.Context, config ImageConfig, dir string) (string, error) {
+	binaryName := filepath.Base(config.Build.Binary)
+	if config.Build.Binary == "" {
+		binaryName = filepath.Base(config.Build.Package)
+	}
+	buildConfigs := make([]BuildConfig, 0, len(config.Platforms))
+	for _, platform := range config.Platforms {
+		if platform.OS != "linux" {
+			return "", errors.Errorf("images can be built for linux only, not %s", platform)
+		}
+		buildConfig := config.Build
+		buildConfig.Platform = platform
+		buildConfig.Binary = filepath.Join(dir, platform.OS+"-"+platform.Arch, binaryName)
+		buildConfig.Static = true
+		buildConfig.NameTemplate = ""
+		buildConfig.ChecksumFile = ""
+		buildConfig.SkipUnchanged = false
+		buildConfigs = append(buildConfigs, buildConfig)
+	}
+	if err := GoBuildParallel(ctx, 0, buildConfigs...); err != nil {
+		return "", err
+	}
+
+	// Name of the built binary may differ, e.g. when it is built with race detector
+	output, err := outputBinary(buildConfigs[0])
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(output), nil
+}
+
+// imageLabels returns labels extended by the default ones
+func imageLabels(ctx context.Context, labels map[string]string) (map[string]string, error) {
+	version, err := Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := gitOutput(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]string{
+		"org.opencontainers.image.version":  version.String(),
+		"org.opencontainers.image.revision": commit,
+	}
+	for k, v := range labels {
+		result[k] = v
+	}
+	return result, nil
+}
+
+// imageDockerfile returns the Dockerfile copying the binary built for the target platform from the build context
+// into the image
+func imageDockerfile(base, binary string, args []string, labels map[string]string) (string, error) {
+	entrypoint, err := json.Marshal(append([]string{"/" + binary}, args...))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	dockerfile := &strings.Builder{}
+	fmt.Fprintf(dockerfile, "FROM %s\n", base)
+	// Variables are set by buildx to the platform being built
+	dockerfile.WriteString("ARG TARGETOS\nARG TARGETARCH\n")
+	fmt.Fprintf(dockerfile, "COPY ${TARGETOS}-${TARGETARCH}/%s /%s\n", binary, binary)
+	for _, key := range sortedKeys(labels) {
+		fmt.Fprintf(dockerfile, "LABEL %q=%q\n", key, labels[key])
+	}
+	fmt.Fprintf(dockerfile, "ENTRYPOINT %s\n", entrypoint)
+	return dockerfile.String(), nil
+}
@@ -0,0 +1,138 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// BannedImports declares import paths which must not be imported, directly or transitively, by packages
+type BannedImports struct {
+	// Module is the directory of the module rule applies to, rule applies to all modules if empty
+	Module string
+
+	// Packages is the package pattern rule applies to, e.g. "./cmd/server" for a single binary.
+	// All the packages of the module are checked if empty.
+	Packages string
+
+	// Imports is the list of banned import paths, path ending with "/..." bans all the packages under it
+	Imports []string
+}
+
+// GoBannedImports verifies that packages don't depend on banned imports.
+// Import chains leading to banned packages are reported.
+func GoBannedImports(ctx context.Context, deps build.DepsFunc, rules ...BannedImports) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+
+	var violations []string
+	err := onModule(ctx, func(path string) error {
+		for _, rule := range rules {
+			if rule.Module != "" && filepath.Clean(rule.Module) != path {
+				continue
+			}
+			if rule.Packages == "" {
+				rule.Packages = "./..."
+			}
+
+			log.Info("Checking banned imports", zap.String("path", path), zap.String("packages", rule.Packages))
+
+			chains, err := bannedImportChains(ctx, path, rule)
+			if err != nil {
+				return err
+			}
+			violations = append(violations, chains...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return errors.Errorf("banned packages are imported:\n%s", strings.Join(violations, "\n"))
+	}
+	return nil
+}
+
+func bannedImportChains(ctx context.Context, path string, rule BannedImports) ([]string, error) {
+	roots, err := goListOutput(ctx, path, "{{.ImportPath}}", rule.Packages)
+	if err != nil {
+		return nil, err
+	}
+	graphOutput, err := goListOutput(ctx, path, "{{.ImportPath}} {{join .Imports \" \"}}", "-deps", rule.Packages)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := map[string][]string{}
+	for _, line := range strings.Split(graphOutput, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		graph[fields[0]] = fields[1:]
+	}
+
+	// Breadth-first search finds the shortest chain leading to each banned package
+	parents := map[string]string{}
+	queue := strings.Fields(roots)
+	for _, root := range queue {
+		parents[root] = ""
+	}
+	var chains []string
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+
+		if isBannedImport(rule.Imports, pkg) {
+			chain := []string{pkg}
+			for parent := parents[pkg]; parent != ""; parent = parents[parent] {
+				chain = append([]string{parent}, chain...)
+			}
+			chains = append(chains, "  "+strings.Join(chain, " -> "))
+			continue
+		}
+
+		for _, imp := range graph[pkg] {
+			if _, visited := parents[imp]; visited {
+				continue
+			}
+			parents[imp] = pkg
+			queue = append(queue, imp)
+		}
+	}
+	return chains, nil
+}
+
+func isBannedImport(banned []string, pkg string) bool {
+	for _, b := range banned {
+		if prefix := strings.TrimSuffix(b, "/..."); prefix != b {
+			if pkg == prefix || strings.HasPrefix(pkg, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if pkg == b {
+			return true
+		}
+	}
+	return false
+}
+
+func goListOutput(ctx context.Context, path, format string, args ...string) (string, error) {
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", append([]string{"list", "-f", format}, args...)...)
+	cmd.Dir = path
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return "", errors.Wrapf(err, "listing packages in module '%s' failed", path)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,122 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// LicenseHeaderFile is the default path to the template of license header required in go files
+const LicenseHeaderFile = "build/.license-header"
+
+// LicenseHeaderConfig is the configuration of license header check
+type LicenseHeaderConfig struct {
+	// Template is the license header comment every go file must start with, it is the text/template
+	// where {{.Year}} is replaced by the year. Any year or range of years is accepted when verifying.
+	// Content of LicenseHeaderFile is used if empty.
+	Template string
+
+	// Exclude is the list of path patterns excluded from the check
+	Exclude []string
+}
+
+// GoLicenseHeader verifies that all go files start with the license header
+func GoLicenseHeader(ctx context.Context, deps build.DepsFunc, config LicenseHeaderConfig) error {
+	return licenseHeader(ctx, config, false)
+}
+
+// GoLicenseHeaderFix inserts license header into go files missing it
+func GoLicenseHeaderFix(ctx context.Context, deps build.DepsFunc, config LicenseHeaderConfig) error {
+	return licenseHeader(ctx, config, true)
+}
+
+func licenseHeader(ctx context.Context, config LicenseHeaderConfig, fix bool) error {
+	log := logger.Get(ctx)
+	if config.Template == "" {
+		tmpl, err := os.ReadFile(LicenseHeaderFile)
+		if err != nil {
+			return errors.Wrapf(err, "reading license header template '%s' failed", LicenseHeaderFile)
+		}
+		config.Template = string(tmpl)
+	}
+	config.Template = strings.TrimSpace(config.Template) + "\n"
+
+	tmpl, err := template.New("header").Parse(config.Template)
+	if err != nil {
+		return errors.Wrap(err, "parsing license header template failed")
+	}
+
+	const yearPlaceholder = "\x00YEAR\x00"
+	pattern := &strings.Builder{}
+	if err := tmpl.Execute(pattern, struct{ Year string }{Year: yearPlaceholder}); err != nil {
+		return errors.WithStack(err)
+	}
+	headerRegexp, err := regexp.Compile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern.String()),
+		yearPlaceholder, `\d{4}(-\d{4})?`))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	header := &bytes.Buffer{}
+	if err := tmpl.Execute(header, struct{ Year string }{Year: time.Now().Format("2006")}); err != nil {
+		return errors.WithStack(err)
+	}
+	header.WriteString("\n")
+
+	var missing []string
+	err = filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if d.IsDir() {
+			switch d.Name() {
+			case ".git", "bin", "node_modules", "vendor", "testdata":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || filepath.Ext(path) != ".go" || matchesAny(config.Exclude, filepath.ToSlash(path)) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if headerRegexp.Match(content) || isGeneratedFile(content) {
+			return nil
+		}
+		if !fix {
+			missing = append(missing, path)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		log.Info("Inserting license header", zap.String("path", path))
+		if dryRun() {
+			return nil
+		}
+		return errors.WithStack(os.WriteFile(path, append(header.Bytes(), content...), info.Mode().Perm()))
+	})
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("license header is missing in files: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
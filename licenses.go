@@ -0,0 +1,188 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ThirdPartyLicensesReport is the default path of the report containing licenses of dependencies
+const ThirdPartyLicensesReport = "bin/THIRD_PARTY_LICENSES"
+
+// UnknownLicense is the license assigned to dependencies which license can't be classified
+const UnknownLicense = "unknown"
+
+// DefaultLicenseDenylist is the list of licenses not accepted by default
+var DefaultLicenseDenylist = []string{"AGPL-3.0", "GPL-2.0", "GPL-3.0", "LGPL", UnknownLicense}
+
+// LicenseConfig is the configuration of dependency license scanning
+type LicenseConfig struct {
+	// Denylist is the list of licenses not accepted in dependencies, DefaultLicenseDenylist is used if nil
+	Denylist []string
+
+	// Exceptions is the list of module paths accepted regardless of their license
+	Exceptions []string
+
+	// Report is the path of the file where licenses of all the dependencies are stored, nothing is stored if empty
+	Report string
+}
+
+// licenseClassifiers are checked in order, so more specific licenses must go first
+var licenseClassifiers = []struct {
+	License string
+	Regexp  *regexp.Regexp
+}{
+	{License: "AGPL-3.0", Regexp: regexp.MustCompile(`(?i)GNU AFFERO GENERAL PUBLIC LICENSE`)},
+	{License: "LGPL", Regexp: regexp.MustCompile(`(?i)GNU (LESSER|LIBRARY) GENERAL PUBLIC LICENSE`)},
+	{License: "GPL-3.0", Regexp: regexp.MustCompile(`(?i)GNU GENERAL PUBLIC LICENSE\s+Version 3`)},
+	{License: "GPL-2.0", Regexp: regexp.MustCompile(`(?i)GNU GENERAL PUBLIC LICENSE\s+Version 2`)},
+	{License: "MPL-2.0", Regexp: regexp.MustCompile(`(?i)Mozilla Public License,?\s+(Version|v\.)\s*2\.0`)},
+	{License: "Apache-2.0", Regexp: regexp.MustCompile(`(?i)Apache License,?\s+Version 2\.0`)},
+	{
+		License: "BSD-3-Clause",
+		Regexp:  regexp.MustCompile(`(?i)Redistribution and use in source and binary forms(?s:.*)Neither the name`),
+	},
+	{License: "BSD-2-Clause", Regexp: regexp.MustCompile(`(?i)Redistribution and use in source and binary forms`)},
+	{License: "MIT", Regexp: regexp.MustCompile(`(?i)Permission is hereby granted, free of charge`)},
+	{
+		License: "ISC",
+		Regexp:  regexp.MustCompile(`(?i)Permission to use, copy, modify, and(/or)? distribute this software for any`),
+	},
+	{
+		License: "Unlicense",
+		Regexp:  regexp.MustCompile(`(?i)This is free and unencumbered software released into the public domain`),
+	},
+	{License: "CC0-1.0", Regexp: regexp.MustCompile(`(?i)CC0 1\.0 Universal`)},
+}
+
+// dependencyLicense is the license of the dependency module
+type dependencyLicense struct {
+	Module  string
+	Version string
+	License string
+	Text    []byte
+}
+
+// GoLicenses verifies that licenses of dependencies used by all modules are not denied
+func GoLicenses(ctx context.Context, deps build.DepsFunc, config LicenseConfig) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+	if config.Denylist == nil {
+		config.Denylist = DefaultLicenseDenylist
+	}
+
+	dependencies := map[string]dependencyLicense{}
+	err := onModule(ctx, func(path string) error {
+		log.Info("Scanning licenses of dependencies", zap.String("path", path))
+		return moduleDependencyLicenses(ctx, path, dependencies)
+	})
+	if err != nil {
+		return err
+	}
+
+	var denied []string
+	for _, key := range sortedKeys(dependencies) {
+		dependency := dependencies[key]
+		if contains(config.Denylist, dependency.License) && !contains(config.Exceptions, dependency.Module) {
+			denied = append(denied, fmt.Sprintf("%s (%s)", key, dependency.License))
+		}
+	}
+
+	if config.Report != "" && !skipInDryRun(ctx, "Storing license report", zap.String("path", config.Report)) {
+		if err := writeLicenseReport(config.Report, dependencies); err != nil {
+			return err
+		}
+		log.Info("License report stored", zap.String("path", config.Report))
+	}
+
+	if len(denied) > 0 {
+		return errors.Errorf("dependencies with denied licenses found: %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+func moduleDependencyLicenses(ctx context.Context, path string, dependencies map[string]dependencyLicense) error {
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", "list", "-deps", "-f",
+		"{{with .Module}}{{if not .Main}}{{.Path}}\t{{.Version}}\t{{.Dir}}{{end}}{{end}}", "./...")
+	cmd.Dir = path
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return errors.Wrapf(err, "listing dependencies of module '%s' failed", path)
+	}
+
+	for _, line := range strings.Split(buf.String(), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		key := fields[0] + "@" + fields[1]
+		if _, exists := dependencies[key]; exists {
+			continue
+		}
+
+		license, text, err := classifyLicense(fields[2])
+		if err != nil {
+			return err
+		}
+		dependencies[key] = dependencyLicense{
+			Module:  fields[0],
+			Version: fields[1],
+			License: license,
+			Text:    text,
+		}
+	}
+	return nil
+}
+
+func classifyLicense(dir string) (string, []byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		name := strings.ToLower(entry.Name())
+		if entry.IsDir() || (!strings.HasPrefix(name, "licen") && !strings.HasPrefix(name, "copying")) {
+			continue
+		}
+		text, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return "", nil, errors.WithStack(err)
+		}
+		for _, classifier := range licenseClassifiers {
+			if classifier.Regexp.Match(text) {
+				return classifier.License, text, nil
+			}
+		}
+		return UnknownLicense, text, nil
+	}
+	return UnknownLicense, nil, nil
+}
+
+func writeLicenseReport(file string, dependencies map[string]dependencyLicense) error {
+	buf := &bytes.Buffer{}
+	for _, key := range sortedKeys(dependencies) {
+		dependency := dependencies[key]
+		fmt.Fprintf(buf, "================================================================================\n")
+		fmt.Fprintf(buf, "%s %s\nLicense: %s\n\n", dependency.Module, dependency.Version, dependency.License)
+		if len(dependency.Text) > 0 {
+			buf.Write(bytes.TrimSpace(dependency.Text))
+			buf.WriteString("\n\n")
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(file, buf.Bytes(), 0o644))
+}
@@ -0,0 +1,270 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Linux package formats
+const (
+	PackageDEB = "deb"
+	PackageRPM = "rpm"
+)
+
+// LinuxPackageConfig is the configuration of linux packages.
+// Unit, config files and scripts are text/templates, available fields are: Name, Version and Binary
+// (path where binary is installed).
+type LinuxPackageConfig struct {
+	// Build is the configuration used to build binaries by GoBuildMatrix, it is used to find them
+	Build BuildConfig
+
+	// Name is the name of the package, base name of the binary is used if empty
+	Name string
+
+	// Formats is the list of package formats to produce, all of them are produced if empty
+	Formats []string
+
+	// Dir is the directory where packages are stored, directory of the binaries is used if empty
+	Dir string
+
+	// Maintainer is the maintainer of the package, e.g. "Team <team@example.com>"
+	Maintainer string
+
+	// Description is the description of the package
+	Description string
+
+	// Homepage is the URL of the project
+	Homepage string
+
+	// License is the license of the package
+	License string
+
+	// Depends is the list of packages the package depends on
+	Depends []string
+
+	// SystemdUnit is the systemd unit installed as /lib/systemd/system/<name>.service if not empty
+	SystemdUnit string
+
+	// ConfigFiles maps paths of config files in the package to their templates. Config files modified
+	// by the user are not replaced on upgrade.
+	ConfigFiles map[string]string
+
+	// PreInstall is the script run before the package is installed
+	PreInstall string
+
+	// PostInstall is the script run after the package is installed
+	PostInstall string
+
+	// PreRemove is the script run before the package is removed
+	PreRemove string
+
+	// PostRemove is the script run after the package is removed
+	PostRemove string
+}
+
+// nfpmConfig is the configuration of the package consumed by nfpm
+type nfpmConfig struct {
+	Name        string        `yaml:"name"`
+	Arch        string        `yaml:"arch"`
+	Platform    string        `yaml:"platform"`
+	Version     string        `yaml:"version"`
+	Maintainer  string        `yaml:"maintainer,omitempty"`
+	Description string        `yaml:"description,omitempty"`
+	Homepage    string        `yaml:"homepage,omitempty"`
+	License     string        `yaml:"license,omitempty"`
+	Depends     []string      `yaml:"depends,omitempty"`
+	MTime       string        `yaml:"mtime"`
+	Contents    []nfpmContent `yaml:"contents"`
+	Scripts     struct {
+		PreInstall  string `yaml:"preinstall,omitempty"`
+		PostInstall string `yaml:"postinstall,omitempty"`
+		PreRemove   string `yaml:"preremove,omitempty"`
+		PostRemove  string `yaml:"postremove,omitempty"`
+	} `yaml:"scripts"`
+}
+
+// nfpmContent is the file stored in the package
+type nfpmContent struct {
+	Src      string `yaml:"src"`
+	Dst      string `yaml:"dst"`
+	Type     string `yaml:"type,omitempty"`
+	FileInfo struct {
+		Mode uint32 `yaml:"mode"`
+	} `yaml:"file_info"`
+}
+
+// GoLinuxPackages wraps binaries built by GoBuildMatrix for linux platforms into packages installable
+// by system package managers. Binary is installed into /usr/bin.
+func GoLinuxPackages(ctx context.Context, deps build.DepsFunc, config LinuxPackageConfig,
+	platforms ...Platform,
+) error {
+	deps(EnsureNFPM)
+
+	if len(platforms) == 0 {
+		var err error
+		platforms, err = repoPlatforms()
+		if err != nil {
+			return err
+		}
+	}
+	if len(config.Formats) == 0 {
+		config.Formats = []string{PackageDEB, PackageRPM}
+	}
+	if config.Build.NameTemplate == "" {
+		config.Build.NameTemplate = DefaultNameTemplate
+	}
+	if config.Name == "" {
+		config.Name = strings.TrimSuffix(filepath.Base(config.Build.Binary), filepath.Ext(config.Build.Binary))
+	}
+
+	version, err := Version(ctx)
+	if err != nil {
+		return err
+	}
+	sourceDateEpoch, err := gitSourceDateEpoch(ctx)
+	if err != nil {
+		return err
+	}
+
+	workDir, err := os.MkdirTemp("", "buildgo-package-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	data := struct {
+		Name    string
+		Version string
+		Binary  string
+	}{
+		Name:    config.Name,
+		Version: strings.TrimPrefix(version.String(), "v"),
+		Binary:  "/usr/bin/" + config.Name,
+	}
+	pkg := nfpmConfig{
+		Name:        config.Name,
+		Platform:    "linux",
+		Version:     data.Version,
+		Maintainer:  config.Maintainer,
+		Description: config.Description,
+		Homepage:    config.Homepage,
+		License:     config.License,
+		Depends:     config.Depends,
+		MTime:       time.Unix(sourceDateEpoch, 0).UTC().Format(time.RFC3339),
+	}
+
+	// renderFile renders the template into the work directory and returns its path
+	renderFile := func(name, content string) (string, error) {
+		tmpl, err := template.New(name).Parse(content)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid template of '%s'", name)
+		}
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, data); err != nil {
+			return "", errors.Wrapf(err, "executing template of '%s' failed", name)
+		}
+		file := filepath.Join(workDir, strings.ReplaceAll(strings.TrimPrefix(name, "/"), "/", "_"))
+		return file, errors.WithStack(os.WriteFile(file, buf.Bytes(), 0o644))
+	}
+
+	if config.SystemdUnit != "" {
+		unitPath := "/lib/systemd/system/" + config.Name + ".service"
+		src, err := renderFile(unitPath, config.SystemdUnit)
+		if err != nil {
+			return err
+		}
+		pkg.Contents = append(pkg.Contents, newNFPMContent(src, unitPath, "", 0o644))
+	}
+	for _, dst := range sortedKeys(config.ConfigFiles) {
+		src, err := renderFile(dst, config.ConfigFiles[dst])
+		if err != nil {
+			return err
+		}
+		pkg.Contents = append(pkg.Contents, newNFPMContent(src, dst, "config|noreplace", 0o644))
+	}
+	for _, script := range []struct {
+		Name     string
+		Template string
+		Path     *string
+	}{
+		{Name: "preinstall", Template: config.PreInstall, Path: &pkg.Scripts.PreInstall},
+		{Name: "postinstall", Template: config.PostInstall, Path: &pkg.Scripts.PostInstall},
+		{Name: "preremove", Template: config.PreRemove, Path: &pkg.Scripts.PreRemove},
+		{Name: "postremove", Template: config.PostRemove, Path: &pkg.Scripts.PostRemove},
+	} {
+		if script.Template == "" {
+			continue
+		}
+		if *script.Path, err = renderFile(script.Name+".sh", script.Template); err != nil {
+			return err
+		}
+	}
+	fixedContents := pkg.Contents
+
+	for _, platform := range platforms {
+		if platform.OS != "linux" {
+			continue
+		}
+
+		buildConfig := config.Build
+		buildConfig.Platform = platform
+		binary, err := outputBinary(buildConfig)
+		if err != nil {
+			return err
+		}
+		binary, err = filepath.Abs(binary)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		pkg.Arch = platform.Arch
+		pkg.Contents = append([]nfpmContent{newNFPMContent(binary, data.Binary, "", 0o755)}, fixedContents...)
+		nfpmFile := filepath.Join(workDir, "nfpm-"+platform.Arch+".yaml")
+		content, err := yaml.Marshal(pkg)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := os.WriteFile(nfpmFile, content, 0o644); err != nil {
+			return errors.WithStack(err)
+		}
+
+		dir := config.Dir
+		if dir == "" {
+			dir = filepath.Dir(binary)
+		}
+		if !dryRun() {
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		for _, format := range config.Formats {
+			logger.Get(ctx).Info("Building linux package", zap.String("name", config.Name),
+				zap.String("format", format), zap.Stringer("platform", platform))
+
+			cmd := exec.Command("nfpm", "package", "--config", nfpmFile, "--packager", format, "--target",
+				dir+string(filepath.Separator))
+			if err := execCmds(ctx, cmd); err != nil {
+				return errors.Wrapf(err, "building %s package for %s failed", format, platform)
+			}
+		}
+	}
+	return nil
+}
+
+func newNFPMContent(src, dst, contentType string, mode uint32) nfpmContent {
+	content := nfpmContent{Src: src, Dst: dst, Type: contentType}
+	content.FileInfo.Mode = mode
+	return content
+}
@@ -0,0 +1,263 @@
+package buildgo
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// MetricsReport is the default path of the CSV file containing metrics of all the functions
+	MetricsReport = "bin/metrics.csv"
+
+	// MetricsBaseline is the file containing functions allowed to exceed the limits, one per line
+	MetricsBaseline = "build/.metrics-baseline"
+)
+
+// MetricsConfig is the configuration of code metrics
+type MetricsConfig struct {
+	// MaxComplexity is the maximum cyclomatic complexity of the function, 15 is used if 0
+	MaxComplexity int
+
+	// MaxLength is the maximum number of lines of the function, 80 is used if 0
+	MaxLength int
+
+	// Report is the path of the CSV file where metrics are stored, MetricsReport is used if empty
+	Report string
+
+	// UpdateBaseline stores all the functions currently exceeding the limits in MetricsBaseline instead of failing
+	UpdateBaseline bool
+}
+
+// functionMetrics contains metrics of the function
+type functionMetrics struct {
+	File       string
+	Line       int
+	Function   string
+	Complexity int
+	Length     int
+}
+
+// Key returns the key identifying the function in the baseline
+func (m functionMetrics) Key() string {
+	return m.File + ":" + m.Function
+}
+
+// GoMetrics computes cyclomatic complexity and length of all the functions, stores them in the report
+// and fails if any function not listed in MetricsBaseline exceeds the limits.
+// Tests and generated files are skipped.
+func GoMetrics(ctx context.Context, deps build.DepsFunc, config MetricsConfig) error {
+	log := logger.Get(ctx)
+	if config.MaxComplexity == 0 {
+		config.MaxComplexity = 15
+	}
+	if config.MaxLength == 0 {
+		config.MaxLength = 80
+	}
+	if config.Report == "" {
+		config.Report = MetricsReport
+	}
+
+	var baselineFile string
+	if fileExists(MetricsBaseline) && !config.UpdateBaseline {
+		baselineFile = MetricsBaseline
+	}
+	baseline, err := readListFile(baselineFile)
+	if err != nil {
+		return err
+	}
+
+	metrics, err := collectFunctionMetrics()
+	if err != nil {
+		return err
+	}
+	if !skipInDryRun(ctx, "Storing metrics report", zap.String("path", config.Report)) {
+		if err := writeMetricsReport(config.Report, metrics); err != nil {
+			return err
+		}
+	}
+
+	var totalComplexity int
+	var exceeding, violations []string
+	for _, m := range metrics {
+		totalComplexity += m.Complexity
+		if m.Complexity <= config.MaxComplexity && m.Length <= config.MaxLength {
+			continue
+		}
+		exceeding = append(exceeding, m.Key())
+		if !baseline[m.Key()] {
+			violations = append(violations, fmt.Sprintf("  %s:%d: %s (complexity: %d, length: %d)", m.File, m.Line,
+				m.Function, m.Complexity, m.Length))
+		}
+	}
+	var avgComplexity float64
+	if len(metrics) > 0 {
+		avgComplexity = float64(totalComplexity) / float64(len(metrics))
+	}
+	log.Info("Code metrics computed", zap.String("report", config.Report), zap.Int("functions", len(metrics)),
+		zap.Float64("avgComplexity", avgComplexity), zap.Int("exceeding", len(exceeding)))
+
+	if config.UpdateBaseline {
+		log.Info("Storing metrics baseline", zap.String("path", MetricsBaseline))
+		if dryRun() {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(MetricsBaseline), 0o755); err != nil {
+			return errors.WithStack(err)
+		}
+		content := strings.Join(exceeding, "\n")
+		if content != "" {
+			content += "\n"
+		}
+		return errors.WithStack(os.WriteFile(MetricsBaseline, []byte(content), 0o644))
+	}
+	if len(violations) > 0 {
+		return errors.Errorf("functions exceed limits (complexity: %d, length: %d):\n%s", config.MaxComplexity,
+			config.MaxLength, strings.Join(violations, "\n"))
+	}
+	return nil
+}
+
+func collectFunctionMetrics() ([]functionMetrics, error) {
+	skipGenerated, err := excludeGenerated()
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []functionMetrics
+	fset := token.NewFileSet()
+	err = filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if d.IsDir() {
+			switch d.Name() {
+			case ".git", "bin", "node_modules", "vendor", "testdata":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || filepath.Ext(path) != ".go" || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if skipGenerated && isGeneratedFile(content) {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, path, content, 0)
+		if err != nil {
+			return errors.Wrapf(err, "parsing file '%s' failed", path)
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			start := fset.Position(fn.Pos())
+			metrics = append(metrics, functionMetrics{
+				File:       filepath.ToSlash(path),
+				Line:       start.Line,
+				Function:   functionName(fn),
+				Complexity: cyclomaticComplexity(fn),
+				Length:     fset.Position(fn.End()).Line - start.Line + 1,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Key() < metrics[j].Key()
+	})
+	return metrics, nil
+}
+
+func functionName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	recv := fn.Recv.List[0].Type
+	var pointer string
+	if star, ok := recv.(*ast.StarExpr); ok {
+		pointer = "*"
+		recv = star.X
+	}
+	switch t := recv.(type) {
+	case *ast.IndexExpr:
+		recv = t.X
+	case *ast.IndexListExpr:
+		recv = t.X
+	}
+	if ident, ok := recv.(*ast.Ident); ok {
+		return "(" + pointer + ident.Name + ")." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+func cyclomaticComplexity(fn *ast.FuncDecl) int {
+	complexity := 1
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			if n.List != nil {
+				complexity++
+			}
+		case *ast.CommClause:
+			if n.Comm != nil {
+				complexity++
+			}
+		case *ast.BinaryExpr:
+			if n.Op == token.LAND || n.Op == token.LOR {
+				complexity++
+			}
+		}
+		return true
+	})
+	return complexity
+}
+
+func writeMetricsReport(file string, metrics []functionMetrics) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"file", "line", "function", "complexity", "length"}); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, m := range metrics {
+		if err := w.Write([]string{m.File, strconv.Itoa(m.Line), m.Function, strconv.Itoa(m.Complexity),
+			strconv.Itoa(m.Length)}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	w.Flush()
+	return errors.WithStack(w.Error())
+}
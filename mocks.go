@@ -0,0 +1,81 @@
+package buildgo
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// MockSpec declares interfaces of the package mocked by GoMocks
+type MockSpec struct {
+	// Package is the directory of the package containing interfaces, relative to the repository root
+	Package string `yaml:"package"`
+
+	// Interfaces is the list of interfaces to mock
+	Interfaces []string `yaml:"interfaces"`
+
+	// Destination is the file where mocks are stored, relative to Package, mocks/mocks.go is used if empty.
+	// Name of the directory is used as the name of the package.
+	Destination string `yaml:"destination"`
+}
+
+// MocksConfig is the configuration of mock generation
+type MocksConfig struct {
+	// Check verifies that mocks are up to date. Git tree must be clean before mocks are generated
+	// and it must stay clean afterwards.
+	Check bool
+}
+
+// GoMocks generates mocks declared in the repository configuration using mockgen
+func GoMocks(ctx context.Context, deps build.DepsFunc, config MocksConfig) error {
+	repoConfig, err := LoadRepoConfig()
+	if err != nil {
+		return err
+	}
+	if len(repoConfig.Mocks) == 0 {
+		return nil
+	}
+	deps(EnsureGo, EnsureMockgen)
+
+	if config.Check {
+		if err := GitStatusClean(ctx); err != nil {
+			return errors.Wrap(err, "git tree must be clean to verify mocks")
+		}
+	}
+
+	log := logger.Get(ctx)
+	for _, spec := range repoConfig.Mocks {
+		if len(spec.Interfaces) == 0 {
+			return errors.Errorf("no interfaces to mock in package '%s'", spec.Package)
+		}
+		if spec.Destination == "" {
+			spec.Destination = filepath.Join("mocks", "mocks.go")
+		}
+
+		log.Info("Generating mocks", zap.String("package", spec.Package), zap.Strings("interfaces", spec.Interfaces),
+			zap.String("destination", spec.Destination))
+
+		cmd := exec.Command("mockgen",
+			"-destination", spec.Destination,
+			"-package", filepath.Base(filepath.Dir(filepath.Join(spec.Package, spec.Destination))),
+			".", strings.Join(spec.Interfaces, ","))
+		cmd.Dir = spec.Package
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "generating mocks for package '%s' failed", spec.Package)
+		}
+	}
+
+	if !config.Check {
+		return nil
+	}
+	if err := GitStatusClean(ctx); err != nil {
+		return errors.Wrap(err, "mocks are not up to date")
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package buildgo
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/outofforest/logger"
+	"github.com/outofforest/parallel"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Module is the go module found in the repository
+type Module struct {
+	// Dir is the directory of the module, relative to the root of the repository
+	Dir string
+
+	// Path is the module path declared in go.mod
+	Path string
+}
+
+// ModuleFilter selects modules processed by OnModule.
+// Patterns are globs matched against both the slash-separated directory and the path of the module.
+type ModuleFilter struct {
+	// Include is the list of patterns of modules to process, all the modules are processed if empty
+	Include []string
+
+	// Exclude is the list of patterns of modules to skip
+	Exclude []string
+}
+
+// OnModule runs fn for each module of the repository selected by the filter, one by one
+func OnModule(ctx context.Context, filter ModuleFilter, fn func(ctx context.Context, module Module) error) error {
+	return onModule(ctx, func(dir string) error {
+		module, err := moduleAt(dir)
+		if err != nil {
+			return err
+		}
+		if !filter.matches(module) {
+			return nil
+		}
+		return fn(ctx, module)
+	})
+}
+
+// OnModuleParallel runs fn for all the modules of the repository selected by the filter concurrently.
+// At most limit modules are processed at the same time, if limit is 0, GOMAXPROCS is used. All the modules
+// are processed even if some of them fail, returned error aggregates all the failures. Once done, summary
+// reporting result of each module is printed.
+func OnModuleParallel(
+	ctx context.Context,
+	filter ModuleFilter,
+	limit int,
+	fn func(ctx context.Context, module Module) error,
+) error {
+	if limit <= 0 {
+		limit = runtime.GOMAXPROCS(0)
+	}
+
+	var modules []Module
+	if err := OnModule(ctx, filter, func(ctx context.Context, module Module) error {
+		modules = append(modules, module)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	results := make([]moduleResult, len(modules))
+	semaphore := make(chan struct{}, limit)
+	err := parallel.Run(ctx, func(ctx context.Context, spawn parallel.SpawnFn) error {
+		for i, module := range modules {
+			i, module := i, module
+			spawn(module.Dir, parallel.Continue, func(ctx context.Context) error {
+				select {
+				case <-ctx.Done():
+					return errors.WithStack(ctx.Err())
+				case semaphore <- struct{}{}:
+				}
+				defer func() {
+					<-semaphore
+				}()
+
+				start := time.Now()
+				err := fn(ctx, module)
+				results[i] = moduleResult{Module: module, Err: err, Elapsed: time.Since(start)}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	printModuleSummary(results)
+
+	var errs error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = multierr.Append(errs, errors.Wrapf(result.Err, "module '%s' failed", result.Module.Dir))
+		}
+	}
+	return errs
+}
+
+// OnModuleInOrder runs fn for each module of the repository selected by the filter, one by one, processing
+// local modules required or used as replacements before modules depending on them.
+// If skipDependents is false, processing stops on the first failure. Otherwise, only modules depending, directly
+// or indirectly, on the failed one are skipped and returned error aggregates all the failures.
+func OnModuleInOrder(
+	ctx context.Context,
+	filter ModuleFilter,
+	skipDependents bool,
+	fn func(ctx context.Context, module Module) error,
+) error {
+	log := logger.Get(ctx)
+
+	modules := map[string]Module{}
+	if err := OnModule(ctx, filter, func(ctx context.Context, module Module) error {
+		modules[module.Dir] = module
+		return nil
+	}); err != nil {
+		return err
+	}
+	graph, err := moduleGraph(ctx)
+	if err != nil {
+		return err
+	}
+	order, err := topologicalOrder(graph)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	failed := map[string]bool{}
+	for _, dir := range order {
+		for _, dep := range graph[dir] {
+			if failed[dep] {
+				failed[dir] = true
+			}
+		}
+		module, exists := modules[dir]
+		if !exists {
+			continue
+		}
+		if failed[dir] {
+			log.Info("Dependency failed, skipping module", zap.String("path", dir))
+			continue
+		}
+		if err := fn(ctx, module); err != nil {
+			if !skipDependents {
+				return err
+			}
+			errs = multierr.Append(errs, errors.Wrapf(err, "module '%s' failed", dir))
+			failed[dir] = true
+		}
+	}
+	return errs
+}
+
+// moduleGraph returns directories of all the modules mapped to directories of local modules they depend on
+func moduleGraph(ctx context.Context) (map[string][]string, error) {
+	goMods := map[string]goModFile{}
+	if err := repoModules(ctx, func(dir string) error {
+		goMod, err := readGoMod(ctx, dir)
+		if err != nil {
+			return err
+		}
+		goMods[dir] = goMod
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	dirs := map[string]string{}
+	for dir, goMod := range goMods {
+		dirs[goMod.Module.Path] = dir
+	}
+
+	graph := map[string][]string{}
+	for dir, goMod := range goMods {
+		deps := map[string]bool{}
+		for _, require := range goMod.Require {
+			if depDir, exists := dirs[require.Path]; exists {
+				deps[depDir] = true
+			}
+		}
+		for _, replace := range goMod.Replace {
+			if replace.New.Version != "" {
+				continue
+			}
+			depDir := filepath.Join(dir, filepath.FromSlash(replace.New.Path))
+			if _, exists := goMods[depDir]; exists {
+				deps[depDir] = true
+			}
+		}
+		delete(deps, dir)
+		graph[dir] = sortedKeys(deps)
+	}
+	return graph, nil
+}
+
+// topologicalOrder returns nodes of the graph ordered so each node comes after all its dependencies
+func topologicalOrder(graph map[string][]string) ([]string, error) {
+	const (
+		visiting = iota + 1
+		visited
+	)
+
+	state := map[string]int{}
+	order := make([]string, 0, len(graph))
+	var visit func(node string, chain []string) error
+	visit = func(node string, chain []string) error {
+		chain = append(chain, node)
+		switch state[node] {
+		case visiting:
+			return errors.Errorf("modules depend on each other: %s", strings.Join(chain, " -> "))
+		case visited:
+			return nil
+		}
+		state[node] = visiting
+		for _, dep := range graph[node] {
+			if err := visit(dep, chain); err != nil {
+				return err
+			}
+		}
+		state[node] = visited
+		order = append(order, node)
+		return nil
+	}
+	for _, node := range sortedKeys(graph) {
+		if err := visit(node, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// moduleResult is the result of processing the module by OnModuleParallel
+type moduleResult struct {
+	Module  Module
+	Err     error
+	Elapsed time.Duration
+}
+
+func printModuleSummary(results []moduleResult) {
+	var failed int
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	fmt.Println("\n Module summary:")
+	fmt.Println()
+	fmt.Printf("   passed: %d, failed: %d\n", len(results)-failed, failed)
+	fmt.Println()
+	for _, result := range results {
+		status := "PASS"
+		if result.Err != nil {
+			status = "FAIL"
+		}
+		fmt.Printf("   %s  %8.2fs  %s\n", status, result.Elapsed.Seconds(), result.Module.Dir)
+	}
+	fmt.Println()
+}
+
+func (f ModuleFilter) matches(module Module) bool {
+	if len(f.Include) > 0 && !matchModule(f.Include, module) {
+		return false
+	}
+	return !matchModule(f.Exclude, module)
+}
+
+func matchModule(patterns []string, module Module) bool {
+	dir := filepath.ToSlash(module.Dir)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, dir); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, module.Path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleAt returns the module stored in the directory
+func moduleAt(dir string) (Module, error) {
+	modulePath, err := goModDirective(filepath.Join(dir, "go.mod"), "module")
+	if err != nil {
+		return Module{}, err
+	}
+	if modulePath == "" {
+		return Module{}, errors.Errorf("module path is not declared in go.mod of module '%s'", dir)
+	}
+	return Module{Dir: dir, Path: modulePath}, nil
+}
@@ -0,0 +1,252 @@
+package buildgo
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// GoBuildOCIImage builds linux binaries and assembles the container image containing them without docker.
+// Base image is pulled directly from the registry. Image is pushed if Push is set and stored in the OCI image
+// layout if Layout is set. Image built for many platforms is stored as an index.
+func GoBuildOCIImage(ctx context.Context, config ImageConfig) error {
+	if len(config.Tags) == 0 {
+		return errors.New("no image tags provided")
+	}
+	if !config.Push && config.Layout == "" {
+		return errors.New("image is neither pushed nor stored in the layout")
+	}
+	if config.Base == "" {
+		config.Base = DefaultImageBase
+	}
+	if len(config.Platforms) == 0 {
+		config.Platforms = []Platform{{OS: "linux", Arch: runtime.GOARCH}}
+	}
+	log := logger.Get(ctx)
+
+	binDir, err := os.MkdirTemp("", "buildgo-image-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(binDir)
+
+	binaryName, err := buildImageBinaries(ctx, config, binDir)
+	if err != nil {
+		return err
+	}
+	labels, err := imageLabels(ctx, config.Labels)
+	if err != nil {
+		return err
+	}
+	sourceDateEpoch, err := gitSourceDateEpoch(ctx)
+	if err != nil {
+		return err
+	}
+	created := time.Unix(sourceDateEpoch, 0).UTC()
+
+	// Binaries are not built in dry-run mode, so the image can't be assembled
+	if skipInDryRun(ctx, "Assembling image", zap.String("base", config.Base), zap.Strings("tags", config.Tags),
+		zap.String("layout", config.Layout), zap.Bool("push", config.Push)) {
+		return nil
+	}
+
+	images := make([]v1.Image, 0, len(config.Platforms))
+	for _, platform := range config.Platforms {
+		log.Info("Assembling image", zap.String("base", config.Base), zap.Stringer("platform", platform))
+		image, err := ociImage(ctx, config, platform, filepath.Join(binDir, platform.OS+"-"+platform.Arch, binaryName),
+			labels, created)
+		if err != nil {
+			return err
+		}
+		images = append(images, image)
+	}
+
+	var index v1.ImageIndex
+	if len(images) > 1 {
+		mediaType, err := images[0].MediaType()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		indexMediaType := types.DockerManifestList
+		if mediaType == types.OCIManifestSchema1 {
+			indexMediaType = types.OCIImageIndex
+		}
+		index = mutate.IndexMediaType(empty.Index, indexMediaType)
+		for i, image := range images {
+			index = mutate.AppendManifests(index, mutate.IndexAddendum{
+				Add: image,
+				Descriptor: v1.Descriptor{
+					Platform: &v1.Platform{OS: config.Platforms[i].OS, Architecture: config.Platforms[i].Arch},
+				},
+			})
+		}
+	}
+
+	if config.Layout != "" {
+		log.Info("Storing image layout", zap.String("path", config.Layout))
+		if err := writeOCILayout(config.Layout, config.Tags, images[0], index); err != nil {
+			return err
+		}
+	}
+	if !config.Push {
+		return nil
+	}
+
+	for _, tag := range config.Tags {
+		ref, err := name.ParseReference(tag)
+		if err != nil {
+			return errors.Wrapf(err, "invalid image reference '%s'", tag)
+		}
+		log.Info("Pushing image", zap.String("tag", tag))
+		options := []remote.Option{remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain)}
+		if index != nil {
+			err = remote.WriteIndex(ref, index, options...)
+		} else {
+			err = remote.Write(ref, images[0], options...)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "pushing image '%s' failed", tag)
+		}
+	}
+	return nil
+}
+
+// ociImage returns the image for the platform, built by adding layer containing the binary to the base image
+func ociImage(
+	ctx context.Context,
+	config ImageConfig,
+	platform Platform,
+	binary string,
+	labels map[string]string,
+	created time.Time,
+) (v1.Image, error) {
+	base := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIConfigJSON)
+	if config.Base != "scratch" {
+		ref, err := name.ParseReference(config.Base)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid base image reference '%s'", config.Base)
+		}
+		base, err = remote.Image(ref, remote.WithContext(ctx), remote.WithAuthFromKeychain(authn.DefaultKeychain),
+			remote.WithPlatform(v1.Platform{OS: platform.OS, Architecture: platform.Arch}))
+		if err != nil {
+			return nil, errors.Wrapf(err, "pulling base image '%s' failed", config.Base)
+		}
+	}
+
+	// Layer must be of the same family as the manifest of the base image
+	mediaType, err := base.MediaType()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	layerMediaType := types.DockerLayer
+	if mediaType == types.OCIManifestSchema1 {
+		layerMediaType = types.OCILayer
+	}
+	layer, err := binaryLayer(binary, created, layerMediaType)
+	if err != nil {
+		return nil, err
+	}
+	image, err := mutate.Append(base, mutate.Addendum{
+		Layer: layer,
+		History: v1.History{
+			Author:    "buildgo",
+			Created:   v1.Time{Time: created},
+			CreatedBy: "buildgo " + filepath.Base(binary),
+		},
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	configFile, err := image.ConfigFile()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	configFile = configFile.DeepCopy()
+	configFile.OS = platform.OS
+	configFile.Architecture = platform.Arch
+	configFile.Created = v1.Time{Time: created}
+	configFile.Config.Entrypoint = append([]string{"/" + filepath.Base(binary)}, config.Args...)
+	configFile.Config.Cmd = nil
+	if configFile.Config.Labels == nil {
+		configFile.Config.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		configFile.Config.Labels[k] = v
+	}
+	image, err = mutate.ConfigFile(image, configFile)
+	return image, errors.WithStack(err)
+}
+
+// binaryLayer returns the image layer containing the binary stored in the root directory
+func binaryLayer(binary string, created time.Time, mediaType types.MediaType) (v1.Layer, error) {
+	content, err := os.ReadFile(binary)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     filepath.Base(binary),
+		Mode:     0o755,
+		Size:     int64(len(content)),
+		ModTime:  created,
+		Format:   tar.FormatPAX,
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, tarball.WithMediaType(mediaType))
+	return layer, errors.WithStack(err)
+}
+
+// writeOCILayout stores image, or index if it is not nil, in the OCI image layout, annotated with the tags
+func writeOCILayout(dir string, tags []string, image v1.Image, index v1.ImageIndex) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.WithStack(err)
+	}
+	path, err := layout.Write(dir, empty.Index)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, tag := range tags {
+		option := layout.WithAnnotations(map[string]string{"org.opencontainers.image.ref.name": tag})
+		if index != nil {
+			err = path.AppendIndex(index, option)
+		} else {
+			err = path.AppendImage(image, option)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/outofforest/libexec"
+	"github.com/pkg/errors"
+)
+
+type otelSpanKey struct{}
+
+// endSpanFunc finishes the span, adding attributes to it
+type endSpanFunc func(err error, attributes ...otelAttribute)
+
+type otelAttribute struct {
+	Key   string    `json:"key"`
+	Value otelValue `json:"value"`
+}
+
+type otelValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otelStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// otelSpan is the span in the OTLP JSON format
+type otelSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otelAttribute `json:"attributes,omitempty"`
+	Status       otelStatus      `json:"status"`
+}
+
+var (
+	otelMu     sync.Mutex
+	otelOnce   sync.Once
+	otelTrace  string
+	otelParent string
+	otelSpans  []otelSpan
+)
+
+func stringAttribute(key, value string) otelAttribute {
+	return otelAttribute{Key: key, Value: otelValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value int) otelAttribute {
+	v := strconv.Itoa(value)
+	return otelAttribute{Key: key, Value: otelValue{IntValue: &v}}
+}
+
+// otelEndpoint returns the URL spans are sent to, empty string is returned if tracing is disabled.
+// Build steps are exported as spans to the OTLP endpoint configured using standard environment variables:
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS
+// and OTEL_SERVICE_NAME. Spans are sent using OTLP/HTTP with JSON encoding. If TRACEPARENT environment variable
+// is set, spans are attached to the trace of the parent, e.g. the CI job.
+func otelEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// startSpan starts the span being a child of the span stored in ctx. Returned context contains the new span.
+// Span is finished by calling returned function. If tracing is disabled, nothing is recorded.
+func startSpan(ctx context.Context, name string, attributes ...otelAttribute) (context.Context, endSpanFunc) {
+	return startSpanAt(ctx, name, time.Now(), attributes...)
+}
+
+// startSpanAt starts the span at the time in the past, see startSpan
+func startSpanAt(ctx context.Context, name string, start time.Time,
+	attributes ...otelAttribute,
+) (context.Context, endSpanFunc) {
+	if otelEndpoint() == "" {
+		return ctx, func(error, ...otelAttribute) {}
+	}
+
+	span := otelSpan{
+		TraceID:    otelTraceID(),
+		SpanID:     randomHex(8),
+		Name:       name,
+		Kind:       1, // internal
+		Start:      strconv.FormatInt(start.UnixNano(), 10),
+		Attributes: attributes,
+	}
+	if parent, ok := ctx.Value(otelSpanKey{}).(string); ok {
+		span.ParentSpanID = parent
+	} else {
+		span.ParentSpanID = otelParent
+	}
+
+	return context.WithValue(ctx, otelSpanKey{}, span.SpanID), func(err error, attributes ...otelAttribute) {
+		span.End = strconv.FormatInt(time.Now().UnixNano(), 10)
+		span.Attributes = append(span.Attributes, attributes...)
+		span.Status.Code = 1 // ok
+		if err != nil {
+			span.Status = otelStatus{Code: 2, Message: err.Error()}
+		}
+
+		otelMu.Lock()
+		defer otelMu.Unlock()
+		otelSpans = append(otelSpans, span)
+	}
+}
+
+// otelTraceID returns the ID of the trace all the spans belong to
+func otelTraceID() string {
+	otelOnce.Do(func() {
+		// traceparent is formatted as version-traceid-parentid-flags, see https://www.w3.org/TR/trace-context
+		if parts := strings.Split(os.Getenv("TRACEPARENT"), "-"); len(parts) == 4 && len(parts[1]) == 32 &&
+			len(parts[2]) == 16 {
+			otelTrace = parts[1]
+			otelParent = parts[2]
+			return
+		}
+		otelTrace = randomHex(16)
+	})
+	return otelTrace
+}
+
+func randomHex(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// execCmds executes commands using libexec.Exec, the execution is recorded as a span.
+// In dry-run mode commands are printed instead, unless all of them are queries, see dryRun.
+// Output of commands depends on the verbosity, see verbosity. Go commands use vendored dependencies if vendoring
+// is enabled, see useVendor.
+func execCmds(ctx context.Context, cmds ...*exec.Cmd) error {
+	if err := useVendor(cmds); err != nil {
+		return err
+	}
+	if dryRun() {
+		for _, cmd := range cmds {
+			if !isQueryCmd(cmd) {
+				printDryRun(cmds)
+				return nil
+			}
+		}
+	}
+	switch verbosity() {
+	case verbosityQuiet:
+		return execQuiet(ctx, cmds)
+	case verbosityVerbose:
+		echoCmds(ctx, cmds)
+	}
+	return execTraced(ctx, cmds...)
+}
+
+// execTraced executes commands, the execution is recorded as a span
+func execTraced(ctx context.Context, cmds ...*exec.Cmd) error {
+	if otelEndpoint() == "" || len(cmds) == 0 {
+		return libexec.Exec(ctx, cmds...)
+	}
+
+	commands := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		commands = append(commands, strings.Join(cmd.Args, " "))
+	}
+	dir := cmds[0].Dir
+	if dir == "" {
+		dir = "."
+	}
+	ctx, endSpan := startSpan(ctx, "exec "+filepath.Base(cmds[0].Path), stringAttribute("command",
+		strings.Join(commands, " && ")), stringAttribute("dir", dir))
+
+	err := libexec.Exec(ctx, cmds...)
+
+	exitCode := -1
+	for _, cmd := range cmds {
+		if cmd.ProcessState != nil {
+			exitCode = cmd.ProcessState.ExitCode()
+		}
+	}
+	endSpan(err, intAttribute("exit_code", exitCode))
+	return err
+}
+
+// exportSpans sends finished spans to the OTLP endpoint
+func exportSpans() error {
+	endpoint := otelEndpoint()
+	if endpoint == "" {
+		return nil
+	}
+
+	otelMu.Lock()
+	spans := otelSpans
+	otelSpans = nil
+	otelMu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "buildgo"
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otelAttribute{stringAttribute("service.name", serviceName)},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "github.com/outofforest/buildgo"},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if key, value, ok := strings.Cut(header, "="); ok {
+			req.Header.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "exporting spans to '%s' failed", endpoint)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.Errorf("exporting spans to '%s' failed with status %s", endpoint, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// OutdatedConfig is the configuration of outdated dependency report
+type OutdatedConfig struct {
+	// MaxMinorBehind is the maximum number of minor versions direct dependency may be behind the latest one,
+	// check is disabled if 0. Major versions are not compared because in go they are distinct modules.
+	MaxMinorBehind int
+}
+
+// goModule is the module reported by `go list -m -json`
+type goModule struct {
+	Path    string
+	Version string
+	Update  *struct {
+		Version string
+	}
+}
+
+// GoDepsOutdated prints direct dependencies of all modules having newer versions available
+func GoDepsOutdated(ctx context.Context, deps build.DepsFunc, config OutdatedConfig) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+
+	var tooOld []string
+	err := onModule(ctx, func(path string) error {
+		log.Info("Looking for outdated dependencies", zap.String("path", path))
+
+		buf := &bytes.Buffer{}
+		cmd := exec.Command("go", "list", "-mod=readonly", "-m", "-f",
+			"{{if not (or .Main .Indirect)}}{{.Path}}{{end}}", "all")
+		cmd.Dir = path
+		cmd.Stdout = buf
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "listing dependencies of module '%s' failed", path)
+		}
+		direct := strings.Fields(buf.String())
+		if len(direct) == 0 {
+			return nil
+		}
+
+		buf.Reset()
+		cmd = exec.Command("go", append([]string{"list", "-mod=readonly", "-m", "-u", "-json"}, direct...)...)
+		cmd.Dir = path
+		cmd.Stdout = buf
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "checking updates of dependencies of module '%s' failed", path)
+		}
+
+		var outdated []goModule
+		decoder := json.NewDecoder(buf)
+		for {
+			var module goModule
+			if err := decoder.Decode(&module); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return errors.Wrapf(err, "parsing dependencies of module '%s' failed", path)
+			}
+			if module.Update != nil {
+				outdated = append(outdated, module)
+			}
+		}
+
+		if len(outdated) == 0 {
+			return nil
+		}
+
+		var maxLen int
+		for _, module := range outdated {
+			if len(module.Path) > maxLen {
+				maxLen = len(module.Path)
+			}
+		}
+		format := fmt.Sprintf("   %%-%ds  %%s -> %%s\n", maxLen)
+		fmt.Printf("\n Outdated dependencies of module %s:\n\n", path)
+		for _, module := range outdated {
+			fmt.Printf(format, module.Path, module.Version, module.Update.Version)
+
+			if config.MaxMinorBehind > 0 {
+				if behind := minorVersionsBehind(module.Version, module.Update.Version); behind > config.MaxMinorBehind {
+					tooOld = append(tooOld, fmt.Sprintf("%s@%s (%d minor versions behind, module '%s')",
+						module.Path, module.Version, behind, path))
+				}
+			}
+		}
+		fmt.Println()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(tooOld) > 0 {
+		return errors.Errorf("dependencies are too old: %s", strings.Join(tooOld, ", "))
+	}
+	return nil
+}
+
+func minorVersionsBehind(current, latest string) int {
+	currentMajor, currentMinor, ok1 := parseMajorMinor(current)
+	latestMajor, latestMinor, ok2 := parseMajorMinor(latest)
+	if !ok1 || !ok2 || currentMajor != latestMajor {
+		return 0
+	}
+	return latestMinor - currentMinor
+}
+
+func parseMajorMinor(version string) (int, int, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
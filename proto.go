@@ -0,0 +1,142 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"github.com/ridge/must"
+	"go.uber.org/zap"
+)
+
+// ProtoConfig is the configuration of protobuf code generation
+type ProtoConfig struct {
+	// Root is the directory containing .proto files, it is also the import root, "." is used if empty.
+	// Go files are generated next to the .proto files.
+	Root string
+
+	// Check verifies that generated files are up to date instead of writing them
+	Check bool
+}
+
+// GoProtoGenerate compiles all .proto files using protoc, protoc-gen-go and protoc-gen-go-grpc
+func GoProtoGenerate(ctx context.Context, deps build.DepsFunc, config ProtoConfig) error {
+	deps(EnsureGo, EnsureProtoC)
+	if err := ensureGoTools(ctx, "protoc-gen-go", "protoc-gen-go-grpc"); err != nil {
+		return err
+	}
+	log := logger.Get(ctx)
+	if config.Root == "" {
+		config.Root = "."
+	}
+
+	dirs, err := protoDirs(config.Root)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	outDir := config.Root
+	if config.Check {
+		outDir, err = os.MkdirTemp("", "buildgo-proto-*")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer os.RemoveAll(outDir)
+	}
+
+	// Each directory is a separate proto package, so files are compiled together per directory
+	for _, dir := range sortedKeys(dirs) {
+		log.Info("Generating go code from proto files", zap.String("path", filepath.Join(config.Root, dir)))
+
+		args := []string{
+			"-I", config.Root,
+			"--go_out", outDir, "--go_opt", "paths=source_relative",
+			"--go-grpc_out", outDir, "--go-grpc_opt", "paths=source_relative",
+		}
+		for _, file := range dirs[dir] {
+			args = append(args, filepath.Join(config.Root, file))
+		}
+		cmd := exec.Command("protoc", args...)
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "compiling proto files in '%s' failed", dir)
+		}
+	}
+
+	if !config.Check {
+		return nil
+	}
+
+	var outdated []string
+	err = filepath.WalkDir(outDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		relPath := must.String(filepath.Rel(outDir, path))
+		generated, err := os.ReadFile(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		existing, err := os.ReadFile(filepath.Join(config.Root, relPath))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+		if !bytes.Equal(generated, existing) {
+			outdated = append(outdated, filepath.Join(config.Root, relPath))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(outdated) > 0 {
+		return errors.Errorf("generated proto files are not up to date: %s", strings.Join(outdated, ", "))
+	}
+	return nil
+}
+
+// protoDirs returns .proto files found in root, grouped by directory, paths are relative to root
+func protoDirs(root string) (map[string][]string, error) {
+	dirs := map[string][]string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if d.IsDir() {
+			switch d.Name() {
+			case ".git", "bin", "node_modules", "vendor":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".proto" {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		dirs[filepath.Dir(relPath)] = append(dirs[filepath.Dir(relPath)], relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, files := range dirs {
+		sort.Strings(files)
+	}
+	return dirs, nil
+}
@@ -0,0 +1,236 @@
+package buildgo
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ProvenanceExt is appended to the path of the artifact to get the path of its provenance
+const ProvenanceExt = ".intoto.json"
+
+// ProvenanceBuildType identifies the format of build parameters stored in the provenance
+const ProvenanceBuildType = "https://github.com/outofforest/buildgo/provenance/v1"
+
+// ProvenanceConfig is the configuration of SLSA provenance
+type ProvenanceConfig struct {
+	// Build is the configuration used to build the artifacts, it is recorded as external parameters of the build
+	Build BuildConfig
+
+	// BuilderID identifies the builder. If empty, value of BUILDGO_BUILDER_ID environment variable is used.
+	// If it is not set either, the workflow is used when running in GitHub Actions.
+	BuilderID string
+
+	// Images is the list of container images the provenance is attached to, as cosign attestation
+	Images []string
+
+	// Sign is the configuration used to sign attestations of images, only cosign is supported
+	Sign SignConfig
+}
+
+// slsaPredicate is the SLSA provenance predicate in version 1
+type slsaPredicate struct {
+	BuildDefinition struct {
+		BuildType            string                 `json:"buildType"`
+		ExternalParameters   provenanceParameters   `json:"externalParameters"`
+		InternalParameters   map[string]string      `json:"internalParameters,omitempty"`
+		ResolvedDependencies []provenanceDescriptor `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string `json:"invocationId,omitempty"`
+			FinishedOn   string `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// provenanceParameters are the parameters of the build recorded in the provenance
+type provenanceParameters struct {
+	Package      string    `json:"package"`
+	Platform     string    `json:"platform,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	LDFlags      []string  `json:"ldflags,omitempty"`
+	GCFlags      []string  `json:"gcflags,omitempty"`
+	BuildMode    BuildMode `json:"buildmode,omitempty"`
+	CGOEnabled   bool      `json:"cgoEnabled"`
+	Static       bool      `json:"static,omitempty"`
+	Race         bool      `json:"race,omitempty"`
+	Reproducible bool      `json:"reproducible,omitempty"`
+}
+
+// provenanceDescriptor is the in-toto resource descriptor
+type provenanceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+// GoProvenance stores SLSA provenance of each artifact in the in-toto statement, next to the artifact,
+// with ProvenanceExt appended to its path. Provenance describes the builder, the source commit and build
+// parameters. If images are configured, provenance is attached to them as cosign attestation.
+func GoProvenance(ctx context.Context, deps build.DepsFunc, config ProvenanceConfig, artifacts ...string) error {
+	log := logger.Get(ctx)
+
+	predicate, err := provenancePredicate(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	for _, artifact := range artifacts {
+		checksum, err := fileChecksum(artifact)
+		if err != nil {
+			return err
+		}
+		statement, err := json.MarshalIndent(struct {
+			Type          string                 `json:"_type"`
+			Subject       []provenanceDescriptor `json:"subject"`
+			PredicateType string                 `json:"predicateType"`
+			Predicate     slsaPredicate          `json:"predicate"`
+		}{
+			Type: "https://in-toto.io/Statement/v1",
+			Subject: []provenanceDescriptor{{
+				Name:   filepath.Base(artifact),
+				Digest: map[string]string{"sha256": checksum},
+			}},
+			PredicateType: "https://slsa.dev/provenance/v1",
+			Predicate:     predicate,
+		}, "", "  ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		file := artifact + ProvenanceExt
+		log.Info("Storing provenance", zap.String("path", file))
+		if dryRun() {
+			continue
+		}
+		if err := os.WriteFile(file, append(statement, '\n'), 0o644); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if len(config.Images) == 0 {
+		return nil
+	}
+
+	signConfig, err := signConfigFromEnv(config.Sign)
+	if err != nil {
+		return err
+	}
+	if signConfig.Signer != SignerCosign {
+		return errors.Errorf("provenance can be attached to images by cosign only, not by %s", signConfig.Signer)
+	}
+	deps(EnsureCosign)
+
+	predicateFile, err := os.CreateTemp("", "buildgo-provenance-*.json")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(predicateFile.Name())
+	defer predicateFile.Close()
+
+	if err := json.NewEncoder(predicateFile).Encode(predicate); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := predicateFile.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, image := range config.Images {
+		log.Info("Attaching provenance to image", zap.String("image", image))
+
+		args := []string{"attest", "--yes", "--type", "slsaprovenance1", "--predicate", predicateFile.Name()}
+		if signConfig.Key != "" {
+			args = append(args, "--key", signConfig.Key)
+		}
+		if err := execCmds(ctx, exec.Command("cosign", append(args, image)...)); err != nil {
+			return errors.Wrapf(err, "attaching provenance to image '%s' failed", image)
+		}
+	}
+	return nil
+}
+
+// provenancePredicate returns the SLSA provenance predicate describing the current build
+func provenancePredicate(ctx context.Context, config ProvenanceConfig) (slsaPredicate, error) {
+	commit, err := gitOutput(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return slsaPredicate{}, err
+	}
+	ref, err := gitOutput(ctx, "rev-parse", "--symbolic-full-name", "HEAD")
+	if err != nil {
+		return slsaPredicate{}, err
+	}
+	goVersion, err := goEnv(ctx, "GOVERSION")
+	if err != nil {
+		return slsaPredicate{}, err
+	}
+	tags, err := withRepoTags(config.Build.Tags)
+	if err != nil {
+		return slsaPredicate{}, err
+	}
+	source := provenanceDescriptor{Digest: map[string]string{"gitCommit": commit}}
+	// Repository may have no remote, e.g. in local builds
+	if remote, err := gitOutput(ctx, "remote", "get-url", "origin"); err == nil {
+		source.URI = "git+" + remote
+		if ref != "HEAD" {
+			source.URI += "@" + ref
+		}
+	}
+
+	var predicate slsaPredicate
+	predicate.BuildDefinition.BuildType = ProvenanceBuildType
+	predicate.BuildDefinition.ExternalParameters = provenanceParameters{
+		Package:      config.Build.Package,
+		Tags:         tags,
+		LDFlags:      config.Build.LDFlags,
+		GCFlags:      config.Build.GCFlags,
+		BuildMode:    config.Build.BuildMode,
+		CGOEnabled:   config.Build.CGOEnabled,
+		Static:       config.Build.Static,
+		Race:         config.Build.Race,
+		Reproducible: config.Build.Reproducible,
+	}
+	if config.Build.Platform != (Platform{}) {
+		predicate.BuildDefinition.ExternalParameters.Platform = config.Build.Platform.String()
+	}
+	predicate.BuildDefinition.InternalParameters = map[string]string{"goVersion": goVersion}
+	predicate.BuildDefinition.ResolvedDependencies = []provenanceDescriptor{source}
+
+	builderID, invocationID := provenanceBuilder(config.BuilderID)
+	predicate.RunDetails.Builder.ID = builderID
+	predicate.RunDetails.Metadata.InvocationID = invocationID
+	predicate.RunDetails.Metadata.FinishedOn = time.Now().UTC().Format(time.RFC3339)
+	return predicate, nil
+}
+
+// provenanceBuilder returns the ID of the builder and the ID of the build invocation
+func provenanceBuilder(builderID string) (string, string) {
+	if builderID == "" {
+		builderID = os.Getenv("BUILDGO_BUILDER_ID")
+	}
+
+	var invocationID string
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		server := os.Getenv("GITHUB_SERVER_URL")
+		if builderID == "" {
+			builderID = server + "/" + os.Getenv("GITHUB_WORKFLOW_REF")
+		}
+		invocationID = server + "/" + os.Getenv("GITHUB_REPOSITORY") + "/actions/runs/" +
+			os.Getenv("GITHUB_RUN_ID") + "/attempts/" + os.Getenv("GITHUB_RUN_ATTEMPT")
+	}
+	if builderID == "" {
+		builderID = "https://github.com/outofforest/buildgo"
+	}
+	return builderID, invocationID
+}
@@ -0,0 +1,247 @@
+package buildgo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DefaultReleaseDir is the directory where release artifacts are stored by default
+const DefaultReleaseDir = "dist"
+
+// ReleaseConfig is the declarative configuration of the release pipeline. Steps configured by nil
+// fields are skipped. Fields of step configurations describing inputs and outputs of the step are set
+// by the pipeline, so they don't need to be set.
+type ReleaseConfig struct {
+	// Build is the configuration of released binaries, name of the binary is taken from the Binary field
+	Build BuildConfig
+
+	// Platforms is the list of platforms binaries are built for, platforms from the repository configuration
+	// are used if empty
+	Platforms []Platform
+
+	// Dir is the directory where artifacts are stored, DefaultReleaseDir is used if empty.
+	// Directory is cleaned before the release.
+	Dir string
+
+	// Snapshot builds all the artifacts without publishing them. Snapshot may be created from untagged
+	// commit and dirty tree. Images are stored in the image subdirectory of Dir in OCI layout.
+	Snapshot bool
+
+	// Archives configures release archives
+	Archives *ArchiveConfig
+
+	// SBOM configures SBOMs of binaries
+	SBOM *SBOMConfig
+
+	// Packages configures linux packages
+	Packages *LinuxPackageConfig
+
+	// Images configures container images, they are built without docker
+	Images *ImageConfig
+
+	// Sign configures signing of the checksum file and images
+	Sign *SignConfig
+
+	// Provenance configures SLSA provenance of artifacts and images
+	Provenance *ProvenanceConfig
+
+	// GitHub configures GitHub release receiving all the artifacts. Description of the release
+	// is taken from the changelog section of the version, see GitChangelog.
+	GitHub *GitHubReleaseConfig
+
+	// Homebrew configures Homebrew formula, it requires archives
+	Homebrew *HomebrewConfig
+}
+
+// Release runs the release pipeline: binaries are built for all the platforms, packaged into archives
+// and linux packages, described by SBOMs and checksums, signed, attested and published
+func Release(ctx context.Context, deps build.DepsFunc, config ReleaseConfig) error {
+	log := logger.Get(ctx)
+
+	if config.Dir == "" {
+		config.Dir = DefaultReleaseDir
+	}
+	platforms := config.Platforms
+	if len(platforms) == 0 {
+		var err error
+		platforms, err = repoPlatforms()
+		if err != nil {
+			return err
+		}
+		if len(platforms) == 0 {
+			return errors.New("no platforms to release for")
+		}
+	}
+	if config.Homebrew != nil && config.Archives == nil {
+		return errors.New("homebrew formula requires archives")
+	}
+
+	version, err := Version(ctx)
+	if err != nil {
+		return err
+	}
+	if !config.Snapshot {
+		if !version.Released() {
+			return errors.Errorf("HEAD is not tagged with version, current version is %s", version)
+		}
+		if err := GitStatusClean(ctx); err != nil {
+			return err
+		}
+	}
+	log.Info("Releasing", zap.Stringer("version", version), zap.String("dir", config.Dir),
+		zap.Bool("snapshot", config.Snapshot))
+
+	if !dryRun() {
+		if err := os.RemoveAll(config.Dir); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	buildConfig := config.Build
+	binaryName := filepath.Base(buildConfig.Binary)
+	if buildConfig.Binary == "" {
+		binaryName = filepath.Base(buildConfig.Package)
+	}
+	buildConfig.Binary = filepath.Join(config.Dir, binaryName)
+	buildConfig.NameTemplate = DefaultNameTemplate
+	buildConfig.ChecksumFile = ""
+	if err := GoBuildMatrix(ctx, buildConfig, platforms...); err != nil {
+		return err
+	}
+
+	binaries, err := releaseArtifacts(config.Dir)
+	if err != nil {
+		return err
+	}
+	if config.SBOM != nil {
+		if err := GoSBOM(ctx, *config.SBOM, binaries...); err != nil {
+			return err
+		}
+	}
+	if config.Archives != nil {
+		config.Archives.Build = buildConfig
+		config.Archives.Dir = config.Dir
+		config.Archives.ChecksumFile = ""
+		if err := GoReleaseArchives(ctx, *config.Archives, platforms...); err != nil {
+			return err
+		}
+	}
+	if config.Packages != nil {
+		config.Packages.Build = buildConfig
+		config.Packages.Dir = config.Dir
+		if err := GoLinuxPackages(ctx, deps, *config.Packages, platforms...); err != nil {
+			return err
+		}
+	}
+
+	artifacts, err := releaseArtifacts(config.Dir)
+	if err != nil {
+		return err
+	}
+	checksumFile := filepath.Join(config.Dir, ChecksumsFile)
+	if !skipInDryRun(ctx, "Writing checksums", zap.String("path", checksumFile)) {
+		if err := WriteChecksums(checksumFile, artifacts...); err != nil {
+			return err
+		}
+	}
+	if config.Sign != nil {
+		if err := SignFiles(ctx, deps, *config.Sign, checksumFile); err != nil {
+			return err
+		}
+	}
+	if config.Provenance != nil {
+		config.Provenance.Build = buildConfig
+		config.Provenance.Images = nil
+		if err := GoProvenance(ctx, deps, *config.Provenance, artifacts...); err != nil {
+			return err
+		}
+	}
+
+	if config.Images != nil {
+		imageConfig := *config.Images
+		imageConfig.Build = config.Build
+		imageConfig.Build.Binary = binaryName
+		imageConfig.Platforms = nil
+		for _, platform := range platforms {
+			if platform.OS == "linux" {
+				imageConfig.Platforms = append(imageConfig.Platforms, platform)
+			}
+		}
+		imageConfig.Push = !config.Snapshot
+		imageConfig.Layout = ""
+		if config.Snapshot {
+			imageConfig.Layout = filepath.Join(config.Dir, "image")
+		}
+		if err := GoBuildOCIImage(ctx, imageConfig); err != nil {
+			return err
+		}
+
+		if !config.Snapshot && config.Sign != nil {
+			if err := SignImages(ctx, deps, *config.Sign, imageConfig.Tags...); err != nil {
+				return err
+			}
+		}
+		if !config.Snapshot && config.Provenance != nil {
+			config.Provenance.Images = imageConfig.Tags
+			if config.Sign != nil {
+				config.Provenance.Sign = *config.Sign
+			}
+			// Provenance of artifacts has been already stored, so only images are attested
+			if err := GoProvenance(ctx, deps, *config.Provenance); err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.Snapshot {
+		log.Info("Snapshot created, artifacts are not published", zap.String("dir", config.Dir))
+		return nil
+	}
+
+	if config.GitHub != nil {
+		files, err := releaseArtifacts(config.Dir)
+		if err != nil {
+			return err
+		}
+		config.GitHub.Tag = version.Tag
+		config.GitHub.Files = files
+		if err := GitHubRelease(ctx, *config.GitHub); err != nil {
+			return err
+		}
+	}
+	if config.Homebrew != nil {
+		config.Homebrew.Archive = *config.Archives
+		if err := HomebrewFormula(ctx, *config.Homebrew, platforms...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseArtifacts returns files stored in the release directory
+func releaseArtifacts(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		// Release directory is not created in dry-run mode
+		if os.IsNotExist(err) && dryRun() {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	artifacts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			artifacts = append(artifacts, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return artifacts, nil
+}
@@ -0,0 +1,445 @@
+package buildgo
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"github.com/ridge/must"
+	"go.uber.org/zap"
+)
+
+// remoteCache stores results of targets remotely, so they are reused by other machines if modules haven't changed.
+// It is configured by BUILDGO_REMOTE_CACHE environment variable, supported locations are:
+//   - path of the directory, e.g. shared by network file system
+//   - s3://bucket/prefix - entries are transferred by the aws CLI
+//   - gs://bucket/prefix - entries are transferred by the gcloud CLI
+//   - http(s)://host/prefix - entries are downloaded by GET and uploaded by PUT requests, bearer token is taken
+//     from BUILDGO_REMOTE_CACHE_TOKEN environment variable if set
+//
+// If BUILDGO_REMOTE_CACHE_READONLY is set to true, entries are only restored, e.g. in builds of pull requests.
+// Cache never fails the build, errors are logged and the target is executed as if the entry didn't exist.
+type remoteCache struct {
+	location *url.URL
+	readOnly bool
+}
+
+// newRemoteCache returns the remote cache configured by the environment, nil is returned if it is disabled
+// or in dry-run mode
+func newRemoteCache() (*remoteCache, error) {
+	if dryRun() {
+		return nil, nil
+	}
+	return remoteCacheAt("BUILDGO_REMOTE_CACHE")
+}
+
+// remoteCacheAt returns the remote cache stored in the location set in the environment variable,
+// nil is returned if variable is not set
+func remoteCacheAt(variable string) (*remoteCache, error) {
+	location := os.Getenv(variable)
+	if location == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(strings.TrimSuffix(location, "/"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid value '%s' of %s", location, variable)
+	}
+	switch u.Scheme {
+	case "":
+		u = &url.URL{Scheme: "file", Path: must.String(filepath.Abs(location))}
+	case "s3", "gs", "http", "https":
+	default:
+		return nil, errors.Errorf("unsupported remote cache '%s'", location)
+	}
+	return &remoteCache{
+		location: u,
+		readOnly: os.Getenv("BUILDGO_REMOTE_CACHE_READONLY") == "true",
+	}, nil
+}
+
+// Restore downloads the entry and extracts its files into the repository. False is returned if entry does not exist.
+func (rc *remoteCache) Restore(ctx context.Context, key string) bool {
+	log := logger.Get(ctx).With(zap.String("key", key))
+
+	tmpDir, err := os.MkdirTemp("", "buildgo-cache-*")
+	if err != nil {
+		log.Warn("Restoring remote cache entry failed", zap.Error(err))
+		return false
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := filepath.Join(tmpDir, "entry.tar.gz")
+	exists, err := rc.download(ctx, key+".tar.gz", archive)
+	if err == nil && exists {
+		err = extractCacheEntry(archive)
+	}
+	if err != nil {
+		log.Warn("Restoring remote cache entry failed", zap.Error(err))
+		return false
+	}
+	if exists {
+		log.Info("Remote cache entry restored")
+	}
+	return exists
+}
+
+// Store archives files and uploads them as the entry, paths of the files must be inside the repository
+func (rc *remoteCache) Store(ctx context.Context, key string, files ...string) {
+	if rc.readOnly {
+		return
+	}
+	log := logger.Get(ctx).With(zap.String("key", key))
+
+	tmpDir, err := os.MkdirTemp("", "buildgo-cache-*")
+	if err != nil {
+		log.Warn("Storing remote cache entry failed", zap.Error(err))
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := filepath.Join(tmpDir, "entry.tar.gz")
+	err = writeCacheEntry(archive, files)
+	if err == nil {
+		err = rc.upload(ctx, key+".tar.gz", archive)
+	}
+	if err != nil {
+		log.Warn("Storing remote cache entry failed", zap.Error(err))
+		return
+	}
+	log.Info("Remote cache entry stored")
+}
+
+func (rc *remoteCache) objectURL(name string) string {
+	return rc.location.String() + "/" + name
+}
+
+// download stores the object in the file, false is returned if object does not exist
+func (rc *remoteCache) download(ctx context.Context, name, file string) (bool, error) {
+	entry := rc.objectURL(name)
+	switch rc.location.Scheme {
+	case "file":
+		f, err := os.Open(filepath.Join(rc.location.Path, filepath.FromSlash(name)))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, errors.WithStack(err)
+		}
+		defer f.Close()
+		return true, storeFile(file, f, 0o600)
+	case "s3":
+		// ls fails if object does not exist
+		cmd := exec.Command("aws", "s3", "ls", entry)
+		cmd.Stdout = io.Discard
+		if err := execCmds(ctx, cmd); err != nil {
+			return false, nil
+		}
+		return true, execCmds(ctx, exec.Command("aws", "s3", "cp", "--only-show-errors", entry, file))
+	case "gs":
+		// ls fails if object does not exist
+		cmd := exec.Command("gcloud", "storage", "ls", entry)
+		cmd.Stdout = io.Discard
+		if err := execCmds(ctx, cmd); err != nil {
+			return false, nil
+		}
+		return true, execCmds(ctx, exec.Command("gcloud", "storage", "cp", entry, file))
+	}
+
+	resp, err := rc.httpDo(ctx, http.MethodGet, entry, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, storeFile(file, resp.Body, 0o600)
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, errors.Errorf("downloading '%s' failed, status: %s", entry, resp.Status)
+	}
+}
+
+// upload stores the file as the object
+func (rc *remoteCache) upload(ctx context.Context, name, file string) error {
+	entry := rc.objectURL(name)
+	switch rc.location.Scheme {
+	case "file":
+		return copyFileAtomic(file, filepath.Join(rc.location.Path, filepath.FromSlash(name)))
+	case "s3":
+		return execCmds(ctx, exec.Command("aws", "s3", "cp", "--only-show-errors", file, entry))
+	case "gs":
+		return execCmds(ctx, exec.Command("gcloud", "storage", "cp", file, entry))
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	resp, err := rc.httpDo(ctx, http.MethodPut, entry, f)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.Errorf("uploading '%s' failed, status: %s", entry, resp.Status)
+	}
+	return nil
+}
+
+func (rc *remoteCache) httpDo(ctx context.Context, method, entry string, body *os.File) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, entry, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if body != nil {
+		info, err := body.Stat()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		req.Body = body
+		req.ContentLength = info.Size()
+	}
+	if token := os.Getenv("BUILDGO_REMOTE_CACHE_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return resp, nil
+}
+
+// copyFileAtomic copies the file, so readers never see partially written destination, e.g. when directory
+// is shared by many machines
+func copyFileAtomic(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(out.Name())
+
+	_, err = io.Copy(out, in)
+	if err2 := out.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Chmod(out.Name(), 0o644); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(out.Name(), dst))
+}
+
+// writeCacheEntry stores files in the archive using paths relative to the repository root
+func writeCacheEntry(archive string, files []string) error {
+	repoDir := must.String(filepath.Abs("."))
+	entries := map[string]string{}
+	for _, file := range files {
+		relPath, err := filepath.Rel(repoDir, must.String(filepath.Abs(file)))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if strings.HasPrefix(relPath, "..") {
+			return errors.Errorf("file '%s' is outside of the repository", file)
+		}
+		entries[filepath.ToSlash(relPath)] = file
+	}
+	return writeTarGzArchive(archive, entries, time.Now())
+}
+
+// extractCacheEntry extracts files of the archive into the repository. Remote cache is shared, so only regular
+// files placed inside the repository are accepted, links could be used to write files anywhere else.
+func extractCacheEntry(archive string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	repoDir := must.String(filepath.Abs("."))
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return errors.Errorf("cache entry contains '%s' which is not a regular file", header.Name)
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return errors.Errorf("cache entry contains '%s' which is outside of the repository", header.Name)
+		}
+		path, err := extractPath(repoDir, name)
+		if err != nil {
+			return err
+		}
+		// Existing file is removed, so content is never written through the link placed there
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+		if err := storeFile(path, tr, header.FileInfo().Mode().Perm()); err != nil {
+			return err
+		}
+	}
+}
+
+// remoteCacheKey computes the key of the entry from the kind of the target and its inputs
+func remoteCacheKey(ctx context.Context, kind string, inputs ...string) (string, error) {
+	goVersion, err := goEnv(ctx, "GOVERSION")
+	if err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s\n%s\n%s/%s\n", kind, goVersion, runtime.GOOS, runtime.GOARCH)
+	for _, input := range inputs {
+		fmt.Fprintf(hasher, "%s\n", input)
+	}
+	return fmt.Sprintf("%s-%x", kind, hasher.Sum(nil)), nil
+}
+
+var (
+	moduleHashesMu sync.Mutex
+	moduleHashes   map[string]string
+)
+
+// moduleContentHash returns the hash of files belonging to the module, modules it requires from the repository
+// and files shared by all the modules. Files are taken from git, so ignored ones are not included.
+func moduleContentHash(ctx context.Context, path string) (string, error) {
+	moduleHashesMu.Lock()
+	defer moduleHashesMu.Unlock()
+
+	if moduleHashes == nil {
+		hashes, err := computeModuleHashes(ctx)
+		if err != nil {
+			return "", err
+		}
+		moduleHashes = hashes
+	}
+	hash, exists := moduleHashes[filepath.ToSlash(filepath.Clean(path))]
+	if !exists {
+		return "", errors.Errorf("module '%s' does not exist", path)
+	}
+	return hash, nil
+}
+
+func computeModuleHashes(ctx context.Context) (map[string]string, error) {
+	files, err := gitOutput(ctx, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	modules := map[string]goModFile{}
+	localModules := map[string]string{}
+	var paths []string
+	if err := repoModules(ctx, func(path string) error {
+		goMod, err := readGoMod(ctx, path)
+		if err != nil {
+			return err
+		}
+		path = filepath.ToSlash(path)
+		modules[path] = goMod
+		localModules[goMod.Module.Path] = path
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	// The deepest module containing the file owns it
+	sort.Slice(paths, func(i, j int) bool {
+		return len(paths[i]) > len(paths[j])
+	})
+
+	shared := sha256.New()
+	fileHashes := map[string]*strings.Builder{}
+	for _, path := range paths {
+		fileHashes[path] = &strings.Builder{}
+	}
+	for _, file := range strings.Split(files, "\x00") {
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			// Deleted files and submodules are skipped
+			continue
+		}
+
+		if contains(sharedFiles, file) || contains(RepoConfigFiles, file) {
+			if err := hashFile(shared, file); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, path := range paths {
+			if path == "." || strings.HasPrefix(file, path+"/") {
+				hasher := sha256.New()
+				if err := hashFile(hasher, file); err != nil {
+					return nil, err
+				}
+				fmt.Fprintf(fileHashes[path], "%x\n", hasher.Sum(nil))
+				break
+			}
+		}
+	}
+
+	hashes := make(map[string]string, len(paths))
+	for _, path := range paths {
+		// Module depends on the modules of the repository it requires, directly or indirectly
+		required := map[string]bool{path: true}
+		queue := []string{path}
+		for len(queue) > 0 {
+			for _, require := range modules[queue[0]].Require {
+				if dep, exists := localModules[require.Path]; exists && !required[dep] {
+					required[dep] = true
+					queue = append(queue, dep)
+				}
+			}
+			queue = queue[1:]
+		}
+
+		hasher := sha256.New()
+		fmt.Fprintf(hasher, "%x\n", shared.Sum(nil))
+		for _, dep := range sortedKeys(required) {
+			fmt.Fprintf(hasher, "%s\n%s", dep, fileHashes[dep].String())
+		}
+		hashes[path] = fmt.Sprintf("%x", hasher.Sum(nil))
+	}
+	return hashes, nil
+}
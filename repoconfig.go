@@ -0,0 +1,159 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfigFiles are the files, relative to the root of the repository, searched for the repository
+// configuration. The first existing one is used.
+var RepoConfigFiles = []string{".buildgo.yaml", "build/config.yaml"}
+
+// RepoConfig is the configuration of buildgo declared once for the whole repository.
+// Values set explicitly in the code take precedence over the ones defined here.
+type RepoConfig struct {
+	// Tags is the list of build tags added to all the builds and tests
+	Tags []string `yaml:"tags"`
+
+	// ModuleExcludes is the list of patterns of directories skipped while discovering modules,
+	// in addition to ModuleExcludes
+	ModuleExcludes []string `yaml:"moduleExcludes"`
+
+	// MinCoverage is the minimum coverage percentage required in each module, used if not set in TestConfig
+	MinCoverage float64 `yaml:"minCoverage"`
+
+	// ModuleMinCoverage overrides MinCoverage for modules, keys are module paths relative to repository root
+	ModuleMinCoverage map[string]float64 `yaml:"moduleMinCoverage"`
+
+	// Tools maps names of the tools to versions used instead of the default ones
+	Tools map[string]string `yaml:"tools"`
+
+	// Platforms is the list of platforms in the os/arch form, used by GoBuildMatrix if no platform is passed
+	Platforms []string `yaml:"platforms"`
+
+	// IncludeGenerated includes generated go files in format checks, complexity metrics and coverage thresholds,
+	// they are excluded by default
+	IncludeGenerated bool `yaml:"includeGenerated"`
+
+	// Mocks is the list of mocks generated by GoMocks
+	Mocks []MockSpec `yaml:"mocks"`
+
+	// Vendor enables vendoring, dependencies of modules are stored in vendor directories by GoModVendor
+	// and go commands use them by passing -mod=vendor
+	Vendor bool `yaml:"vendor"`
+}
+
+var (
+	repoConfigOnce sync.Once
+	repoConfig     RepoConfig
+	repoConfigErr  error
+)
+
+// LoadRepoConfig returns the configuration of the repository, it is read once and cached.
+// Empty configuration is returned if none of RepoConfigFiles exists.
+func LoadRepoConfig() (RepoConfig, error) {
+	repoConfigOnce.Do(func() {
+		repoConfig, repoConfigErr = readRepoConfig()
+	})
+	return repoConfig, repoConfigErr
+}
+
+func readRepoConfig() (RepoConfig, error) {
+	for _, file := range RepoConfigFiles {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return RepoConfig{}, errors.WithStack(err)
+		}
+
+		var config RepoConfig
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+			return RepoConfig{}, errors.Wrapf(err, "parsing repository configuration '%s' failed", file)
+		}
+		for _, platform := range config.Platforms {
+			if _, err := ParsePlatform(platform); err != nil {
+				return RepoConfig{}, errors.Wrapf(err, "invalid repository configuration '%s'", file)
+			}
+		}
+		return config, nil
+	}
+	return RepoConfig{}, nil
+}
+
+// repoPlatforms returns platforms defined by the repository configuration
+func repoPlatforms() ([]Platform, error) {
+	config, err := LoadRepoConfig()
+	if err != nil {
+		return nil, err
+	}
+	platforms := make([]Platform, 0, len(config.Platforms))
+	for _, p := range config.Platforms {
+		platform, err := ParsePlatform(p)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, platform)
+	}
+	return platforms, nil
+}
+
+// withRepoTags returns tags extended by the ones defined in the repository configuration
+func withRepoTags(tags []string) ([]string, error) {
+	config, err := LoadRepoConfig()
+	if err != nil {
+		return nil, err
+	}
+	result := append([]string{}, tags...)
+	for _, tag := range config.Tags {
+		if !contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result, nil
+}
+
+// withRepoGoToolVersion returns the go tool in the version set by the repository configuration
+func withRepoGoToolVersion(name string, tool goTool) (goTool, error) {
+	config, err := LoadRepoConfig()
+	if err != nil {
+		return goTool{}, err
+	}
+	if version := config.Tools[name]; version != "" {
+		tool.Version = version
+	}
+	return tool, nil
+}
+
+// withRepoToolVersion returns the tool in the version set by the repository configuration
+func withRepoToolVersion(tool Tool) (Tool, error) {
+	config, err := LoadRepoConfig()
+	if err != nil {
+		return Tool{}, err
+	}
+	version := config.Tools[tool.Name]
+	if version == "" || version == tool.Version {
+		return tool, nil
+	}
+	resolve, exists := toolResolvers[tool.Name]
+	if !exists {
+		return Tool{}, errors.Errorf("version of tool '%s' cannot be changed", tool.Name)
+	}
+	// Pinned artifacts belong to the default version, so all of them are resolved
+	return Tool{
+		Name:    tool.Name,
+		Version: version,
+		Resolve: func(ctx context.Context, platform Platform) (ToolArtifact, error) {
+			return resolve(ctx, version, platform)
+		},
+	}, nil
+}
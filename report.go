@@ -0,0 +1,142 @@
+package buildgo
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// Results of the targets stored in the build report
+const (
+	ReportResultSuccess = "success"
+	ReportResultFailure = "failure"
+)
+
+// ReportRecord is the record appended to the build report file for every command and every target run by it.
+// Build report is written in JSON lines format to the file set in BUILDGO_REPORT environment variable.
+type ReportRecord struct {
+	// Target is the name of the command, e.g. dev/lint, or of the target run by it, e.g. build, lint or test
+	Target string `json:"target"`
+
+	// Module is the path of the module target was run for, empty if target is not module-specific
+	Module string `json:"module,omitempty"`
+
+	// Start is the time target was started at
+	Start time.Time `json:"start"`
+
+	// Duration is the duration of the target in seconds
+	Duration float64 `json:"duration"`
+
+	// Result is either ReportResultSuccess or ReportResultFailure
+	Result string `json:"result"`
+
+	// Error is the error returned by failed target
+	Error string `json:"error,omitempty"`
+
+	// Artifacts are files produced by the target
+	Artifacts []string `json:"artifacts,omitempty"`
+
+	// Versions are versions of the repository and go toolchain used by the target
+	Versions map[string]string `json:"versions"`
+}
+
+// targetRun is the run of the target recorded in the job summary and the build report
+type targetRun struct {
+	Target    string
+	Module    string
+	Start     time.Time
+	Err       error
+	Artifacts []string
+}
+
+var (
+	reportMu       sync.Mutex
+	reportVersions map[string]string
+)
+
+// recordTarget adds the run of the target to timings, traces, the job summary and the build report
+func recordTarget(ctx context.Context, run targetRun) error {
+	if dryRun() {
+		return nil
+	}
+
+	subject := run.Module
+	if subject == "" {
+		subject = strings.Join(run.Artifacts, ", ")
+	}
+	recordSpan(spanTarget, run.Target, subject, run.Start)
+
+	attributes := []otelAttribute{stringAttribute("target", run.Target)}
+	if run.Module != "" {
+		attributes = append(attributes, stringAttribute("module", run.Module))
+	}
+	if len(run.Artifacts) > 0 {
+		attributes = append(attributes, stringAttribute("artifacts", strings.Join(run.Artifacts, ",")))
+	}
+	_, endSpan := startSpanAt(ctx, run.Target+" "+subject, run.Start, attributes...)
+	endSpan(run.Err)
+
+	return multierr.Combine(
+		summarizeStep(run.Target+" "+subject, run.Start, run.Err),
+		reportTarget(ctx, run),
+	)
+}
+
+// reportTarget appends the record of the target run to the build report file
+func reportTarget(ctx context.Context, run targetRun) error {
+	file := os.Getenv("BUILDGO_REPORT")
+	if file == "" {
+		return nil
+	}
+
+	record := ReportRecord{
+		Target:    run.Target,
+		Module:    run.Module,
+		Start:     run.Start.UTC(),
+		Duration:  time.Since(run.Start).Seconds(),
+		Result:    ReportResultSuccess,
+		Artifacts: run.Artifacts,
+	}
+	if run.Err != nil {
+		record.Result = ReportResultFailure
+		record.Error = run.Err.Error()
+	}
+
+	reportMu.Lock()
+	defer reportMu.Unlock()
+
+	if reportVersions == nil {
+		goVersion, err := goEnv(ctx, "GOVERSION")
+		if err != nil {
+			return err
+		}
+		version, err := Version(ctx)
+		if err != nil {
+			return err
+		}
+		reportVersions = map[string]string{
+			"version": version.String(),
+			"go":      goVersion,
+		}
+	}
+	record.Versions = reportVersions
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return errors.WithStack(err)
+}
@@ -0,0 +1,301 @@
+package buildgo
+
+import (
+	"context"
+	"crypto/sha1"
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// SBOM formats
+const (
+	SBOMCycloneDX = "cyclonedx"
+	SBOMSPDX      = "spdx"
+)
+
+// sbomExtensions are the extensions appended to the path of the binary to get the path of SBOM file
+var sbomExtensions = map[string]string{
+	SBOMCycloneDX: ".cdx.json",
+	SBOMSPDX:      ".spdx.json",
+}
+
+// SBOMConfig is the configuration of SBOM generation
+type SBOMConfig struct {
+	// Formats is the list of SBOM formats to produce, all of them are produced if empty
+	Formats []string
+}
+
+// sbomComponent is the component of the binary found in its build information
+type sbomComponent struct {
+	Name    string
+	Version string
+	PURL    string
+}
+
+// GoSBOM generates SBOMs for the binaries built by go. Modules compiled into the binary are taken from the build
+// information embedded by go, the same reported by `go version -m`. SBOM is stored next to the binary,
+// in <binary>.cdx.json file for CycloneDX and <binary>.spdx.json for SPDX.
+func GoSBOM(ctx context.Context, config SBOMConfig, binaries ...string) error {
+	if len(config.Formats) == 0 {
+		config.Formats = []string{SBOMCycloneDX, SBOMSPDX}
+	}
+	for _, format := range config.Formats {
+		if _, exists := sbomExtensions[format]; !exists {
+			return errors.Errorf("unknown SBOM format '%s'", format)
+		}
+	}
+
+	sourceDateEpoch, err := gitSourceDateEpoch(ctx)
+	if err != nil {
+		return err
+	}
+	created := time.Unix(sourceDateEpoch, 0).UTC().Format(time.RFC3339)
+
+	for _, binary := range binaries {
+		info, err := buildinfo.ReadFile(binary)
+		if err != nil {
+			return errors.Wrapf(err, "reading build information of '%s' failed", binary)
+		}
+		checksum, err := fileChecksum(binary)
+		if err != nil {
+			return err
+		}
+
+		app := sbomComponent{Name: info.Main.Path, Version: info.Main.Version}
+		if app.Version == "" || app.Version == "(devel)" {
+			version, err := Version(ctx)
+			if err != nil {
+				return err
+			}
+			app.Version = version.String()
+		}
+		app.PURL = sbomPURL(app.Name, app.Version)
+
+		components := []sbomComponent{{
+			Name:    "stdlib",
+			Version: info.GoVersion,
+			PURL:    sbomPURL("stdlib", info.GoVersion),
+		}}
+		for _, dep := range info.Deps {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			components = append(components, sbomComponent{
+				Name:    dep.Path,
+				Version: dep.Version,
+				PURL:    sbomPURL(dep.Path, dep.Version),
+			})
+		}
+
+		// Serial number is derived from the binary, so SBOM is reproducible
+		serial := sbomUUID(checksum)
+		for _, format := range config.Formats {
+			var doc interface{}
+			switch format {
+			case SBOMCycloneDX:
+				doc = cycloneDXDocument(app, components, checksum, serial, created)
+			case SBOMSPDX:
+				doc = spdxDocument(filepath.Base(binary), app, components, checksum, serial, created)
+			}
+
+			content, err := json.MarshalIndent(doc, "", "  ")
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			file := binary + sbomExtensions[format]
+			logger.Get(ctx).Info("Storing SBOM", zap.String("path", file), zap.Int("components", len(components)))
+			if dryRun() {
+				continue
+			}
+			if err := os.WriteFile(file, append(content, '\n'), 0o644); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// cycloneDXDocument returns SBOM in CycloneDX 1.5 format
+func cycloneDXDocument(app sbomComponent, components []sbomComponent, checksum, serial,
+	created string,
+) interface{} {
+	type hash struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	}
+	type component struct {
+		Type    string `json:"type"`
+		BOMRef  string `json:"bom-ref"`
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+		PURL    string `json:"purl"`
+		Hashes  []hash `json:"hashes,omitempty"`
+	}
+	type dependency struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn,omitempty"`
+	}
+
+	deps := make([]component, 0, len(components))
+	dependsOn := make([]string, 0, len(components))
+	for _, c := range components {
+		deps = append(deps, component{Type: "library", BOMRef: c.PURL, Name: c.Name, Version: c.Version, PURL: c.PURL})
+		dependsOn = append(dependsOn, c.PURL)
+	}
+
+	return struct {
+		BOMFormat    string `json:"bomFormat"`
+		SpecVersion  string `json:"specVersion"`
+		SerialNumber string `json:"serialNumber"`
+		Version      int    `json:"version"`
+		Metadata     struct {
+			Timestamp string    `json:"timestamp"`
+			Component component `json:"component"`
+		} `json:"metadata"`
+		Components   []component  `json:"components"`
+		Dependencies []dependency `json:"dependencies"`
+	}{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + serial,
+		Version:      1,
+		Metadata: struct {
+			Timestamp string    `json:"timestamp"`
+			Component component `json:"component"`
+		}{
+			Timestamp: created,
+			Component: component{
+				Type:    "application",
+				BOMRef:  app.PURL,
+				Name:    app.Name,
+				Version: app.Version,
+				PURL:    app.PURL,
+				Hashes:  []hash{{Alg: "SHA-256", Content: checksum}},
+			},
+		},
+		Components:   deps,
+		Dependencies: []dependency{{Ref: app.PURL, DependsOn: dependsOn}},
+	}
+}
+
+// spdxDocument returns SBOM in SPDX 2.3 format
+func spdxDocument(name string, app sbomComponent, components []sbomComponent, checksum, serial,
+	created string,
+) interface{} {
+	type checksumEntry struct {
+		Algorithm     string `json:"algorithm"`
+		ChecksumValue string `json:"checksumValue"`
+	}
+	type externalRef struct {
+		ReferenceCategory string `json:"referenceCategory"`
+		ReferenceType     string `json:"referenceType"`
+		ReferenceLocator  string `json:"referenceLocator"`
+	}
+	type pkg struct {
+		Name             string          `json:"name"`
+		SPDXID           string          `json:"SPDXID"`
+		VersionInfo      string          `json:"versionInfo,omitempty"`
+		DownloadLocation string          `json:"downloadLocation"`
+		FilesAnalyzed    bool            `json:"filesAnalyzed"`
+		LicenseConcluded string          `json:"licenseConcluded"`
+		LicenseDeclared  string          `json:"licenseDeclared"`
+		CopyrightText    string          `json:"copyrightText"`
+		Checksums        []checksumEntry `json:"checksums,omitempty"`
+		ExternalRefs     []externalRef   `json:"externalRefs"`
+	}
+	type relationship struct {
+		SPDXElementID      string `json:"spdxElementId"`
+		RelationshipType   string `json:"relationshipType"`
+		RelatedSPDXElement string `json:"relatedSpdxElement"`
+	}
+
+	newPackage := func(id string, c sbomComponent) pkg {
+		return pkg{
+			Name:             c.Name,
+			SPDXID:           id,
+			VersionInfo:      c.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+			ExternalRefs: []externalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  c.PURL,
+			}},
+		}
+	}
+
+	mainPackage := newPackage("SPDXRef-Package-0", app)
+	mainPackage.Checksums = []checksumEntry{{Algorithm: "SHA256", ChecksumValue: checksum}}
+	packages := []pkg{mainPackage}
+	relationships := []relationship{{
+		SPDXElementID:      "SPDXRef-DOCUMENT",
+		RelationshipType:   "DESCRIBES",
+		RelatedSPDXElement: mainPackage.SPDXID,
+	}}
+	for i, c := range components {
+		p := newPackage(fmt.Sprintf("SPDXRef-Package-%d", i+1), c)
+		packages = append(packages, p)
+		relationships = append(relationships, relationship{
+			SPDXElementID:      mainPackage.SPDXID,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: p.SPDXID,
+		})
+	}
+
+	return struct {
+		SPDXVersion       string `json:"spdxVersion"`
+		DataLicense       string `json:"dataLicense"`
+		SPDXID            string `json:"SPDXID"`
+		Name              string `json:"name"`
+		DocumentNamespace string `json:"documentNamespace"`
+		CreationInfo      struct {
+			Created  string   `json:"created"`
+			Creators []string `json:"creators"`
+		} `json:"creationInfo"`
+		Packages      []pkg          `json:"packages"`
+		Relationships []relationship `json:"relationships"`
+	}{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + name + "-" + serial,
+		CreationInfo: struct {
+			Created  string   `json:"created"`
+			Creators []string `json:"creators"`
+		}{
+			Created:  created,
+			Creators: []string{"Tool: buildgo"},
+		},
+		Packages:      packages,
+		Relationships: relationships,
+	}
+}
+
+// sbomPURL returns package URL of the go module
+func sbomPURL(path, version string) string {
+	purl := "pkg:golang/" + path
+	if version != "" {
+		purl += "@" + strings.ReplaceAll(version, "+", "%2B")
+	}
+	return purl
+}
+
+// sbomUUID returns name-based UUID (version 5) derived from the seed
+func sbomUUID(seed string) string {
+	sum := sha1.Sum([]byte(seed))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -0,0 +1,182 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// SecretAllowMarker placed in the line excludes it from secret detection, e.g. for fake keys used in tests
+const SecretAllowMarker = "buildgo:allow-secret"
+
+// secretRules are the rules detecting secrets, if group is set, entropy of the submatch must exceed minEntropy
+var secretRules = []struct {
+	Name       string
+	Regexp     *regexp.Regexp
+	Group      int
+	MinEntropy float64
+}{
+	{Name: "AWS access key", Regexp: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "private key", Regexp: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{Name: "GitHub token", Regexp: regexp.MustCompile(`\b(?:gh[pousr]|github_pat)_[A-Za-z0-9_]{36,}\b`)},
+	{Name: "Slack token", Regexp: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+	{Name: "Google API key", Regexp: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{
+		Name: "high entropy secret",
+		Regexp: regexp.MustCompile(
+			`(?i)(?:secret|token|passw(?:or)?d|api_?key|access_?key)\w*["']?\s*[:=]+\s*["']([^"'\s]{16,})["']`),
+		Group:      1,
+		MinEntropy: 4,
+	},
+}
+
+// SecretsScanConfig is the configuration of secret and large file detection
+type SecretsScanConfig struct {
+	// BaseRef is the git reference, if set only files changed since then are scanned, otherwise the whole tree is.
+	// If empty, value of BUILDGO_BASE_REF environment variable is used.
+	BaseRef string
+
+	// MaxFileSize is the maximum size of the file in bytes, 1 MiB is used if 0
+	MaxFileSize int64
+}
+
+// SecretsScan fails if any file tracked by git or untracked and not ignored contains secret or is too large
+func SecretsScan(ctx context.Context) error {
+	return SecretsScanWithConfig(ctx, SecretsScanConfig{})
+}
+
+// SecretsScanWithConfig fails if any of the scanned files contains secret or is too large.
+// Lines containing SecretAllowMarker are not checked for secrets.
+func SecretsScanWithConfig(ctx context.Context, config SecretsScanConfig) error {
+	log := logger.Get(ctx)
+	if config.BaseRef == "" {
+		config.BaseRef = os.Getenv("BUILDGO_BASE_REF")
+	}
+	if config.MaxFileSize == 0 {
+		config.MaxFileSize = 1 << 20
+	}
+
+	files, err := secretsScanFiles(ctx, config.BaseRef)
+	if err != nil {
+		return err
+	}
+	log.Info("Scanning files for secrets", zap.Int("files", len(files)), zap.String("base", config.BaseRef))
+
+	var findings []string
+	for _, file := range files {
+		info, err := os.Lstat(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if info.Size() > config.MaxFileSize {
+			findings = append(findings, fmt.Sprintf("  %s: file is too large (%d bytes, limit: %d)", file,
+				info.Size(), config.MaxFileSize))
+			continue
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if isBinary(content) {
+			continue
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			if strings.Contains(line, SecretAllowMarker) {
+				continue
+			}
+			if rule := detectSecret(line); rule != "" {
+				findings = append(findings, fmt.Sprintf("  %s:%d: %s", file, i+1, rule))
+			}
+		}
+	}
+	if len(findings) > 0 {
+		return errors.Errorf("secrets or large files found:\n%s", strings.Join(findings, "\n"))
+	}
+	return nil
+}
+
+// secretsScanFiles returns files changed since baseRef, or all the files if it is empty
+func secretsScanFiles(ctx context.Context, baseRef string) ([]string, error) {
+	untracked, err := gitOutput(ctx, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	var changed string
+	if baseRef == "" {
+		changed, err = gitOutput(ctx, "ls-files", "-z")
+	} else {
+		var mergeBase string
+		mergeBase, err = gitOutput(ctx, "merge-base", baseRef, "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		changed, err = gitOutput(ctx, "diff", "-z", "--name-only", "--relative", "--diff-filter=d", mergeBase)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]bool{}
+	for _, file := range strings.Split(changed+"\x00"+untracked, "\x00") {
+		if file != "" {
+			files[file] = true
+		}
+	}
+	return sortedKeys(files), nil
+}
+
+// detectSecret returns the name of the rule detecting secret in the line, empty string is returned
+// if there is no secret
+func detectSecret(line string) string {
+	for _, rule := range secretRules {
+		match := rule.Regexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if rule.Group > 0 && shannonEntropy(match[rule.Group]) < rule.MinEntropy {
+			continue
+		}
+		return rule.Name
+	}
+	return ""
+}
+
+// shannonEntropy returns the number of bits of information per character of the string
+func shannonEntropy(s string) float64 {
+	counts := map[rune]int{}
+	var total int
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// isBinary returns true if content looks like binary data
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
@@ -0,0 +1,221 @@
+package buildgo
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var semVerRegexp = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+
+// SemVer is the semantic version
+type SemVer struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+// ParseSemVer parses semantic version, "v" prefix is optional
+func ParseSemVer(version string) (SemVer, error) {
+	match := semVerRegexp.FindStringSubmatch(version)
+	if match == nil {
+		return SemVer{}, errors.Errorf("invalid semantic version '%s'", version)
+	}
+	var numbers [3]int
+	for i := range numbers {
+		var err error
+		numbers[i], err = strconv.Atoi(match[i+1])
+		if err != nil {
+			return SemVer{}, errors.Wrapf(err, "invalid semantic version '%s'", version)
+		}
+	}
+	return SemVer{
+		Major:      numbers[0],
+		Minor:      numbers[1],
+		Patch:      numbers[2],
+		Prerelease: match[4],
+		Build:      match[5],
+	}, nil
+}
+
+// String returns the version in the vX.Y.Z[-prerelease][+build] form
+func (v SemVer) String() string {
+	s := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if the version has lower, the same or higher precedence than the other one.
+// Build metadata is ignored.
+func (v SemVer) Compare(other SemVer) int {
+	for _, d := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+
+	ids, otherIDs := strings.Split(v.Prerelease, "."), strings.Split(other.Prerelease, ".")
+	for i := 0; i < len(ids) && i < len(otherIDs); i++ {
+		if ids[i] == otherIDs[i] {
+			continue
+		}
+		n, err := strconv.Atoi(ids[i])
+		isNum := err == nil
+		otherN, err := strconv.Atoi(otherIDs[i])
+		otherIsNum := err == nil
+		switch {
+		case isNum && otherIsNum:
+			return sign(n - otherN)
+		case isNum:
+			return -1
+		case otherIsNum:
+			return 1
+		default:
+			return strings.Compare(ids[i], otherIDs[i])
+		}
+	}
+	return sign(len(ids) - len(otherIDs))
+}
+
+// NextMajor returns the next major version
+func (v SemVer) NextMajor() SemVer {
+	return SemVer{Major: v.Major + 1}
+}
+
+// NextMinor returns the next minor version
+func (v SemVer) NextMinor() SemVer {
+	return SemVer{Major: v.Major, Minor: v.Minor + 1}
+}
+
+// NextPatch returns the next patch version, for prerelease it is the version being prereleased
+func (v SemVer) NextPatch() SemVer {
+	if v.Prerelease != "" {
+		return SemVer{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	}
+	return SemVer{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+}
+
+// GitVersion is the version of the repository computed from git tags
+type GitVersion struct {
+	// Tag is the tag of the highest version reachable from HEAD, empty if there is none
+	Tag string
+
+	// Base is the version of the tag, v0.0.0 if there is no tag
+	Base SemVer
+
+	// CommitsSince is the number of commits made since the tag
+	CommitsSince int
+
+	// Commit is the abbreviated hash of the current commit
+	Commit string
+
+	// Dirty is true if there are uncommitted changes
+	Dirty bool
+}
+
+// Released returns true if HEAD is exactly the tagged version without uncommitted changes
+func (v GitVersion) Released() bool {
+	return v.Tag != "" && v.CommitsSince == 0 && !v.Dirty
+}
+
+// SemVer returns the version of the build. Released version is returned as is, otherwise the development
+// prerelease of the next patch version is returned, e.g. v1.2.4-dev.5+3f2a1b9c0d4e.dirty for the fifth
+// commit after v1.2.3, so it has precedence over the tagged version.
+func (v GitVersion) SemVer() SemVer {
+	if v.Released() {
+		return v.Base
+	}
+
+	version := v.Base.NextPatch()
+	version.Prerelease = "dev." + strconv.Itoa(v.CommitsSince)
+	if v.Base.Prerelease != "" {
+		version.Prerelease = v.Base.Prerelease + "." + version.Prerelease
+	}
+	version.Build = v.Commit
+	if v.Dirty {
+		version.Build += ".dirty"
+	}
+	version.Build = strings.TrimPrefix(version.Build, ".")
+	return version
+}
+
+// String returns the version of the build, see SemVer
+func (v GitVersion) String() string {
+	return v.SemVer().String()
+}
+
+// Version computes the version of the repository from the highest semantic version tag reachable from HEAD,
+// number of commits made since then and state of the working tree
+func Version(ctx context.Context) (GitVersion, error) {
+	tags, err := gitOutput(ctx, "tag", "--merged", "HEAD", "--list", "v*")
+	if err != nil {
+		return GitVersion{}, err
+	}
+
+	var version GitVersion
+	for _, tag := range strings.Fields(tags) {
+		semVer, err := ParseSemVer(tag)
+		if err != nil {
+			continue
+		}
+		if version.Tag == "" || semVer.Compare(version.Base) > 0 {
+			version.Tag = tag
+			version.Base = semVer
+		}
+	}
+
+	revisions := "HEAD"
+	if version.Tag != "" {
+		revisions = version.Tag + "..HEAD"
+	}
+	commitsSince, err := gitOutput(ctx, "rev-list", "--count", revisions)
+	if err != nil {
+		return GitVersion{}, err
+	}
+	version.CommitsSince, err = strconv.Atoi(commitsSince)
+	if err != nil {
+		return GitVersion{}, errors.Wrapf(err, "invalid number of commits '%s'", commitsSince)
+	}
+
+	version.Commit, err = gitOutput(ctx, "rev-parse", "--short=12", "HEAD")
+	if err != nil {
+		return GitVersion{}, err
+	}
+	status, err := gitOutput(ctx, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return GitVersion{}, err
+	}
+	version.Dirty = status != ""
+	return version, nil
+}
+
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	default:
+		return 0
+	}
+}
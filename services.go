@@ -0,0 +1,184 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// TestService is the service started in docker container before tests are run.
+// Address of the service is exposed to tests by <NAME>_HOST, <NAME>_PORT and <NAME>_ADDR environment variables.
+type TestService struct {
+	// Name is the name of the service
+	Name string
+
+	// Image is the docker image of the service
+	Image string
+
+	// Port is the port the service listens on inside the container
+	Port int
+
+	// Env is the environment of the container
+	Env map[string]string
+
+	// Args is the list of arguments passed to the container
+	Args []string
+
+	// TestEnv is the additional environment passed to tests. Values are text/templates,
+	// Host and Port fields are available.
+	TestEnv map[string]string
+
+	// StartTimeout is the time to wait for the service to accept connections, 1 minute is used if 0
+	StartTimeout time.Duration
+}
+
+// PostgresService returns postgres service, connection string is exposed by POSTGRES_URL environment variable
+func PostgresService(version string) TestService {
+	return TestService{
+		Name:  "postgres",
+		Image: "postgres:" + version,
+		Port:  5432,
+		Env: map[string]string{
+			"POSTGRES_PASSWORD": "postgres",
+		},
+		TestEnv: map[string]string{
+			"POSTGRES_URL": "postgres://postgres:postgres@{{.Host}}:{{.Port}}/postgres?sslmode=disable",
+		},
+	}
+}
+
+// RedisService returns redis service
+func RedisService(version string) TestService {
+	return TestService{
+		Name:  "redis",
+		Image: "redis:" + version,
+		Port:  6379,
+	}
+}
+
+// startTestServices starts services and returns the environment exposing their addresses.
+// Returned function stops the services.
+func startTestServices(ctx context.Context, services []TestService) ([]string, func(), error) {
+	var containers []string
+	stop := func() {
+		if len(containers) == 0 {
+			return
+		}
+		logger.Get(ctx).Info("Stopping test services")
+		// Parent context might be canceled already
+		if err := execCmds(context.Background(), exec.Command("docker",
+			append([]string{"rm", "-f"}, containers...)...)); err != nil {
+			logger.Get(ctx).Error("Stopping test services failed", zap.Error(err))
+		}
+	}
+
+	var env []string
+	for _, service := range services {
+		container, serviceEnv, err := startTestService(ctx, service)
+		if container != "" {
+			containers = append(containers, container)
+		}
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+		env = append(env, serviceEnv...)
+	}
+	return env, stop, nil
+}
+
+func startTestService(ctx context.Context, service TestService) (string, []string, error) {
+	log := logger.Get(ctx)
+	log.Info("Starting test service", zap.String("name", service.Name), zap.String("image", service.Image))
+
+	args := []string{
+		"run", "-d",
+		"--name", fmt.Sprintf("buildgo-%s-%d", service.Name, os.Getpid()),
+		"-p", fmt.Sprintf("127.0.0.1::%d", service.Port),
+	}
+	for _, k := range sortedKeys(service.Env) {
+		args = append(args, "-e", k+"="+service.Env[k])
+	}
+	args = append(args, service.Image)
+
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("docker", append(args, service.Args...)...)
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return "", nil, errors.Wrapf(err, "starting test service '%s' failed", service.Name)
+	}
+	container := strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	cmd = exec.Command("docker", "port", container, strconv.Itoa(service.Port))
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return container, nil, errors.Wrapf(err, "reading port of test service '%s' failed", service.Name)
+	}
+	host, port, err := net.SplitHostPort(strings.TrimSpace(strings.Split(buf.String(), "\n")[0]))
+	if err != nil {
+		return container, nil, errors.Wrapf(err, "invalid port of test service '%s'", service.Name)
+	}
+
+	timeout := service.StartTimeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	if err := waitForPort(ctx, net.JoinHostPort(host, port), timeout); err != nil {
+		return container, nil, errors.Wrapf(err, "test service '%s' has not started", service.Name)
+	}
+
+	prefix := strings.ToUpper(strings.ReplaceAll(service.Name, "-", "_"))
+	env := []string{
+		prefix + "_HOST=" + host,
+		prefix + "_PORT=" + port,
+		prefix + "_ADDR=" + net.JoinHostPort(host, port),
+	}
+	for _, k := range sortedKeys(service.TestEnv) {
+		tmpl, err := template.New(k).Parse(service.TestEnv[k])
+		if err != nil {
+			return container, nil, errors.Wrapf(err, "invalid template of variable '%s'", k)
+		}
+		value := &strings.Builder{}
+		if err := tmpl.Execute(value, struct {
+			Host string
+			Port string
+		}{Host: host, Port: port}); err != nil {
+			return container, nil, errors.Wrapf(err, "executing template of variable '%s' failed", k)
+		}
+		env = append(env, k+"="+value.String())
+	}
+
+	log.Info("Test service started", zap.String("name", service.Name), zap.String("address",
+		net.JoinHostPort(host, port)))
+	return container, env, nil
+}
+
+func waitForPort(ctx context.Context, addr string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := net.Dialer{}
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return errors.WithStack(conn.Close())
+		}
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
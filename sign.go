@@ -0,0 +1,134 @@
+package buildgo
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Signing tools
+const (
+	SignerCosign = "cosign"
+	SignerGPG    = "gpg"
+)
+
+// SignatureExt is appended to the path of the artifact to get the path of its signature
+const SignatureExt = ".sig"
+
+// SignConfig is the configuration of artifact signing. Empty fields are taken from environment variables,
+// so secrets may be provided by CI without storing them in the building tool.
+type SignConfig struct {
+	// Signer is the signing tool, SignerCosign or SignerGPG. If empty, value of BUILDGO_SIGNER environment variable
+	// is used, cosign is used if it is not set.
+	Signer string
+
+	// Key is the reference to the cosign private key (file, KMS URI or env://VAR) or the ID of the GPG key.
+	// If empty, value of BUILDGO_SIGNING_KEY environment variable is used. If there is no key, cosign signs keyless,
+	// using OIDC identity of the CI, and GPG uses its default key. Password of the cosign key is read
+	// by cosign from COSIGN_PASSWORD environment variable.
+	Key string
+
+	// Passphrase is the passphrase of the GPG key, if empty, value of BUILDGO_GPG_PASSPHRASE environment variable
+	// is used
+	Passphrase string
+}
+
+// SignFiles signs files, like checksums or archives. Signature is stored next to the file, with SignatureExt
+// appended to its path. Keyless cosign signing stores the certificate in the file with .pem extension appended.
+func SignFiles(ctx context.Context, deps build.DepsFunc, config SignConfig, files ...string) error {
+	config, err := signConfigFromEnv(config)
+	if err != nil {
+		return err
+	}
+	if config.Signer == SignerCosign {
+		deps(EnsureCosign)
+	}
+
+	for _, file := range files {
+		signature := file + SignatureExt
+		logger.Get(ctx).Info("Signing file", zap.String("path", file), zap.String("signature", signature),
+			zap.String("signer", config.Signer))
+
+		var cmd *exec.Cmd
+		switch config.Signer {
+		case SignerCosign:
+			args := []string{"sign-blob", "--yes", "--output-signature", signature}
+			if config.Key != "" {
+				args = append(args, "--key", config.Key)
+			} else {
+				args = append(args, "--output-certificate", file+".pem")
+			}
+			cmd = exec.Command("cosign", append(args, file)...)
+		case SignerGPG:
+			args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", signature}
+			if config.Key != "" {
+				args = append(args, "--local-user", config.Key)
+			}
+			if config.Passphrase != "" {
+				args = append(args, "--pinentry-mode", "loopback", "--passphrase-fd", "0")
+			}
+			cmd = exec.Command("gpg", append(args, file)...)
+			cmd.Stdin = strings.NewReader(config.Passphrase)
+		}
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "signing file '%s' failed", file)
+		}
+	}
+	return nil
+}
+
+// SignImages signs container images using cosign, signatures are pushed to the registry of the image.
+// Images should be referenced by digest, so the signed image can't be replaced by pushing another one
+// under the same tag.
+func SignImages(ctx context.Context, deps build.DepsFunc, config SignConfig, images ...string) error {
+	config, err := signConfigFromEnv(config)
+	if err != nil {
+		return err
+	}
+	if config.Signer != SignerCosign {
+		return errors.Errorf("images can be signed by cosign only, not by %s", config.Signer)
+	}
+	deps(EnsureCosign)
+
+	for _, image := range images {
+		logger.Get(ctx).Info("Signing image", zap.String("image", image))
+
+		args := []string{"sign", "--yes"}
+		if config.Key != "" {
+			args = append(args, "--key", config.Key)
+		}
+		if err := execCmds(ctx, exec.Command("cosign", append(args, image)...)); err != nil {
+			return errors.Wrapf(err, "signing image '%s' failed", image)
+		}
+	}
+	return nil
+}
+
+// signConfigFromEnv fills empty fields of the config using environment variables
+func signConfigFromEnv(config SignConfig) (SignConfig, error) {
+	if config.Signer == "" {
+		config.Signer = os.Getenv("BUILDGO_SIGNER")
+	}
+	if config.Signer == "" {
+		config.Signer = SignerCosign
+	}
+	if config.Key == "" {
+		config.Key = os.Getenv("BUILDGO_SIGNING_KEY")
+	}
+	if config.Passphrase == "" {
+		config.Passphrase = os.Getenv("BUILDGO_GPG_PASSPHRASE")
+	}
+
+	switch config.Signer {
+	case SignerCosign, SignerGPG:
+		return config, nil
+	default:
+		return SignConfig{}, errors.Errorf("unknown signer '%s'", config.Signer)
+	}
+}
@@ -0,0 +1,191 @@
+package buildgo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// jobSummary collects results reported in the GitHub Actions job summary
+type jobSummary struct {
+	mu          sync.Mutex
+	offset      int64
+	initialized bool
+	coverage    []summaryCoverage
+	failedTests []string
+	binaries    []summaryBinary
+	steps       []summaryStep
+}
+
+type summaryCoverage struct {
+	Module  string
+	Percent float64
+}
+
+type summaryBinary struct {
+	Binary   string
+	Platform Platform
+	Size     int64
+}
+
+type summaryStep struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+}
+
+var summary = &jobSummary{}
+
+// githubStepSummary returns the file job summary is written to, empty string is returned outside GitHub Actions
+func githubStepSummary() string {
+	if !githubActions() {
+		return ""
+	}
+	return os.Getenv("GITHUB_STEP_SUMMARY")
+}
+
+// summarizeStep adds the step started at start to the job summary
+func summarizeStep(name string, start time.Time, err error) error {
+	return summary.update(func() {
+		summary.steps = append(summary.steps, summaryStep{Name: name, Duration: time.Since(start), Err: err})
+	})
+}
+
+// summarizeCoverage adds coverage of the module to the job summary
+func summarizeCoverage(module string, coverage coverageStats) error {
+	return summary.update(func() {
+		summary.coverage = append(summary.coverage, summaryCoverage{Module: module, Percent: coverage.Percent()})
+	})
+}
+
+// summarizeTestFailures adds failed tests to the job summary. Packages are reported only if they failed
+// for other reason than failed test.
+func summarizeTestFailures(results []*testResult) error {
+	failedPkgs := map[string]bool{}
+	for _, result := range results {
+		if result.Action == "fail" && result.Test != "" {
+			failedPkgs[result.Package] = true
+		}
+	}
+	return summary.update(func() {
+		for _, result := range results {
+			switch {
+			case result.Action != "fail":
+			case result.Test != "":
+				summary.failedTests = append(summary.failedTests, result.Package+"."+result.Test)
+			case !failedPkgs[result.Package]:
+				// Package failed for other reason than failed test, e.g. build error
+				summary.failedTests = append(summary.failedTests, result.Package)
+			}
+		}
+	})
+}
+
+// summarizeBinary adds the built binary and its size to the job summary
+func summarizeBinary(binary string, platform Platform) error {
+	if githubStepSummary() == "" {
+		return nil
+	}
+	info, err := os.Stat(binary)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return summary.update(func() {
+		summary.binaries = append(summary.binaries, summaryBinary{
+			Binary:   binary,
+			Platform: platform,
+			Size:     info.Size(),
+		})
+	})
+}
+
+// update modifies the summary and writes it to the summary file. The summary file is rewritten on every update,
+// content written to it before the first update is preserved.
+func (s *jobSummary) update(fn func()) error {
+	file := githubStepSummary()
+	if file == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn()
+
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	if !s.initialized {
+		s.offset, err = f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		s.initialized = true
+	}
+	if err := f.Truncate(s.offset); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := f.WriteAt([]byte(s.markdown()), s.offset); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *jobSummary) markdown() string {
+	md := &strings.Builder{}
+	if len(s.coverage) > 0 {
+		md.WriteString("### Coverage\n\n| Module | Coverage |\n| --- | ---: |\n")
+		for _, c := range s.coverage {
+			fmt.Fprintf(md, "| `%s` | %.1f%% |\n", c.Module, c.Percent)
+		}
+		md.WriteString("\n")
+	}
+	if len(s.failedTests) > 0 {
+		md.WriteString("### Failed tests\n\n")
+		for _, test := range s.failedTests {
+			fmt.Fprintf(md, "- `%s`\n", test)
+		}
+		md.WriteString("\n")
+	}
+	if len(s.binaries) > 0 {
+		md.WriteString("### Binaries\n\n| Binary | Platform | Size |\n| --- | --- | ---: |\n")
+		for _, b := range s.binaries {
+			fmt.Fprintf(md, "| `%s` | %s | %s |\n", b.Binary, b.Platform, humanSize(b.Size))
+		}
+		md.WriteString("\n")
+	}
+	if len(s.steps) > 0 {
+		md.WriteString("### Steps\n\n| Step | Result | Duration |\n| --- | --- | ---: |\n")
+		for _, step := range s.steps {
+			result := "✅"
+			if step.Err != nil {
+				result = "❌"
+			}
+			fmt.Fprintf(md, "| %s | %s | %s |\n", step.Name, result, step.Duration.Round(time.Millisecond))
+		}
+		md.WriteString("\n")
+	}
+	return md.String()
+}
+
+// humanSize formats size in bytes using binary units
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,122 @@
+package buildgo
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Version bump levels
+const (
+	BumpMajor = "major"
+	BumpMinor = "minor"
+	BumpPatch = "patch"
+)
+
+// ReleaseTagConfig is the configuration of release tagging
+type ReleaseTagConfig struct {
+	// Bump is the version bump level. If empty, value of BUILDGO_BUMP environment variable is used,
+	// if it is not set either, level is determined from conventional commits made since the latest version.
+	Bump string
+
+	// Sign signs the tag using GPG, it is enabled also by setting BUILDGO_TAG_SIGN environment variable to true
+	Sign bool
+
+	// Remote is the remote tag is pushed to, origin is used if empty
+	Remote string
+}
+
+// GitReleaseTag verifies that the tree is clean and tests pass, creates annotated tag of the next version
+// and pushes it
+func GitReleaseTag(ctx context.Context, deps build.DepsFunc, config ReleaseTagConfig) error {
+	if config.Bump == "" {
+		config.Bump = os.Getenv("BUILDGO_BUMP")
+	}
+	if os.Getenv("BUILDGO_TAG_SIGN") == "true" {
+		config.Sign = true
+	}
+	if config.Remote == "" {
+		config.Remote = "origin"
+	}
+
+	version, err := Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version.Tag != "" && version.CommitsSince == 0 {
+		return errors.Errorf("HEAD is already tagged with version %s", version.Tag)
+	}
+	if err := GitStatusClean(ctx); err != nil {
+		return err
+	}
+	deps(GoTest)
+
+	bump := config.Bump
+	if bump == "" {
+		bump, err = versionBump(ctx, version.Tag)
+		if err != nil {
+			return err
+		}
+	}
+	var next SemVer
+	switch bump {
+	case BumpMajor:
+		next = version.Base.NextMajor()
+	case BumpMinor:
+		next = version.Base.NextMinor()
+	case BumpPatch:
+		next = version.Base.NextPatch()
+	default:
+		return errors.Errorf("unknown version bump level '%s'", bump)
+	}
+	tag := next.String()
+
+	logger.Get(ctx).Info("Tagging release", zap.String("tag", tag), zap.String("previous", version.Tag),
+		zap.String("bump", bump), zap.Bool("signed", config.Sign))
+
+	tagFlag := "--annotate"
+	if config.Sign {
+		tagFlag = "--sign"
+	}
+	if err := execCmds(ctx, exec.Command("git", "tag", tagFlag, "-m", "Release "+tag, tag)); err != nil {
+		return errors.Wrapf(err, "creating tag '%s' failed", tag)
+	}
+	if err := execCmds(ctx, exec.Command("git", "push", config.Remote, "refs/tags/"+tag)); err != nil {
+		return errors.Wrapf(err, "pushing tag '%s' failed", tag)
+	}
+	return nil
+}
+
+// versionBump returns the bump level required by conventional commits made since the tag
+func versionBump(ctx context.Context, tag string) (string, error) {
+	revisions := "HEAD"
+	if tag != "" {
+		revisions = tag + "..HEAD"
+	}
+	messages, err := gitOutput(ctx, "log", "--no-merges", "--format=%B%x00", revisions)
+	if err != nil {
+		return "", err
+	}
+
+	bump := BumpPatch
+	for _, message := range strings.Split(messages, "\x00") {
+		subject, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+		match := conventionalCommitRegexp.FindStringSubmatch(subject)
+		if match == nil {
+			continue
+		}
+		if match[3] != "" || strings.Contains(body, "BREAKING CHANGE:") || strings.Contains(body, "BREAKING-CHANGE:") {
+			return BumpMajor, nil
+		}
+		if match[1] == "feat" {
+			bump = BumpMinor
+		}
+	}
+	return bump, nil
+}
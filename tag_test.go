@@ -0,0 +1,66 @@
+package buildgo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/outofforest/logger"
+	"go.uber.org/zap"
+)
+
+func TestVersionBump(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		expected string
+	}{
+		{name: "no conventional commits", messages: []string{"Update readme"}, expected: BumpPatch},
+		{name: "fix", messages: []string{"fix: handle empty input"}, expected: BumpPatch},
+		{name: "feature", messages: []string{"fix: a", "feat(cli): add flag", "docs: b"}, expected: BumpMinor},
+		{name: "breaking change marker", messages: []string{"feat: a", "refactor(api)!: drop v1"}, expected: BumpMajor},
+		{
+			name:     "breaking change footer",
+			messages: []string{"fix: rename option\n\nBREAKING CHANGE: option is renamed"},
+			expected: BumpMajor,
+		},
+		{
+			name:     "breaking change footer with dash",
+			messages: []string{"fix: rename option\n\nBREAKING-CHANGE: option is renamed"},
+			expected: BumpMajor,
+		},
+		{name: "commits before tag ignored", messages: []string{"feat!: a", "TAG", "fix: b"}, expected: BumpPatch},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			chdir(t, dir)
+			for _, v := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+				t.Setenv(v, "test")
+			}
+			for _, v := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+				t.Setenv(v, "test@example.com")
+			}
+
+			git(t, "init", "-q")
+			var tag string
+			for _, message := range test.messages {
+				if message == "TAG" {
+					tag = "v1.0.0"
+					git(t, "tag", tag)
+					continue
+				}
+				git(t, "commit", "-q", "--allow-empty", "-m", message)
+			}
+
+			bump, err := versionBump(logger.WithLogger(context.Background(), zap.NewNop()), tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bump != test.expected {
+				t.Fatalf("unexpected bump: %s", bump)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package buildgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// testEvent is the event produced by `go test -json`
+type testEvent struct {
+	Action      string
+	Package     string
+	Test        string
+	Elapsed     float64
+	Output      string
+	ImportPath  string
+	FailedBuild string
+}
+
+// testResult is the result of single test or the entire package if Test is empty
+type testResult struct {
+	Package     string
+	Test        string
+	Action      string
+	Elapsed     float64
+	Output      strings.Builder
+	FailedBuild string
+}
+
+type testKey struct {
+	Package string
+	Test    string
+}
+
+// testEventParser consumes output of `go test -json`, collects results and writes concise progress to out.
+// Output of the test is written only if it fails. In verbose mode entire output is streamed, in quiet mode
+// only failures are written.
+type testEventParser struct {
+	out         io.Writer
+	verbosity   string
+	buf         []byte
+	results     map[testKey]*testResult
+	order       []testKey
+	failedTests map[string]bool
+	buildOutput map[string]*strings.Builder
+}
+
+func newTestEventParser(out io.Writer) *testEventParser {
+	return &testEventParser{
+		out:         out,
+		verbosity:   verbosity(),
+		results:     map[testKey]*testResult{},
+		failedTests: map[string]bool{},
+		buildOutput: map[string]*strings.Builder{},
+	}
+}
+
+// Write parses events, it implements io.Writer
+func (p *testEventParser) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	for {
+		pos := bytes.IndexByte(p.buf, '\n')
+		if pos < 0 {
+			return len(data), nil
+		}
+		line := p.buf[:pos+1]
+		p.buf = p.buf[pos+1:]
+		if err := p.processLine(line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (p *testEventParser) processLine(line []byte) error {
+	var event testEvent
+	if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &event) != nil {
+		_, err := p.out.Write(line)
+		return errors.WithStack(err)
+	}
+	if event.Action == "build-output" {
+		// Build errors are reported separately and attached to the package failing because of them
+		output, exists := p.buildOutput[event.ImportPath]
+		if !exists {
+			output = &strings.Builder{}
+			p.buildOutput[event.ImportPath] = output
+		}
+		output.WriteString(event.Output)
+		return p.stream(event.Output)
+	}
+	if event.Package == "" {
+		return nil
+	}
+
+	key := testKey{Package: event.Package, Test: event.Test}
+	result, exists := p.results[key]
+	if !exists {
+		result = &testResult{Package: event.Package, Test: event.Test}
+		p.results[key] = result
+		p.order = append(p.order, key)
+	}
+	switch event.Action {
+	case "run":
+		// Test might be rerun, output of the previous run is dropped
+		result.Output.Reset()
+	case "output":
+		result.Output.WriteString(event.Output)
+		return p.stream(event.Output)
+	case "pass", "fail", "skip":
+		if output := p.buildOutput[event.FailedBuild]; output != nil {
+			result.FailedBuild = event.FailedBuild
+			result.Output.WriteString(output.String())
+		}
+		result.Action = event.Action
+		result.Elapsed = event.Elapsed
+		return p.printResult(result)
+	}
+	return nil
+}
+
+// stream writes the output as it is produced in verbose mode
+func (p *testEventParser) stream(output string) error {
+	if p.verbosity != verbosityVerbose {
+		return nil
+	}
+	_, err := io.WriteString(p.out, output)
+	return errors.WithStack(err)
+}
+
+func (p *testEventParser) printResult(result *testResult) error {
+	if result.Test != "" && result.Action == "fail" {
+		p.failedTests[result.Package] = true
+	}
+	// In verbose mode results are already included in the streamed output
+	if p.verbosity == verbosityVerbose || (p.verbosity == verbosityQuiet && result.Action != "fail") {
+		return nil
+	}
+
+	var err error
+	switch {
+	case result.Test != "":
+		if result.Action != "fail" {
+			return nil
+		}
+		_, err = fmt.Fprintf(p.out, "--- FAIL: %s %s (%.2fs)\n%s", result.Package, result.Test, result.Elapsed,
+			result.Output.String())
+	case result.Action == "pass":
+		_, err = fmt.Fprintf(p.out, "ok      %s\t%.3fs\n", result.Package, result.Elapsed)
+	case result.Action == "skip":
+		_, err = fmt.Fprintf(p.out, "?       %s\t[no test files]\n", result.Package)
+	default:
+		// If none of the tests failed, package failed for other reason, e.g. panic or build error
+		if !p.failedTests[result.Package] {
+			if _, err := io.WriteString(p.out, result.Output.String()); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		_, err = fmt.Fprintf(p.out, "FAIL    %s\t%.3fs\n", result.Package, result.Elapsed)
+	}
+	return errors.WithStack(err)
+}
+
+// Results returns results of tests in the order they were started
+func (p *testEventParser) Results() []*testResult {
+	results := make([]*testResult, 0, len(p.order))
+	for _, key := range p.order {
+		results = append(results, p.results[key])
+	}
+	return results
+}
+
+// printTestSummary prints counts of passed, failed and skipped tests, the slowest tests and the failed ones
+func printTestSummary(results []*testResult) {
+	const slowestCount = 10
+
+	var passed, failed, skipped int
+	var tests, failedNames []string
+	elapsed := map[string]float64{}
+	for _, result := range results {
+		name := result.Package
+		if result.Test != "" {
+			name += "." + result.Test
+		}
+		switch result.Action {
+		case "pass":
+			if result.Test != "" {
+				passed++
+				tests = append(tests, name)
+				elapsed[name] = result.Elapsed
+			}
+		case "skip":
+			if result.Test != "" {
+				skipped++
+			}
+		case "fail":
+			if result.Test != "" {
+				failed++
+				tests = append(tests, name)
+				elapsed[name] = result.Elapsed
+			}
+			failedNames = append(failedNames, name)
+		}
+	}
+	sort.SliceStable(tests, func(i, j int) bool {
+		return elapsed[tests[i]] > elapsed[tests[j]]
+	})
+	if len(tests) > slowestCount {
+		tests = tests[:slowestCount]
+	}
+
+	fmt.Println("\n Test summary:")
+	fmt.Println()
+	fmt.Printf("   passed: %d, failed: %d, skipped: %d\n", passed, failed, skipped)
+	if len(tests) > 0 {
+		fmt.Println("\n Slowest tests:")
+		fmt.Println()
+		for _, test := range tests {
+			fmt.Printf("   %8.2fs  %s\n", elapsed[test], test)
+		}
+	}
+	if len(failedNames) > 0 {
+		fmt.Println("\n Failed:")
+		fmt.Println()
+		for _, name := range failedNames {
+			fmt.Printf("   %s\n", name)
+		}
+	}
+	fmt.Println()
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Output  string `xml:",chardata"`
+}
+
+// writeJUnitReport stores test results in JUnit XML format
+func writeJUnitReport(file string, results []*testResult) error {
+	suites := junitTestSuites{}
+	suiteIndex := map[string]int{}
+	for _, result := range results {
+		index, exists := suiteIndex[result.Package]
+		if !exists {
+			index = len(suites.Suites)
+			suiteIndex[result.Package] = index
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: result.Package})
+		}
+		suite := &suites.Suites[index]
+		if result.Test == "" {
+			suite.Time = junitTime(result.Elapsed)
+			continue
+		}
+
+		testCase := junitTestCase{
+			Name:      result.Test,
+			ClassName: result.Package,
+			Time:      junitTime(result.Elapsed),
+		}
+		suite.Tests++
+		switch result.Action {
+		case "fail":
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: "Failed", Output: result.Output.String()}
+		case "skip":
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: "Skipped", Output: result.Output.String()}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return errors.WithStack(err)
+	}
+	content, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(file, append([]byte(xml.Header), content...), 0o600))
+}
+
+func junitTime(elapsed float64) string {
+	return fmt.Sprintf("%.3f", elapsed)
+}
@@ -0,0 +1,270 @@
+package buildgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Categories of timing spans
+const (
+	spanCommand = "command"
+	spanTarget  = "target"
+	spanTool    = "tool"
+)
+
+// timingSpan is the time spent in single step of the build
+type timingSpan struct {
+	Category string
+	Name     string
+	Module   string
+	Start    time.Time
+	Duration time.Duration
+}
+
+var (
+	timingMu     sync.Mutex
+	timingSpans  []timingSpan
+	commandDepth int
+)
+
+// recordSpan records the span started at start and finishing now. It may be deferred to measure the function.
+func recordSpan(category, name, module string, start time.Time) {
+	timingMu.Lock()
+	defer timingMu.Unlock()
+
+	timingSpans = append(timingSpans, timingSpan{
+		Category: category,
+		Name:     name,
+		Module:   module,
+		Start:    start,
+		Duration: time.Since(start),
+	})
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// timedCommand wraps the function of the command, so its duration is recorded, it is traced and its result is
+// written to the build report.
+// Once the outermost command completes, failures recorded in continue-on-error mode are reported, timing breakdown
+// is printed if BUILDGO_TIMINGS environment variable is set to true, Chrome trace is written to the file set
+// in BUILDGO_TRACE environment variable and spans are exported to the OTLP endpoint. Failed export is only logged.
+func timedCommand(name string, fn interface{}) interface{} {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) (results []reflect.Value) {
+		timingMu.Lock()
+		commandDepth++
+		timingMu.Unlock()
+
+		// Context passed to the command carries its span, so steps executed by the command are its children
+		parent := context.Background()
+		ctxIndex := -1
+		for i := 0; i < fnType.NumIn(); i++ {
+			if fnType.In(i) == contextType {
+				parent = args[i].Interface().(context.Context)
+				ctxIndex = i
+			}
+		}
+		ctx, endSpan := startSpan(parent, name, stringAttribute("command", name))
+		if ctxIndex >= 0 {
+			ctx = withVerbosity(ctx)
+			args[ctxIndex] = reflect.ValueOf(&ctx).Elem()
+		}
+
+		// Deferred, because failed dependency panics to abort the command
+		start := time.Now()
+		defer func() {
+			r := recover()
+			recordSpan(spanCommand, name, "", start)
+			cmdErr := commandError(results, r)
+			endSpan(cmdErr)
+
+			if ctxIndex < 0 {
+				ctx = logger.WithLogger(ctx, logger.New(logger.DefaultConfig))
+			}
+			var err error
+			if !dryRun() {
+				err = reportTarget(ctx, targetRun{Target: name, Start: start, Err: cmdErr})
+			}
+
+			timingMu.Lock()
+			commandDepth--
+			outermost := commandDepth == 0
+			timingMu.Unlock()
+
+			if outermost {
+				// Telemetry must not change the result of the build
+				if err := exportSpans(); err != nil {
+					logger.Get(ctx).Warn("Exporting spans failed", zap.Error(err))
+				}
+
+				err = multierr.Combine(err, reportFailures(), reportTimings())
+			}
+			if err != nil && r == nil && len(results) > 0 {
+				// Error of the command takes precedence
+				last := len(results) - 1
+				if fnType.Out(last) == errorType && results[last].IsNil() {
+					results[last] = reflect.ValueOf(&err).Elem()
+				}
+			}
+			if r != nil {
+				panic(r)
+			}
+		}()
+		return fnValue.Call(args)
+	}).Interface()
+}
+
+// commandError returns the error the command failed with, if it panicked, the recovered value is used
+func commandError(results []reflect.Value, recovered interface{}) error {
+	if recovered != nil {
+		if err, ok := recovered.(error); ok {
+			return err
+		}
+		return errors.Errorf("command panicked: %v", recovered)
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	err, _ := results[len(results)-1].Interface().(error)
+	return err
+}
+
+// reportTimings prints timing breakdown and writes Chrome trace, depending on the environment
+func reportTimings() error {
+	timingMu.Lock()
+	spans := append([]timingSpan{}, timingSpans...)
+	timingMu.Unlock()
+
+	if os.Getenv("BUILDGO_TIMINGS") == "true" {
+		printTimings(spans)
+	}
+	if trace := os.Getenv("BUILDGO_TRACE"); trace != "" && !dryRun() {
+		return writeChromeTrace(trace, spans)
+	}
+	return nil
+}
+
+// printTimings prints total time spent in commands, targets run for modules and tool bootstrap
+func printTimings(spans []timingSpan) {
+	type key struct {
+		Category string
+		Name     string
+		Module   string
+	}
+
+	totals := map[key]time.Duration{}
+	var keys []key
+	for _, span := range spans {
+		k := key{Category: span.Category, Name: span.Name, Module: span.Module}
+		if _, exists := totals[k]; !exists {
+			keys = append(keys, k)
+		}
+		totals[k] += span.Duration
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return totals[keys[i]] > totals[keys[j]]
+	})
+
+	fmt.Println("\n Timings:")
+	for _, category := range []string{spanCommand, spanTarget, spanTool} {
+		var total time.Duration
+		var lines []string
+		for _, k := range keys {
+			if k.Category != category {
+				continue
+			}
+			name := k.Name
+			if k.Module != "" {
+				name += " " + k.Module
+			}
+			total += totals[k]
+			lines = append(lines, fmt.Sprintf("   %10s  %s", totals[k].Round(time.Millisecond), name))
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Printf("\n %ss (%s):\n\n", category, total.Round(time.Millisecond))
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+	fmt.Println()
+}
+
+type chromeTrace struct {
+	TraceEvents []chromeTraceEvent `json:"traceEvents"`
+}
+
+type chromeTraceEvent struct {
+	Name     string            `json:"name"`
+	Category string            `json:"cat"`
+	Phase    string            `json:"ph"`
+	Time     int64             `json:"ts"`
+	Duration int64             `json:"dur"`
+	PID      int               `json:"pid"`
+	TID      int               `json:"tid"`
+	Args     map[string]string `json:"args,omitempty"`
+}
+
+// writeChromeTrace stores spans in the Chrome trace event format, it may be opened in chrome://tracing
+// or https://ui.perfetto.dev. Overlapping spans are placed in separate threads.
+func writeChromeTrace(file string, spans []timingSpan) error {
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+
+	var lanes []time.Time
+	events := make([]chromeTraceEvent, 0, len(spans))
+	for _, span := range spans {
+		end := span.Start.Add(span.Duration)
+		lane := 0
+		for lane < len(lanes) && lanes[lane].After(span.Start) {
+			lane++
+		}
+		if lane == len(lanes) {
+			lanes = append(lanes, end)
+		} else {
+			lanes[lane] = end
+		}
+
+		event := chromeTraceEvent{
+			Name:     span.Name,
+			Category: span.Category,
+			Phase:    "X",
+			Time:     span.Start.UnixMicro(),
+			Duration: span.Duration.Microseconds(),
+			PID:      1,
+			TID:      lane + 1,
+		}
+		if span.Module != "" {
+			event.Name += " " + span.Module
+			event.Args = map[string]string{"module": span.Module}
+		}
+		events = append(events, event)
+	}
+
+	data, err := json.Marshal(chromeTrace{TraceEvents: events})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(file, data, 0o644))
+}
@@ -0,0 +1,726 @@
+package buildgo
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/outofforest/logger"
+	"github.com/outofforest/parallel"
+	"github.com/pkg/errors"
+	"github.com/ridge/must"
+	"go.uber.org/zap"
+)
+
+// Tool is the tool downloaded from the internet and installed in the local cache
+type Tool struct {
+	// Name is the name of the tool
+	Name string
+
+	// Version is the version of the tool
+	Version string
+
+	// Artifacts are the artifacts of the tool pinned for platforms
+	Artifacts map[Platform]ToolArtifact
+
+	// Resolve returns the artifact for platform missing in Artifacts. Checksum of the artifact must be taken
+	// from the source published by the authors of the tool. It is called only if the tool is not installed yet,
+	// installed one is verified using checksums recorded during its installation, so no network access is needed.
+	Resolve func(ctx context.Context, platform Platform) (ToolArtifact, error)
+}
+
+// ToolArtifact is the downloadable artifact of the tool
+type ToolArtifact struct {
+	// URL is the URL of the archive or binary
+	URL string
+
+	// Hash is the checksum of the downloaded file in the sha256:<hex> form, installation fails if downloaded file
+	// does not match it. It may be empty only if the checksum is committed to ToolsSumFile, otherwise installation
+	// fails too.
+	Hash string
+
+	// Binaries maps names of the binaries linked in the project bin directory to their paths inside the artifact
+	Binaries map[string]string
+}
+
+var toolRegistryMu sync.Mutex
+
+// RegisterTool adds tool to the registry, so it may be installed by EnsureTool.
+// Tool registered previously under the same name is replaced.
+func RegisterTool(tool Tool) {
+	toolRegistryMu.Lock()
+	defer toolRegistryMu.Unlock()
+
+	toolRegistry[tool.Name] = tool
+}
+
+// EnsureTool ensures that registered tool is installed for the host platform and its binaries are available in PATH
+func EnsureTool(ctx context.Context, name string) error {
+	if name == "go" {
+		return EnsureGo(ctx)
+	}
+
+	toolRegistryMu.Lock()
+	tool, exists := toolRegistry[name]
+	toolRegistryMu.Unlock()
+
+	if !exists {
+		return errors.Errorf("tool '%s' is not registered", name)
+	}
+	tool, err := withRepoToolVersion(tool)
+	if err != nil {
+		return err
+	}
+	return ensureTool(ctx, tool)
+}
+
+// EnsureTools ensures that registered tools are installed, tools are downloaded and installed concurrently
+func EnsureTools(ctx context.Context, names ...string) error {
+	start := time.Now()
+	if err := forEachParallel(ctx, names, EnsureTool); err != nil {
+		return err
+	}
+	logger.Get(ctx).Debug("Tools are ready", zap.Strings("tools", names), zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+// forEachParallel calls fn for all the names concurrently, first error cancels the remaining calls
+func forEachParallel(ctx context.Context, names []string, fn func(ctx context.Context, name string) error) error {
+	return parallel.Run(ctx, func(ctx context.Context, spawn parallel.SpawnFn) error {
+		for _, name := range names {
+			name := name
+			spawn(name, parallel.Continue, func(ctx context.Context) error {
+				return fn(ctx, name)
+			})
+		}
+		return nil
+	})
+}
+
+// toolLocks serialize installation of the same tool
+var toolLocks sync.Map
+
+func ensureTool(ctx context.Context, tool Tool) error {
+	defer recordSpan(spanTool, tool.Name, "", time.Now())
+
+	platform := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	binDir := must.String(filepath.Abs("bin"))
+	toolDir := toolDirPath(tool.Name, tool.Version, platform)
+
+	lock, _ := toolLocks.LoadOrStore(toolDir, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	artifact, exists := tool.Artifacts[platform]
+	if !exists {
+		// Resolving requires network access, so it is done only if tool hasn't been installed yet
+		installed, err := installedArtifact(toolDir)
+		if err != nil {
+			return err
+		}
+		if installed != nil {
+			artifact = *installed
+		} else {
+			if tool.Resolve == nil {
+				return errors.Errorf("tool '%s' is not available for platform %s", tool.Name, platform)
+			}
+			artifact, err = tool.Resolve(ctx, platform)
+			if err != nil {
+				return errors.Wrapf(err, "resolving tool '%s' for platform %s failed", tool.Name, platform)
+			}
+		}
+	}
+
+	if artifact.Hash == "" {
+		var err error
+		artifact.Hash, err = lockedToolHash(artifact.URL)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(toolDir); os.IsNotExist(err) {
+		if skipInDryRun(ctx, "Installing tool", zap.String("name", tool.Name), zap.String("version", tool.Version),
+			zap.String("url", artifact.URL)) {
+			return nil
+		}
+		artifact.Hash, err = installTool(ctx, tool, artifact, toolDir)
+		if err != nil {
+			return err
+		}
+	}
+	if err := verifyTool(tool, artifact, toolDir); err != nil {
+		return err
+	}
+	if !dryRun() {
+		touchToolDir(toolDir)
+	}
+	if !toolLinked(toolDir, binDir, artifact) &&
+		!skipInDryRun(ctx, "Linking tool", zap.String("name", tool.Name), zap.String("version", tool.Version)) {
+		if err := linkTool(toolDir, binDir, artifact); err != nil {
+			return err
+		}
+	}
+	return prependPath(binDir)
+}
+
+// ToolsSumFile is the file storing checksums of tool artifacts which are not pinned in the tool definition.
+// Each line contains the URL of the artifact and its checksum in the sha256:<hex> form. Checksums are never recorded
+// automatically, they must be taken from the source trusted by the repository and committed.
+const ToolsSumFile = "build/.tools.sum"
+
+var toolsSumFileMu sync.Mutex
+
+// lockedToolHash returns the checksum of the artifact recorded in ToolsSumFile, empty string is returned
+// if it is not there
+func lockedToolHash(url string) (string, error) {
+	toolsSumFileMu.Lock()
+	defer toolsSumFileMu.Unlock()
+
+	content, err := os.ReadFile(ToolsSumFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", errors.WithStack(err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == url {
+			return fields[1], nil
+		}
+	}
+	return "", nil
+}
+
+// toolSums is the content of the file storing checksums of the installed tool
+type toolSums struct {
+	// Artifact is the checksum of the artifact tool has been installed from
+	Artifact string `json:"artifact"`
+
+	// Binaries are the checksums of the installed binaries
+	Binaries map[string]string `json:"binaries"`
+
+	// Links map names of links in the bin directory to the installed binaries
+	Links map[string]string `json:"links"`
+}
+
+// toolSumsFile is the file inside tool directory storing checksums of the installed tool
+const toolSumsFile = ".buildgo.sum"
+
+func storeToolSums(artifact ToolArtifact, toolDir string) error {
+	sums := toolSums{
+		Artifact: artifact.Hash,
+		Binaries: map[string]string{},
+		Links:    artifact.Binaries,
+	}
+	for _, src := range artifact.Binaries {
+		checksum, err := fileChecksum(filepath.Join(toolDir, src))
+		if err != nil {
+			return err
+		}
+		sums.Binaries[src] = checksum
+	}
+	data, err := json.Marshal(sums)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(filepath.Join(toolDir, toolSumsFile), data, 0o444))
+}
+
+// installedArtifact returns the artifact the tool has been installed from, as recorded in its checksums file.
+// Nil is returned if tool is not installed or it has been installed by the version not recording links.
+func installedArtifact(toolDir string) (*ToolArtifact, error) {
+	data, err := os.ReadFile(filepath.Join(toolDir, toolSumsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+	var sums toolSums
+	if err := json.Unmarshal(data, &sums); err != nil || len(sums.Links) == 0 {
+		return nil, nil
+	}
+	return &ToolArtifact{Hash: sums.Artifact, Binaries: sums.Links}, nil
+}
+
+// verifyTool verifies that installed binaries haven't been modified since the checksum-verified installation
+func verifyTool(tool Tool, artifact ToolArtifact, toolDir string) error {
+	data, err := os.ReadFile(filepath.Join(toolDir, toolSumsFile))
+	if err != nil {
+		return errors.Wrapf(err, "checksums of tool '%s' are missing, remove '%s' to reinstall it", tool.Name,
+			toolDir)
+	}
+	var sums toolSums
+	if err := json.Unmarshal(data, &sums); err != nil {
+		return errors.Wrapf(err, "parsing checksums of tool '%s' failed", tool.Name)
+	}
+	if sums.Artifact != artifact.Hash {
+		return errors.Errorf("tool '%s' has been installed from artifact '%s' but '%s' is expected, "+
+			"remove '%s' to reinstall it", tool.Name, sums.Artifact, artifact.Hash, toolDir)
+	}
+	for _, src := range artifact.Binaries {
+		checksum, err := fileChecksum(filepath.Join(toolDir, src))
+		if err != nil {
+			return err
+		}
+		if expected, exists := sums.Binaries[src]; !exists || checksum != expected {
+			return errors.Errorf("binary '%s' of tool '%s' has been modified, remove '%s' to reinstall it", src,
+				tool.Name, toolDir)
+		}
+	}
+	return nil
+}
+
+// toolsHTTPGet downloads the file used to install tools.
+// If BUILDGO_TOOLS_MIRROR environment variable is set, file is downloaded from the mirror, host and path
+// of the original URL are appended to the mirror URL. If BUILDGO_TOOLS_PROXY environment variable is set,
+// it is used as the HTTP proxy, otherwise the standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables are honored.
+func toolsHTTPGet(ctx context.Context, rawURL string) (*http.Response, error) {
+	if mirror := os.Getenv("BUILDGO_TOOLS_MIRROR"); mirror != "" {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		rawURL = strings.TrimSuffix(mirror, "/") + "/" + u.Host + u.RequestURI()
+	}
+
+	client := http.DefaultClient
+	if proxy := os.Getenv("BUILDGO_TOOLS_PROXY"); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value '%s' of BUILDGO_TOOLS_PROXY", proxy)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxyURL)
+		client = &http.Client{Transport: transport}
+	}
+
+	resp, err := client.Do(must.HTTPRequest(http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, errors.Errorf("fetching '%s' failed, status: %s", rawURL, resp.Status)
+	}
+	return resp, nil
+}
+
+// publishedChecksum returns the checksum of the file taken from the checksum file in the sha256sum format
+func publishedChecksum(ctx context.Context, checksumsURL, file string) (string, error) {
+	resp, err := toolsHTTPGet(ctx, checksumsURL)
+	if err != nil {
+		return "", errors.Wrap(err, "fetching checksums failed")
+	}
+	defer resp.Body.Close()
+
+	checksums, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == file {
+			return "sha256:" + fields[0], nil
+		}
+	}
+	return "", errors.Errorf("checksum of '%s' not found in '%s'", file, checksumsURL)
+}
+
+// exeName returns the name of the executable on the platform
+func exeName(name string, platform Platform) string {
+	if platform.OS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+// archiveExt returns the extension of the archive commonly used on the platform
+func archiveExt(platform Platform) string {
+	if platform.OS == "windows" {
+		return ".zip"
+	}
+	return ".tar.gz"
+}
+
+// toolsCacheDir returns the directory where tools are installed. It is taken from BUILDGO_TOOLS_DIR environment
+// variable if set, XDG_CACHE_HOME/buildgo/tools is used otherwise, falling back to the user cache directory.
+func toolsCacheDir() string {
+	if dir := os.Getenv("BUILDGO_TOOLS_DIR"); dir != "" {
+		return must.String(filepath.Abs(dir))
+	}
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, "buildgo", "tools")
+	}
+	return filepath.Join(must.String(os.UserCacheDir()), "buildgo", "tools")
+}
+
+// toolDirPath returns the directory where tool is installed
+func toolDirPath(name, version string, platform Platform) string {
+	return filepath.Join(toolsCacheDir(), name+"-"+version+"-"+platform.OS+"-"+platform.Arch)
+}
+
+// ToolVersion is the resolved version of the tool reported by ToolsVersions
+type ToolVersion struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Path      string `json:"path"`
+	Installed bool   `json:"installed"`
+}
+
+// ToolsVersions prints resolved versions and install paths of all the tools in JSON format
+func ToolsVersions(ctx context.Context) error {
+	host := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	goTool, err := goToolchain(ctx)
+	if err != nil {
+		return err
+	}
+
+	toolRegistryMu.Lock()
+	tools := make([]Tool, 0, len(toolRegistry))
+	for _, name := range sortedKeys(toolRegistry) {
+		tools = append(tools, toolRegistry[name])
+	}
+	toolRegistryMu.Unlock()
+
+	versions := make([]ToolVersion, 0, len(tools)+len(goTools))
+	for _, tool := range tools {
+		if tool.Name == "go" {
+			tool = goTool
+		} else if tool, err = withRepoToolVersion(tool); err != nil {
+			return err
+		}
+		versions = append(versions, ToolVersion{Name: tool.Name, Version: tool.Version})
+	}
+	for _, name := range sortedKeys(goTools) {
+		tool, err := withRepoGoToolVersion(name, goTools[name])
+		if err != nil {
+			return err
+		}
+		versions = append(versions, ToolVersion{Name: name, Version: tool.Version})
+	}
+	for i, v := range versions {
+		versions[i].Path = toolDirPath(v.Name, v.Version, host)
+		if _, err := os.Stat(versions[i].Path); err == nil {
+			versions[i].Installed = true
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return errors.WithStack(encoder.Encode(versions))
+}
+
+// touchToolDir updates modification time of the tool directory, so ToolsClean knows it is still used
+func touchToolDir(toolDir string) {
+	now := time.Now()
+	_ = os.Chtimes(toolDir, now, now)
+}
+
+// ToolsCleanConfig is the configuration of tool cache cleaning
+type ToolsCleanConfig struct {
+	// MaxAge is the time after which unused tool is removed, 30 days are used if 0
+	MaxAge time.Duration
+}
+
+// ToolsClean removes tools which haven't been used by any project recently, together with leftovers
+// of interrupted installations
+func ToolsClean(ctx context.Context, config ToolsCleanConfig) error {
+	log := logger.Get(ctx)
+	if config.MaxAge == 0 {
+		config.MaxAge = 30 * 24 * time.Hour
+	}
+
+	cacheDir := toolsCacheDir()
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		leftover := strings.HasPrefix(entry.Name(), ".download-") || strings.HasPrefix(entry.Name(), ".install-")
+		if !leftover && time.Since(info.ModTime()) < config.MaxAge {
+			continue
+		}
+
+		path := filepath.Join(cacheDir, entry.Name())
+		log.Info("Removing tool", zap.String("path", path), zap.Time("lastUsed", info.ModTime()))
+		if dryRun() {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func toolLinked(toolDir, binDir string, artifact ToolArtifact) bool {
+	for dst, src := range artifact.Binaries {
+		srcPath, err := filepath.EvalSymlinks(filepath.Join(toolDir, src))
+		if err != nil {
+			return false
+		}
+		dstPath, err := filepath.EvalSymlinks(filepath.Join(binDir, dst))
+		if err != nil || dstPath != srcPath {
+			return false
+		}
+	}
+	return true
+}
+
+func linkTool(toolDir, binDir string, artifact ToolArtifact) error {
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	for dst, src := range artifact.Binaries {
+		srcPath := filepath.Join(toolDir, src)
+		if _, err := os.Stat(srcPath); err != nil {
+			return errors.Wrapf(err, "binary '%s' does not exist in tool directory '%s'", src, toolDir)
+		}
+		dstPath := filepath.Join(binDir, dst)
+		if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+		if err := os.Symlink(srcPath, dstPath); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func prependPath(dir string) error {
+	path := os.Getenv("PATH")
+	if strings.HasPrefix(path, dir+string(os.PathListSeparator)) || path == dir {
+		return nil
+	}
+	return errors.WithStack(os.Setenv("PATH", dir+string(os.PathListSeparator)+path))
+}
+
+// installTool downloads the artifact, verifies its checksum and extracts it to the tool directory
+func installTool(ctx context.Context, tool Tool, artifact ToolArtifact, toolDir string) (string, error) {
+	log := logger.Get(ctx).With(zap.String("name", tool.Name), zap.String("version", tool.Version),
+		zap.String("url", artifact.URL))
+	log.Info("Installing tool")
+	start := time.Now()
+
+	if artifact.Hash == "" {
+		return "", errors.Errorf("checksum of tool '%s' is not pinned, add line '%s sha256:<checksum>' to '%s'",
+			tool.Name, artifact.URL, ToolsSumFile)
+	}
+	expectedHash, err := sha256Hash(artifact.Hash)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid checksum of tool '%s'", tool.Name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(toolDir), 0o755); err != nil {
+		return "", errors.WithStack(err)
+	}
+	archive, err := os.CreateTemp(filepath.Dir(toolDir), ".download-*")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	resp, err := toolsHTTPGet(ctx, artifact.URL)
+	if err != nil {
+		return "", errors.Wrapf(err, "downloading tool '%s' failed", tool.Name)
+	}
+	defer resp.Body.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(archive, io.TeeReader(resp.Body, hasher)); err != nil {
+		return "", errors.Wrapf(err, "downloading tool '%s' failed", tool.Name)
+	}
+	actualHash := hex.EncodeToString(hasher.Sum(nil))
+	if actualHash != expectedHash {
+		return "", errors.Errorf("checksum of tool '%s' does not match, expected: %s, actual: %s, url: %s", tool.Name,
+			expectedHash, actualHash, artifact.URL)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	// Tool is extracted to temporary directory and moved once completed, so partial installation is never used
+	tmpDir, err := os.MkdirTemp(filepath.Dir(toolDir), ".install-*")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := extractArtifact(artifact.URL, archive, tmpDir); err != nil {
+		return "", errors.Wrapf(err, "extracting tool '%s' failed", tool.Name)
+	}
+	if err := storeToolSums(artifact, tmpDir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpDir, toolDir); err != nil {
+		// Tool might have been installed concurrently by another process
+		if _, err2 := os.Stat(toolDir); err2 == nil {
+			return artifact.Hash, nil
+		}
+		return "", errors.WithStack(err)
+	}
+
+	log.Info("Tool installed", zap.Duration("duration", time.Since(start)))
+	return artifact.Hash, nil
+}
+
+func sha256Hash(hash string) (string, error) {
+	algorithm, checksum, found := strings.Cut(hash, ":")
+	if !found || algorithm != "sha256" {
+		return "", errors.Errorf("checksum '%s' is not in the sha256:<hex> form", hash)
+	}
+	if _, err := hex.DecodeString(checksum); err != nil || len(checksum) != 2*sha256.Size {
+		return "", errors.Errorf("checksum '%s' is not a valid sha256 hash", hash)
+	}
+	return strings.ToLower(checksum), nil
+}
+
+func extractArtifact(url string, archive *os.File, dir string) error {
+	switch {
+	case strings.HasSuffix(url, ".tar.gz") || strings.HasSuffix(url, ".tgz"):
+		gr, err := gzip.NewReader(archive)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return untar(gr, dir)
+	case strings.HasSuffix(url, ".zip"):
+		info, err := archive.Stat()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return unzip(archive, info.Size(), dir)
+	default:
+		return storeFile(filepath.Join(dir, filepath.Base(url)), archive, 0o755)
+	}
+}
+
+func untar(reader io.Reader, dir string) error {
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		path, err := extractPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return errors.WithStack(err)
+			}
+		case tar.TypeReg:
+			if err := storeFile(path, tr, header.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// Entries written through the link must not leave the directory
+			target := filepath.FromSlash(header.Linkname)
+			if filepath.IsAbs(target) {
+				return errors.Errorf("archive entry '%s' links to absolute path '%s'", header.Name, header.Linkname)
+			}
+			if _, err := extractPath(dir, filepath.Join(filepath.Dir(filepath.FromSlash(header.Name)), target)); err != nil {
+				return errors.Errorf("archive entry '%s' links to '%s' outside of the destination directory",
+					header.Name, header.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return errors.WithStack(err)
+			}
+			if err := os.Symlink(header.Linkname, path); err != nil {
+				return errors.WithStack(err)
+			}
+		case tar.TypeLink:
+			target, err := extractPath(dir, header.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return errors.WithStack(err)
+			}
+			if err := os.Link(target, path); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+}
+
+func unzip(reader io.ReaderAt, size int64, dir string) error {
+	zr, err := zip.NewReader(reader, size)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, f := range zr.File {
+		path, err := extractPath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = storeFile(path, rc, f.Mode().Perm())
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractPath returns the path where archive entry is stored, entries pointing outside of the directory are rejected
+func extractPath(dir, name string) (string, error) {
+	path := filepath.Join(dir, name)
+	if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", errors.Errorf("archive entry '%s' points outside of the destination directory", name)
+	}
+	return path, nil
+}
+
+func storeFile(path string, reader io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, reader)
+	return errors.WithStack(err)
+}
@@ -0,0 +1,235 @@
+package buildgo
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/outofforest/logger"
+	"go.uber.org/zap"
+)
+
+func TestToolChecksumVerification(t *testing.T) {
+	content := []byte("#!/bin/sh\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	url := server.URL + "/tool"
+	checksum := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	otherChecksum := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other")))
+
+	tests := []struct {
+		name     string
+		hash     string
+		toolsSum string
+		fails    bool
+	}{
+		{name: "pinned checksum", hash: checksum},
+		{name: "pinned checksum in upper case", hash: "sha256:" + strings.ToUpper(checksum[len("sha256:"):])},
+		{name: "committed checksum", toolsSum: url + " " + checksum + "\n"},
+		{name: "pinned checksum does not match", hash: otherChecksum, fails: true},
+		{name: "committed checksum does not match", toolsSum: url + " " + otherChecksum + "\n", fails: true},
+		{name: "checksum of other artifact committed", toolsSum: url + "2 " + checksum + "\n", fails: true},
+		{name: "checksum is missing", fails: true},
+		{name: "checksum is not sha256", hash: "md5:" + checksum[len("sha256:"):], fails: true},
+		{name: "checksum is truncated", hash: checksum[:20], fails: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			chdir(t, dir)
+			t.Setenv("BUILDGO_TOOLS_DIR", filepath.Join(dir, "tools"))
+			t.Setenv("PATH", os.Getenv("PATH"))
+			if test.toolsSum != "" {
+				if err := os.MkdirAll(filepath.Dir(ToolsSumFile), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, ToolsSumFile, test.toolsSum)
+			}
+
+			ctx := logger.WithLogger(context.Background(), zap.NewNop())
+			tool := Tool{
+				Name:    "tool",
+				Version: "1.0.0",
+				Artifacts: map[Platform]ToolArtifact{
+					{OS: runtime.GOOS, Arch: runtime.GOARCH}: {
+						URL:      url,
+						Hash:     test.hash,
+						Binaries: map[string]string{"tool": "tool"},
+					},
+				},
+			}
+			err := ensureTool(ctx, tool)
+			if test.fails {
+				if err == nil {
+					t.Fatal("tool installed")
+				}
+				if _, err := os.Stat(filepath.Join("bin", "tool")); err == nil {
+					t.Fatal("tool linked")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			installed, err := os.ReadFile(filepath.Join("bin", "tool"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(installed, content) {
+				t.Fatalf("unexpected content of the tool: %s", installed)
+			}
+
+			// Modified binary is detected
+			toolDir := toolDirPath(tool.Name, tool.Version, Platform{OS: runtime.GOOS, Arch: runtime.GOARCH})
+			writeFile(t, filepath.Join(toolDir, "tool"), "modified")
+			if err := ensureTool(ctx, tool); err == nil {
+				t.Fatal("modified tool is not detected")
+			}
+		})
+	}
+}
+
+type tarEntry struct {
+	Name     string
+	Type     byte
+	Linkname string
+	Content  string
+}
+
+func TestUntarPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		files   []string
+		fails   bool
+	}{
+		{
+			name:    "regular file",
+			entries: []tarEntry{{Name: "bin/tool", Type: tar.TypeReg, Content: "tool"}},
+			files:   []string{"bin/tool"},
+		},
+		{
+			name:    "absolute file is stored inside directory",
+			entries: []tarEntry{{Name: "/bin/tool", Type: tar.TypeReg, Content: "tool"}},
+			files:   []string{"bin/tool"},
+		},
+		{
+			name:    "file outside of directory",
+			entries: []tarEntry{{Name: "../escaped", Type: tar.TypeReg, Content: "tool"}},
+			fails:   true,
+		},
+		{
+			name: "symlink inside directory",
+			entries: []tarEntry{
+				{Name: "lib/tool", Type: tar.TypeReg, Content: "tool"},
+				{Name: "bin/tool", Type: tar.TypeSymlink, Linkname: "../lib/tool"},
+			},
+			files: []string{"lib/tool", "bin/tool"},
+		},
+		{
+			name:    "symlink to absolute path",
+			entries: []tarEntry{{Name: "bin/etc", Type: tar.TypeSymlink, Linkname: "/etc"}},
+			fails:   true,
+		},
+		{
+			name: "file written through symlink outside of directory",
+			entries: []tarEntry{
+				{Name: "bin/up", Type: tar.TypeSymlink, Linkname: "../.."},
+				{Name: "bin/up/escaped", Type: tar.TypeReg, Content: "tool"},
+			},
+			fails: true,
+		},
+		{
+			name: "hard link outside of directory",
+			entries: []tarEntry{
+				{Name: "bin/tool", Type: tar.TypeLink, Linkname: "../escaped"},
+			},
+			fails: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "tool")
+
+			err := untar(tarArchive(t, test.entries), dir)
+			if test.fails {
+				if err == nil {
+					t.Fatal("archive extracted")
+				}
+				if dirEscaped(t, root) {
+					t.Fatal("file stored outside of the directory")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range test.files {
+				content, err := os.ReadFile(filepath.Join(dir, file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(content) != "tool" {
+					t.Fatalf("unexpected content of '%s': %s", file, content)
+				}
+			}
+		})
+	}
+}
+
+func tarArchive(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.Name,
+			Typeflag: entry.Type,
+			Linkname: entry.Linkname,
+			Mode:     0o755,
+			Size:     int64(len(entry.Content)),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.Content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// dirEscaped returns true if anything except the destination directory was created in root
+func dirEscaped(t *testing.T, root string) bool {
+	t.Helper()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "tool" {
+			return true
+		}
+	}
+	return false
+}
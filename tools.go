@@ -2,60 +2,361 @@ package buildgo
 
 import (
 	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
 
 	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"github.com/ridge/must"
+	"go.uber.org/zap"
 )
 
-var tools = map[string]build.Tool{
+// toolRegistry contains tools installed by EnsureTool
+var toolRegistry = map[string]Tool{
 	// https://go.dev/dl/
 	"go": {
-		Name:     "go",
-		Version:  "1.22.5",
-		IsGlobal: true,
-		URL:      "https://go.dev/dl/go1.22.5.linux-amd64.tar.gz",
-		Hash:     "sha256:904b924d435eaea086515bc63235b192ea441bd8c9b198c507e85009e6e4c7f0",
-		Binaries: map[string]string{
-			"go":    "go/bin/go",
-			"gofmt": "go/bin/gofmt",
+		Name:    "go",
+		Version: "1.22.5",
+		Artifacts: map[Platform]ToolArtifact{
+			PlatformLinuxAMD64: {
+				URL:  "https://go.dev/dl/go1.22.5.linux-amd64.tar.gz",
+				Hash: "sha256:904b924d435eaea086515bc63235b192ea441bd8c9b198c507e85009e6e4c7f0",
+				Binaries: map[string]string{
+					"go":    "go/bin/go",
+					"gofmt": "go/bin/gofmt",
+				},
+			},
+		},
+		Resolve: func(ctx context.Context, platform Platform) (ToolArtifact, error) {
+			return goArtifact(ctx, "1.22.5", platform)
 		},
 	},
 
 	// https://github.com/golangci/golangci-lint/releases/
 	"golangci": {
-		Name:     "golangci",
-		Version:  "1.59.1",
-		IsGlobal: true,
-		URL:      "https://github.com/golangci/golangci-lint/releases/download/v1.59.1/golangci-lint-1.59.1-linux-amd64.tar.gz",
-		Hash:     "sha256:c30696f1292cff8778a495400745f0f9c0406a3f38d8bb12cef48d599f6c7791",
+		Name:    "golangci",
+		Version: "1.59.1",
+		Artifacts: map[Platform]ToolArtifact{
+			PlatformLinuxAMD64: {
+				URL:  "https://github.com/golangci/golangci-lint/releases/download/v1.59.1/golangci-lint-1.59.1-linux-amd64.tar.gz",
+				Hash: "sha256:c30696f1292cff8778a495400745f0f9c0406a3f38d8bb12cef48d599f6c7791",
+				Binaries: map[string]string{
+					"golangci-lint": "golangci-lint-1.59.1-linux-amd64/golangci-lint",
+				},
+			},
+		},
+		Resolve: func(ctx context.Context, platform Platform) (ToolArtifact, error) {
+			return golangCIArtifact(ctx, "1.59.1", platform)
+		},
+	},
+
+	// https://github.com/protocolbuffers/protobuf/releases
+	// Checksums are not published by the authors, they are taken from protocChecksums or ToolsSumFile.
+	"protoc": {
+		Name:    "protoc",
+		Version: "27.2",
+		Resolve: func(ctx context.Context, platform Platform) (ToolArtifact, error) {
+			return protocArtifact(ctx, "27.2", platform)
+		},
+	},
+}
+
+// toolResolvers return artifacts of the registered tools in any version, they are used when version
+// is changed by the repository configuration
+var toolResolvers = map[string]func(ctx context.Context, version string, platform Platform) (ToolArtifact, error){
+	"go":       goArtifact,
+	"golangci": golangCIArtifact,
+	"protoc":   protocArtifact,
+}
+
+// golangCIArtifact returns the artifact of golangci release for the platform
+func golangCIArtifact(ctx context.Context, version string, platform Platform) (ToolArtifact, error) {
+	releaseURL := "https://github.com/golangci/golangci-lint/releases/download/v" + version + "/"
+	name := "golangci-lint-" + version + "-" + platform.OS + "-" + platform.Arch
+	hash, err := publishedChecksum(ctx, releaseURL+"golangci-lint-"+version+"-checksums.txt",
+		name+archiveExt(platform))
+	if err != nil {
+		return ToolArtifact{}, err
+	}
+	return ToolArtifact{
+		URL:  releaseURL + name + archiveExt(platform),
+		Hash: hash,
 		Binaries: map[string]string{
-			"golangci-lint": "golangci-lint-1.59.1-linux-amd64/golangci-lint",
+			exeName("golangci-lint", platform): name + "/" + exeName("golangci-lint", platform),
 		},
+	}, nil
+}
+
+// protocChecksums are the checksums of protoc release archives by version and platform. Archives of versions
+// and platforms missing here are installed only if their checksums are committed to ToolsSumFile.
+var protocChecksums = map[string]map[Platform]string{}
+
+// protocArtifact returns the artifact of protoc release for the platform
+func protocArtifact(_ context.Context, version string, platform Platform) (ToolArtifact, error) {
+	suffixes := map[Platform]string{
+		PlatformLinuxAMD64:   "linux-x86_64",
+		PlatformLinuxARM64:   "linux-aarch_64",
+		PlatformDarwinAMD64:  "osx-x86_64",
+		PlatformDarwinARM64:  "osx-aarch_64",
+		PlatformWindowsAMD64: "win64",
+	}
+	suffix, exists := suffixes[platform]
+	if !exists {
+		return ToolArtifact{}, errors.Errorf("protoc is not available for platform %s", platform)
+	}
+	return ToolArtifact{
+		URL: "https://github.com/protocolbuffers/protobuf/releases/download/v" + version + "/protoc-" + version +
+			"-" + suffix + ".zip",
+		Hash: protocChecksums[version][platform],
+		Binaries: map[string]string{
+			exeName("protoc", platform): "bin/" + exeName("protoc", platform),
+		},
+	}, nil
+}
+
+// goTool is the tool installed using `go install`
+type goTool struct {
+	// Package is the import path of the tool's main package
+	Package string
+
+	// Version is the version of the module containing the package
+	Version string
+}
+
+var goTools = map[string]goTool{
+	// https://pkg.go.dev/golang.org/x/perf/cmd/benchstat
+	"benchstat": {
+		Package: "golang.org/x/perf/cmd/benchstat",
+		Version: "v0.0.0-20240604174448-3b48cf0e0164",
+	},
+
+	// https://pkg.go.dev/golang.org/x/vuln/cmd/govulncheck
+	"govulncheck": {
+		Package: "golang.org/x/vuln/cmd/govulncheck",
+		Version: "v1.1.3",
+	},
+
+	// https://github.com/mvdan/gofumpt/releases
+	"gofumpt": {
+		Package: "mvdan.cc/gofumpt",
+		Version: "v0.6.0",
+	},
+
+	// https://pkg.go.dev/golang.org/x/tools/cmd/goimports
+	"goimports": {
+		Package: "golang.org/x/tools/cmd/goimports",
+		Version: "v0.23.0",
+	},
+
+	// https://pkg.go.dev/golang.org/x/tools/cmd/deadcode
+	"deadcode": {
+		Package: "golang.org/x/tools/cmd/deadcode",
+		Version: "v0.23.0",
+	},
+
+	// https://pkg.go.dev/google.golang.org/protobuf/cmd/protoc-gen-go
+	"protoc-gen-go": {
+		Package: "google.golang.org/protobuf/cmd/protoc-gen-go",
+		Version: "v1.34.2",
+	},
+
+	// https://pkg.go.dev/google.golang.org/grpc/cmd/protoc-gen-go-grpc
+	"protoc-gen-go-grpc": {
+		Package: "google.golang.org/grpc/cmd/protoc-gen-go-grpc",
+		Version: "v1.4.0",
+	},
+
+	// https://github.com/uber-go/mock/releases
+	"mockgen": {
+		Package: "go.uber.org/mock/mockgen",
+		Version: "v0.5.0",
+	},
+
+	// https://github.com/sigstore/cosign/releases
+	"cosign": {
+		Package: "github.com/sigstore/cosign/v2/cmd/cosign",
+		Version: "v2.2.4",
+	},
+
+	// https://github.com/goreleaser/nfpm/releases
+	"nfpm": {
+		Package: "github.com/goreleaser/nfpm/v2/cmd/nfpm",
+		Version: "v2.38.0",
+	},
+
+	// https://pkg.go.dev/golang.org/x/exp/cmd/gorelease
+	"gorelease": {
+		Package: "golang.org/x/exp/cmd/gorelease",
+		Version: "v0.0.0-20240613232115-7f521ea00fb8",
 	},
 }
 
-// InstallAll installs all go tools
+// InstallAll installs all the tools concurrently
 func InstallAll(ctx context.Context) error {
-	return build.InstallTools(ctx, tools)
+	toolRegistryMu.Lock()
+	names := sortedKeys(toolRegistry)
+	toolRegistryMu.Unlock()
+
+	if err := EnsureTools(ctx, names...); err != nil {
+		return err
+	}
+	return ensureGoTools(ctx, sortedKeys(goTools)...)
 }
 
-// EnsureGo ensures that go is installed
+// EnsureGo ensures that go in the version pinned by the repository is installed and used.
+// See GoVersion for details.
+// If BUILDGO_COMPILER_CACHE environment variable is set, go uses the shared compiler cache, see GoCacheProg.
+// If BUILDGO_HERMETIC environment variable is set to true, go state is isolated in the repository, see useHermetic.
 func EnsureGo(ctx context.Context) error {
-	return build.EnsureTool(ctx, tools["go"])
+	tool, err := goToolchain(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ensureTool(ctx, tool); err != nil {
+		return err
+	}
+	// Prevent go from switching to another toolchain
+	if err := os.Setenv("GOTOOLCHAIN", "local"); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := useHermetic(ctx); err != nil {
+		return err
+	}
+	return useCacheProg(ctx, tool.Version)
 }
 
 // EnsureProtoC ensures that protoc is installed
 func EnsureProtoC(ctx context.Context) error {
-	return build.EnsureTool(ctx, tools["protoc"])
+	return EnsureTool(ctx, "protoc")
 }
 
 // EnsureGoProto ensures that go proto generator is installed
 func EnsureGoProto(ctx context.Context, deps build.DepsFunc) error {
-	deps(EnsureProtoC)
+	deps(EnsureGo, EnsureProtoC)
+	return ensureGoTool(ctx, "protoc-gen-go")
+}
 
-	return build.EnsureTool(ctx, tools["protoc-gen-go"])
+// EnsureGoGRPC ensures that go gRPC generator is installed
+func EnsureGoGRPC(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo, EnsureProtoC)
+	return ensureGoTool(ctx, "protoc-gen-go-grpc")
 }
 
 // EnsureGolangCI ensures that golangci is installed
 func EnsureGolangCI(ctx context.Context) error {
-	return build.EnsureTool(ctx, tools["golangci"])
+	return EnsureTool(ctx, "golangci")
+}
+
+// EnsureBenchstat ensures that benchstat is installed
+func EnsureBenchstat(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	return ensureGoTool(ctx, "benchstat")
+}
+
+// EnsureGovulncheck ensures that govulncheck is installed
+func EnsureGovulncheck(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	return ensureGoTool(ctx, "govulncheck")
+}
+
+// EnsureGofumpt ensures that gofumpt is installed
+func EnsureGofumpt(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	return ensureGoTool(ctx, "gofumpt")
+}
+
+// EnsureGoimports ensures that goimports is installed
+func EnsureGoimports(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	return ensureGoTool(ctx, "goimports")
+}
+
+// EnsureDeadcode ensures that deadcode is installed
+func EnsureDeadcode(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	return ensureGoTool(ctx, "deadcode")
+}
+
+// EnsureGorelease ensures that gorelease is installed
+func EnsureGorelease(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	return ensureGoTool(ctx, "gorelease")
+}
+
+// EnsureMockgen ensures that mockgen is installed
+func EnsureMockgen(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	return ensureGoTool(ctx, "mockgen")
+}
+
+// EnsureCosign ensures that cosign is installed
+func EnsureCosign(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	return ensureGoTool(ctx, "cosign")
+}
+
+// EnsureNFPM ensures that nfpm is installed
+func EnsureNFPM(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	return ensureGoTool(ctx, "nfpm")
+}
+
+// ensureGoTools installs go tools concurrently
+func ensureGoTools(ctx context.Context, names ...string) error {
+	return forEachParallel(ctx, names, ensureGoTool)
+}
+
+// ensureGoTool installs go tool into versioned directory and links it in the project bin directory
+func ensureGoTool(ctx context.Context, name string) error {
+	defer recordSpan(spanTool, name, "", time.Now())
+
+	tool, exists := goTools[name]
+	if !exists {
+		return errors.Errorf("go tool '%s' is not defined", name)
+	}
+	tool, err := withRepoGoToolVersion(name, tool)
+	if err != nil {
+		return err
+	}
+
+	host := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	toolDir := toolDirPath(name, tool.Version, host)
+	srcPath := filepath.Join(toolDir, exeName(filepath.Base(tool.Package), host))
+	dstPath := must.String(filepath.Abs(filepath.Join("bin", exeName(name, host))))
+
+	realSrcPath, err := filepath.EvalSymlinks(srcPath)
+	if err == nil {
+		if realPath, err := filepath.EvalSymlinks(dstPath); err == nil && realPath == realSrcPath {
+			if !dryRun() {
+				touchToolDir(toolDir)
+			}
+			return nil
+		}
+	} else {
+		logger.Get(ctx).Info("Installing go tool", zap.String("name", name), zap.String("version", tool.Version))
+		if dryRun() {
+			// Tool is not linked, because it hasn't been installed
+			return nil
+		}
+		cmd := exec.Command("go", "install", tool.Package+"@"+tool.Version)
+		cmd.Env = append(os.Environ(), "GOBIN="+toolDir)
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "installing go tool '%s' failed", name)
+		}
+	}
+	if skipInDryRun(ctx, "Linking go tool", zap.String("name", name), zap.String("version", tool.Version)) {
+		return nil
+	}
+	touchToolDir(toolDir)
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Remove(dstPath); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Symlink(srcPath, dstPath))
 }
@@ -0,0 +1,144 @@
+package buildgo
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// GoModVendor stores dependencies of all the modules in their vendor directories
+func GoModVendor(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+	return onModule(ctx, func(path string) error {
+		log.Info("Running go mod vendor", zap.String("path", path))
+		cmd := exec.Command("go", "mod", "vendor")
+		cmd.Dir = path
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "'go mod vendor' failed in module '%s'", path)
+		}
+		return nil
+	})
+}
+
+// GoModVendorCheck verifies that vendor directories of all the modules are consistent with go.mod files,
+// without modifying them. Dependencies are vendored into temporary directories and compared with the existing ones.
+func GoModVendorCheck(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+
+	var inconsistent []string
+	err := onModule(ctx, func(path string) error {
+		log.Info("Checking vendor directory", zap.String("path", path))
+
+		tmpDir, err := os.MkdirTemp("", "buildgo-vendor-*")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		vendorDir := filepath.Join(path, "vendor")
+		expectedDir := filepath.Join(tmpDir, "vendor")
+		cmd := exec.Command("go", "mod", "vendor", "-o", expectedDir)
+		cmd.Dir = path
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "'go mod vendor' failed in module '%s'", path)
+		}
+
+		// go mod vendor does not create the directory if module has no dependencies
+		if exists := fileExists(vendorDir); exists != fileExists(expectedDir) {
+			inconsistent = append(inconsistent, vendorDir)
+			return nil
+		} else if !exists {
+			return nil
+		}
+
+		// git diff returns non-zero exit code when directories differ
+		cmd = exec.Command("git", "diff", "--no-index", "--stat", "--", vendorDir, expectedDir)
+		if err := execCmds(ctx, cmd); err != nil {
+			inconsistent = append(inconsistent, vendorDir)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(inconsistent) > 0 {
+		return errors.Errorf("vendor directories are not consistent with go.mod, run 'go mod vendor': %s",
+			strings.Join(inconsistent, ", "))
+	}
+	return nil
+}
+
+// useVendor makes go build, test and list commands executed in vendored modules use vendored dependencies
+// if vendoring is enabled in the repository configuration. Flag is passed to these commands only, because other ones,
+// like `go install pkg@version` or `go list -m all`, fail in vendor mode.
+func useVendor(cmds []*exec.Cmd) error {
+	config, err := LoadRepoConfig()
+	if err != nil {
+		return err
+	}
+	if !config.Vendor || strings.Contains(os.Getenv("GOFLAGS"), "-mod=") {
+		return nil
+	}
+	for _, cmd := range cmds {
+		if len(cmd.Args) < 2 || cmd.Args[0] != "go" {
+			continue
+		}
+		switch cmd.Args[1] {
+		case "build", "test", "list":
+		default:
+			continue
+		}
+		if contains(cmd.Args, "-m") || hasFlagPrefix(cmd.Args, "-mod=") {
+			continue
+		}
+		root, err := moduleRoot(cmd.Dir)
+		if err != nil {
+			return err
+		}
+		if root == "" || !fileExists(filepath.Join(root, "vendor", "modules.txt")) {
+			continue
+		}
+		cmd.Args = append([]string{cmd.Args[0], cmd.Args[1], "-mod=vendor"}, cmd.Args[2:]...)
+	}
+	return nil
+}
+
+// moduleRoot returns the directory of go.mod file of the module containing dir, empty string is returned
+// if dir does not belong to any module
+func moduleRoot(dir string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	for {
+		if fileExists(filepath.Join(dir, "go.mod")) {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+func hasFlagPrefix(args []string, prefix string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package buildgo
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/outofforest/logger"
+	"go.uber.org/zap"
+)
+
+// Levels of verbosity set in BUILDGO_VERBOSITY environment variable
+const (
+	// verbosityQuiet shows only warnings, errors and output of failed commands and tests
+	verbosityQuiet = "quiet"
+
+	// verbosityNormal shows progress of the steps and output of commands, output of tests is shown if they fail
+	verbosityNormal = "normal"
+
+	// verbosityVerbose additionally echoes command lines together with their working directories and environment
+	// and streams the entire output of commands and tests
+	verbosityVerbose = "verbose"
+)
+
+// verbosity returns the level of verbosity set in BUILDGO_VERBOSITY environment variable, verbosityNormal is
+// the default one
+func verbosity() string {
+	switch v := os.Getenv("BUILDGO_VERBOSITY"); v {
+	case verbosityQuiet, verbosityVerbose:
+		return v
+	default:
+		return verbosityNormal
+	}
+}
+
+// withVerbosity returns context with the logger skipping informational messages in quiet mode
+func withVerbosity(ctx context.Context) context.Context {
+	if verbosity() != verbosityQuiet {
+		return ctx
+	}
+	return logger.WithLogger(ctx, logger.Get(ctx).WithOptions(zap.IncreaseLevel(zap.WarnLevel)))
+}
+
+// execQuiet executes commands, their output is printed only if they fail
+func execQuiet(ctx context.Context, cmds []*exec.Cmd) error {
+	output := &lockedBuffer{}
+	for _, cmd := range cmds {
+		if cmd.Stdout == nil || cmd.Stdout == os.Stdout {
+			cmd.Stdout = output
+		}
+		if cmd.Stderr == nil || cmd.Stderr == os.Stderr {
+			cmd.Stderr = output
+		}
+	}
+	err := execTraced(ctx, cmds...)
+	if err != nil {
+		_, _ = output.WriteTo(os.Stderr)
+	}
+	return err
+}
+
+// echoCmds logs command lines with their working directories and environment, output discarded by buildgo
+// is streamed instead
+func echoCmds(ctx context.Context, cmds []*exec.Cmd) {
+	log := logger.Get(ctx)
+	for _, cmd := range cmds {
+		if cmd.Stdout == io.Discard {
+			cmd.Stdout = os.Stdout
+		}
+		if cmd.Stderr == io.Discard {
+			cmd.Stderr = os.Stderr
+		}
+		fields := []zap.Field{zap.String("command", cmd.String())}
+		if cmd.Dir != "" {
+			fields = append(fields, zap.String("dir", cmd.Dir))
+		}
+		if env := envDiff(os.Environ(), cmd.Env); len(env) > 0 {
+			fields = append(fields, zap.Strings("env", env))
+		}
+		log.Info("Executing command", fields...)
+	}
+}
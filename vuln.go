@@ -0,0 +1,101 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// VulncheckAllowlist is the file containing IDs of accepted vulnerabilities, one per line
+const VulncheckAllowlist = "build/.vulncheck-allowlist"
+
+// vulncheckMessage is the message produced by `govulncheck -format json`
+type vulncheckMessage struct {
+	Finding *struct {
+		OSV          string `json:"osv"`
+		FixedVersion string `json:"fixed_version"`
+		Trace        []struct {
+			Module   string `json:"module"`
+			Package  string `json:"package"`
+			Function string `json:"function"`
+		} `json:"trace"`
+	} `json:"finding"`
+}
+
+// GoVulncheck scans all modules for vulnerabilities and fails if any of the reachable ones is not allowed
+// in VulncheckAllowlist
+func GoVulncheck(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo, EnsureGovulncheck)
+	log := logger.Get(ctx)
+
+	var allowlistFile string
+	if _, err := os.Stat(VulncheckAllowlist); err == nil {
+		allowlistFile = VulncheckAllowlist
+	}
+	allowlist, err := readListFile(allowlistFile)
+	if err != nil {
+		return err
+	}
+
+	return onModule(ctx, func(path string) error {
+		log.Info("Running govulncheck", zap.String("path", path))
+
+		buf := &bytes.Buffer{}
+		cmd := exec.Command("govulncheck", "-format", "json", "./...")
+		cmd.Dir = path
+		cmd.Stdout = buf
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "govulncheck failed in module '%s'", path)
+		}
+
+		vulns := map[string]bool{}
+		decoder := json.NewDecoder(buf)
+		for {
+			var msg vulncheckMessage
+			if err := decoder.Decode(&msg); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return errors.Wrap(err, "parsing govulncheck output failed")
+			}
+			// Vulnerability is reachable if the trace points to the function
+			if msg.Finding == nil || len(msg.Finding.Trace) == 0 || msg.Finding.Trace[0].Function == "" {
+				continue
+			}
+			if vulns[msg.Finding.OSV] {
+				continue
+			}
+			vulns[msg.Finding.OSV] = true
+
+			trace := msg.Finding.Trace[0]
+			if allowlist[msg.Finding.OSV] {
+				log.Warn("Allowed vulnerability found", zap.String("id", msg.Finding.OSV),
+					zap.String("module", trace.Module))
+				continue
+			}
+			log.Error("Vulnerability found", zap.String("id", msg.Finding.OSV), zap.String("module", trace.Module),
+				zap.String("package", trace.Package), zap.String("function", trace.Function),
+				zap.String("fixedVersion", msg.Finding.FixedVersion))
+		}
+
+		var found []string
+		for _, id := range sortedKeys(vulns) {
+			if !allowlist[id] {
+				found = append(found, id)
+			}
+		}
+		if len(found) > 0 {
+			return errors.Errorf("vulnerabilities found in module '%s': %s", path, strings.Join(found, ", "))
+		}
+		return nil
+	})
+}
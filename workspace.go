@@ -0,0 +1,95 @@
+package buildgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/outofforest/build"
+	"github.com/outofforest/logger"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// goWorkFile is the workspace file in the root of the repository
+const goWorkFile = "go.work"
+
+// goWork is the content of go.work reported by `go work edit -json`
+type goWork struct {
+	Use []struct {
+		DiskPath string
+	}
+}
+
+// goWorkModules returns paths of modules used by the workspace
+func goWorkModules(ctx context.Context) ([]string, error) {
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("go", "work", "edit", "-json")
+	cmd.Stdout = buf
+	if err := execCmds(ctx, cmd); err != nil {
+		return nil, errors.Wrapf(err, "reading %s failed", goWorkFile)
+	}
+
+	var work goWork
+	if err := json.Unmarshal(buf.Bytes(), &work); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s failed", goWorkFile)
+	}
+	paths := make([]string, 0, len(work.Use))
+	for _, use := range work.Use {
+		paths = append(paths, filepath.Clean(filepath.FromSlash(use.DiskPath)))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// GoWorkUpdate creates or updates go.work file so it uses all the modules found in the repository
+func GoWorkUpdate(ctx context.Context, deps build.DepsFunc) error {
+	deps(EnsureGo)
+	log := logger.Get(ctx)
+
+	discovered := map[string]bool{}
+	if err := walkModules(func(path string) error {
+		discovered[path] = true
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if !fileExists(goWorkFile) {
+		log.Info("Creating workspace", zap.String("path", goWorkFile))
+		cmd := exec.Command("go", "work", "init")
+		if err := execCmds(ctx, cmd); err != nil {
+			return errors.Wrapf(err, "creating %s failed", goWorkFile)
+		}
+	}
+
+	used, err := goWorkModules(ctx)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"work", "edit"}
+	for _, path := range used {
+		if !discovered[path] {
+			log.Info("Removing module from workspace", zap.String("path", path))
+			args = append(args, "-dropuse="+path)
+		}
+		delete(discovered, path)
+	}
+	for _, path := range sortedKeys(discovered) {
+		log.Info("Adding module to workspace", zap.String("path", path))
+		args = append(args, "-use="+path)
+	}
+	if len(args) == 2 {
+		return nil
+	}
+
+	cmd := exec.Command("go", args...)
+	if err := execCmds(ctx, cmd); err != nil {
+		return errors.Wrapf(err, "updating %s failed", goWorkFile)
+	}
+	return nil
+}